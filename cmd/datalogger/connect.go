@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rs/cors"
+	"github.com/streamingfast/hivemapper-data-logger/gen/proto/sf/events/v1/eventsv1connect"
+	"github.com/streamingfast/hivemapper-data-logger/gen/proto/sf/replay/v1/replayv1connect"
+	"github.com/streamingfast/hivemapper-data-logger/webconnect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// startConnectServer serves the events service, and the replay service when
+// replayServer is not nil, in the background.
+func startConnectServer(listenAddr string, eventServer *webconnect.EventsServer, replayServer *webconnect.ReplayServer) {
+	mux := http.NewServeMux()
+
+	opts := cors.Options{
+		AllowedHeaders: []string{"*"},
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+	}
+
+	path, handler := eventsv1connect.NewEventServiceHandler(eventServer)
+	mux.Handle(path, cors.New(opts).Handler(handler))
+
+	if replayServer != nil {
+		path, handler := replayv1connect.NewReplayServiceHandler(replayServer)
+		mux.Handle(path, cors.New(opts).Handler(handler))
+	}
+
+	go func() {
+		fmt.Printf("Starting GRPC server on %s ...\n", listenAddr)
+		err := http.ListenAndServe(listenAddr, h2c.NewHandler(mux, &http2.Server{}))
+		if err != nil {
+			panic(fmt.Sprintf("running server: %s", err.Error()))
+		}
+	}()
+}
@@ -4,11 +4,22 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/daedaleanai/ublox/ubx"
 	"github.com/streamingfast/gnss-controller/device/neom9n"
 	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/align"
+	"github.com/streamingfast/hivemapper-data-logger/data/clock"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
 	"github.com/streamingfast/hivemapper-data-logger/data/direction"
+	"github.com/streamingfast/hivemapper-data-logger/data/geofence"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/integrity"
 	"github.com/streamingfast/hivemapper-data-logger/data/merged"
+	"github.com/streamingfast/hivemapper-data-logger/data/odometer"
+	"github.com/streamingfast/hivemapper-data-logger/data/privacy"
+	"github.com/streamingfast/hivemapper-data-logger/data/speeding"
+	"github.com/streamingfast/hivemapper-data-logger/data/trip"
 	"github.com/streamingfast/hivemapper-data-logger/logger"
 	"github.com/streamingfast/imu-controller/device/iim42652"
 )
@@ -18,6 +29,16 @@ type DataHandler struct {
 	gnssJsonLogger    *logger.JsonFile
 	imuJsonLogger     *logger.JsonFile
 	gnssData          *neom9n.Data
+	gnssID            int64 // id of gnssData in the gnss table
+	lastGnssID        int64
+	gnssRawData       *neom9n.Data
+	gnssFiltered      *gnss.GnssFilteredData
+	gnssQuality       *gnss.Quality
+	deadReckoning     *deadreckoning.Estimator
+	privacy           *privacy.Redactor
+	clock             *clock.Sync
+	aligner           *align.Aligner
+	lastRxmMeasx      *ubx.RxmMeasx
 	lastImageFileName string
 }
 
@@ -28,11 +49,12 @@ func NewDataHandler(
 	gnssSaveInterval time.Duration,
 	imuJsonDestFolder string,
 	imuSaveInterval time.Duration,
+	deadReckoning *deadreckoning.Estimator,
 ) (*DataHandler, error) {
 	sqliteLogger := logger.NewSqlite(
 		dbPath,
-		[]logger.CreateTableQueryFunc{merged.CreateTableQuery, merged.ImuRawCreateTableQuery, direction.CreateTableQuery},
-		[]logger.PurgeQueryFunc{merged.PurgeQuery, merged.ImuRawPurgeQuery, direction.PurgeQuery})
+		[]logger.CreateTableQueryFunc{gnss.CreateTableQuery, merged.CreateTableQuery, clock.CreateTableQuery, merged.ImuRawCreateTableQuery, gnss.SatellitesCreateTableQuery, direction.CreateTableQuery, odometer.CreateTableQuery, trip.CreateTableQuery, geofence.CreateTableQuery, privacy.CreateTableQuery, speeding.CreateTableQuery, integrity.CreateTableQuery},
+		[]logger.PurgeQueryFunc{merged.PurgeQuery, clock.PurgeQuery, merged.ImuRawPurgeQuery, gnss.SatellitesPurgeQuery, direction.PurgeQuery, trip.PurgeQuery, geofence.PurgeQuery, privacy.PurgeQuery, speeding.PurgeQuery, integrity.PurgeQuery, gnss.PurgeQuery})
 	err := sqliteLogger.Init(dbLogTTL)
 	if err != nil {
 		return nil, fmt.Errorf("initializing sqlite logger database: %w", err)
@@ -50,11 +72,27 @@ func NewDataHandler(
 		return nil, fmt.Errorf("initializing imu json logger: %w", err)
 	}
 
-	return &DataHandler{
+	lastGnssID, err := gnss.LastID(sqliteLogger)
+	if err != nil {
+		return nil, fmt.Errorf("getting last gnss id: %w", err)
+	}
+
+	h := &DataHandler{
 		sqliteLogger:   sqliteLogger,
 		gnssJsonLogger: gnssJsonLogger,
 		imuJsonLogger:  imuJsonLogger,
-	}, err
+		deadReckoning:  deadReckoning,
+		lastGnssID:     lastGnssID,
+	}
+	h.aligner = align.NewAligner([]align.SampleHandler{h.logAlignedImuRaw})
+
+	// the imu rows before the first fix reference an empty one
+	noFix := mustGnssEvent(nil)
+	h.gnssID, err = h.logGnss(noFix, noFix)
+	if err != nil {
+		return nil, fmt.Errorf("logging empty gnss data: %w", err)
+	}
+	return h, nil
 }
 
 func (h *DataHandler) HandleImage(imageFileName string) error {
@@ -68,20 +106,83 @@ func (h *DataHandler) HandleOrientedAcceleration(
 	temperature iim42652.Temperature,
 	orientation imu.Orientation,
 ) error {
-	gnssData := mustGnssEvent(h.gnssData)
-	err := h.sqliteLogger.Log(merged.NewSqlWrapper(acceleration, tiltAngles, gnssData, temperature, orientation))
+	err := h.sqliteLogger.Log(merged.NewSqlWrapper(acceleration, tiltAngles, h.gnssID, temperature, orientation))
 	if err != nil {
 		return fmt.Errorf("logging merged data to sqlite: %w", err)
 	}
 	return nil
 }
 
+// HandleGnssQuality keeps the raw fix and its quality, called before the
+// filtering, to be logged along the filtered fix received by HandlerGnssData.
+// The rejected fixes do not reach HandlerGnssData and are ignored.
+func (h *DataHandler) HandleGnssQuality(raw *neom9n.Data, quality *gnss.Quality) error {
+	if quality.Verdict == gnss.VerdictRejected {
+		return nil
+	}
+	h.gnssRawData = raw
+	h.gnssFiltered = nil
+	h.gnssQuality = quality
+	return nil
+}
+
+func (h *DataHandler) HandleGnssFilteredData(_ *neom9n.Data, filtered *gnss.GnssFilteredData) error {
+	h.gnssFiltered = filtered
+	return nil
+}
+
 func (h *DataHandler) HandlerGnssData(data *neom9n.Data) error {
+	if h.privacy != nil {
+		wasRedacting := h.redacting()
+		err := h.privacy.HandleGnssData(data)
+		if err != nil {
+			return fmt.Errorf("privacy gnss data: %w", err)
+		}
+		// the imu data waiting for the next fix is logged before the redacted
+		// one, held at the last fix before the zone
+		if !wasRedacting && h.redacting() {
+			err = h.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	gnssID, err := h.logGnss(h.redact(data), h.redact(h.rawGnssData(data)))
+	if err != nil {
+		return fmt.Errorf("logging gnss data to sqlite: %w", err)
+	}
 	h.gnssData = data
+	h.gnssID = gnssID
+	err = h.deadReckoning.HandleGnssData(data)
+	if err != nil {
+		return fmt.Errorf("dead reckoning gnss data: %w", err)
+	}
+	// the redacted imu data is not aligned, the fixes inside the privacy
+	// zones are kept out of the interpolation
+	if !h.redacting() {
+		err = h.aligner.HandleGnssData(data)
+		if err != nil {
+			return fmt.Errorf("aligning imu data: %w", err)
+		}
+	}
+	err = h.logSatellites(data)
+	if err != nil {
+		return fmt.Errorf("logging satellites to sqlite: %w", err)
+	}
 	if !h.gnssJsonLogger.IsLogging && data.Fix != "none" {
 		h.gnssJsonLogger.StartStoring()
 	}
-	err := h.gnssJsonLogger.Log(data.Timestamp, data)
+
+	raw, filtered := h.filteredGnss(data)
+	qualified := gnss.NewQualifiedData(data, raw, filtered, h.gnssQuality)
+	if h.redacting() {
+		if h.privacy.Mode() == privacy.ModeOmit {
+			return nil
+		}
+		qualified = gnss.NewQualifiedData(h.privacy.Redact(data), nil, nil, h.gnssQuality)
+	}
+	err = h.gnssJsonLogger.Log(data.Timestamp, qualified)
 
 	if err != nil {
 		return fmt.Errorf("logging gnss data to json: %w", err)
@@ -90,24 +191,134 @@ func (h *DataHandler) HandlerGnssData(data *neom9n.Data) error {
 }
 
 func (h *DataHandler) HandleRawImuFeed(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, temperature iim42652.Temperature) error {
-	gnssData := mustGnssEvent(h.gnssData)
-	err := h.sqliteLogger.Log(merged.NewImuRawSqlWrapper(temperature, acceleration, gnssData /*h.lastImageFileName*/))
+	err := h.deadReckoning.HandleRawImuFeed(acceleration, angularRate, temperature)
+	if err != nil {
+		return fmt.Errorf("dead reckoning imu data: %w", err)
+	}
+
+	gnssData, gnssID := mustGnssEvent(h.gnssData), h.gnssID
+	position := h.deadReckoning.Position()
+	if position == nil {
+		position = deadreckoning.NewGnssPosition(gnssData)
+	}
+	if h.redacting() {
+		gnssData = h.privacy.Redact(gnssData)
+		redacted := *position
+		redacted.Latitude, redacted.Longitude = h.privacy.RedactCoordinates(position.Latitude, position.Longitude)
+		position = &redacted
+	}
+
+	// the imu data is stamped with the system time, logged along its gnss
+	// corrected time
+	systemTime := acceleration.Time
+	if h.clock != nil {
+		corrected := *acceleration
+		corrected.Time = h.clock.Correct(systemTime)
+		acceleration = &corrected
+	}
+	imuRaw := merged.NewImuRawSqlWrapper(temperature, acceleration, systemTime, gnssID, gnssData, position /*h.lastImageFileName*/)
+	if h.redacting() {
+		err = h.sqliteLogger.Log(imuRaw)
+	} else {
+		err = h.aligner.AddSample(imuRaw)
+	}
 	if err != nil {
 		return fmt.Errorf("logging raw imu data to sqlite: %w", err)
 	}
 	imuDataWrapper := logger.NewImuDataWrapper(temperature, acceleration, angularRate)
-	err = h.imuJsonLogger.Log(time.Now(), imuDataWrapper)
+	err = h.imuJsonLogger.Log(acceleration.Time, imuDataWrapper)
 	if err != nil {
 		return fmt.Errorf("logging raw imu data to json: %w", err)
 	}
 	return nil
 }
 
+// logGnss logs the gnss data once, the imu rows referencing it by the returned
+// id.
+func (h *DataHandler) logGnss(data *neom9n.Data, raw *neom9n.Data) (int64, error) {
+	h.lastGnssID++
+	err := h.sqliteLogger.Log(gnss.NewSqlWrapper(h.lastGnssID, data, raw))
+	if err != nil {
+		return 0, err
+	}
+	return h.lastGnssID, nil
+}
+
+// logSatellites logs the RXM-MEASX measurements once per gnss epoch, the data
+// keeping the last ones until new ones are received. The epochs are told apart
+// by their times of week, the data being a copy of the fix through the bus.
+func (h *DataHandler) logSatellites(data *neom9n.Data) error {
+	if data.RxmMeasx == nil || (h.lastRxmMeasx != nil && rxmMeasxEpoch(data.RxmMeasx) == rxmMeasxEpoch(h.lastRxmMeasx)) {
+		return nil
+	}
+	h.lastRxmMeasx = data.RxmMeasx
+
+	for _, satellite := range gnss.NewSatelliteSqlWrappers(data) {
+		err := h.sqliteLogger.Log(satellite)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rxmMeasxEpoch(measx *ubx.RxmMeasx) [4]uint32 {
+	return [4]uint32{measx.GpsTOW_ms, measx.GloTOW_ms, measx.BdsTOW_ms, measx.QzssTOW_ms}
+}
+
+// logAlignedImuRaw logs the imu data once the gnss data is interpolated at
+// its time.
+func (h *DataHandler) logAlignedImuRaw(s align.Sample) error {
+	return h.sqliteLogger.Log(s.(*merged.ImuRawSqlWrapper))
+}
+
+// Flush logs the imu data still waiting for the next fix to be aligned.
+func (h *DataHandler) Flush() error {
+	err := h.aligner.Flush()
+	if err != nil {
+		return fmt.Errorf("flushing aligned imu data: %w", err)
+	}
+	return nil
+}
+
 func (h *DataHandler) HandleDirectionEvent(event data.Event) error {
-	gnssData := mustGnssEvent(h.gnssData)
+	gnssData := h.redact(mustGnssEvent(h.gnssData))
 	err := h.sqliteLogger.Log(direction.NewSqlWrapper(event, gnssData))
 	if err != nil {
 		return fmt.Errorf("logging direction data to sqlite: %w", err)
 	}
 	return nil
 }
+
+// rawGnssData is the raw fix of data, data itself when it was not filtered.
+func (h *DataHandler) rawGnssData(data *neom9n.Data) *neom9n.Data {
+	raw, _ := h.filteredGnss(data)
+	if raw == nil {
+		return data
+	}
+	return raw
+}
+
+// filteredGnss is the raw fix and the filtered state of data, both nil when
+// data was not filtered.
+func (h *DataHandler) filteredGnss(data *neom9n.Data) (*neom9n.Data, *gnss.GnssFilteredData) {
+	if h.gnssRawData == nil || h.gnssFiltered == nil || !h.gnssRawData.Timestamp.Equal(data.Timestamp) {
+		return nil, nil
+	}
+	return h.gnssRawData, h.gnssFiltered
+}
+
+// redacting tells if the gnss coordinates are to be redacted, inside a privacy
+// zone.
+func (h *DataHandler) redacting() bool {
+	return h.privacy != nil && h.privacy.Redacting()
+}
+
+// redact is the redacted copy of data when inside a privacy zone, data itself
+// otherwise.
+func (h *DataHandler) redact(data *neom9n.Data) *neom9n.Data {
+	if !h.redacting() {
+		return data
+	}
+	return h.privacy.Redact(data)
+}
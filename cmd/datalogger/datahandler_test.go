@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/privacy"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDataHandler(t *testing.T) (*DataHandler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	gnssDir := path.Join(dir, "gps")
+	h, err := NewDataHandler(path.Join(dir, "data.db"), time.Hour, gnssDir, time.Hour, path.Join(dir, "imu"), time.Hour, deadreckoning.NewEstimator())
+	require.NoError(t, err)
+	// only latest.log is written, without the rotated files being stored in
+	// the background
+	h.gnssJsonLogger.IsLogging = true
+	h.imuJsonLogger.IsLogging = true
+	return h, gnssDir
+}
+
+// gnssFix is a fix at seconds from t0, with the blocks the device always sets.
+func gnssFix(t0 time.Time, seconds int, latitude float64, longitude float64) *neom9n.Data {
+	d := mustGnssEvent(nil)
+	d.Timestamp = t0.Add(time.Duration(seconds) * time.Second)
+	d.SystemTime = d.Timestamp
+	d.Fix = "3D"
+	d.Latitude = latitude
+	d.Longitude = longitude
+	return d
+}
+
+func TestDataHandler_QualifiedData(t *testing.T) {
+	h, gnssDir := newTestDataHandler(t)
+	latest := func() map[string]any {
+		content, err := os.ReadFile(path.Join(gnssDir, "latest.log"))
+		require.NoError(t, err)
+		qualified := map[string]any{}
+		require.NoError(t, json.Unmarshal(content, &qualified))
+		return qualified
+	}
+
+	t0 := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	raw := gnssFix(t0, 0, 45.5, -73.4)
+	filtered := *raw
+	filtered.Latitude = 45.50001
+	require.NoError(t, h.HandleGnssQuality(raw, &gnss.Quality{Verdict: gnss.VerdictGood}))
+	require.NoError(t, h.HandleGnssFilteredData(raw, &gnss.GnssFilteredData{Latitude: filtered.Latitude, Longitude: filtered.Longitude}))
+	require.NoError(t, h.HandlerGnssData(&filtered))
+	qualified := latest()
+	require.Equal(t, map[string]any{"latitude": 45.5, "longitude": -73.4}, qualified["raw"])
+	require.NotNil(t, qualified["filtered"])
+
+	// the filter state is from the previous fix, this one not being filtered
+	unfiltered := gnssFix(t0, 1, 45.6, -73.4)
+	require.NoError(t, h.HandlerGnssData(unfiltered))
+	qualified = latest()
+	require.NotContains(t, qualified, "raw")
+	require.NotContains(t, qualified, "filtered")
+	require.Equal(t, 45.6, qualified["latitude"])
+}
+
+func TestDataHandler_RedactionFlushesAligner(t *testing.T) {
+	h, _ := newTestDataHandler(t)
+	var err error
+	h.privacy, err = privacy.NewRedactor([]*privacy.Zone{{ID: "home", Center: geo.NewCoordinate(-73.44, 45.575), Radius: 300}})
+	require.NoError(t, err)
+
+	imuAt := func(at time.Time) {
+		require.NoError(t, h.HandleRawImuFeed(imu.NewAcceleration(0, 0, 1, 1, at), &iim42652.AngularRate{}, iim42652.NewTemperature(20)))
+	}
+
+	// the imu data received after the last fix before home waits for the next
+	// fix to be aligned, which is inside home
+	beforeHome := time.Date(2023, 9, 1, 18, 0, 0, 0, time.UTC)
+	atHome := beforeHome.Add(time.Second)
+	require.NoError(t, h.HandlerGnssData(gnssFix(beforeHome, 0, 45.575, -73.45)))
+	imuAt(beforeHome.Add(200 * time.Millisecond))
+	imuAt(beforeHome.Add(400 * time.Millisecond))
+	require.NoError(t, h.HandlerGnssData(gnssFix(atHome, 0, 45.575, -73.44)))
+	imuAt(atHome.Add(200 * time.Millisecond))
+	h.sqliteLogger.Flush()
+
+	var rows []string
+	require.NoError(t, h.sqliteLogger.Query(false, "SELECT cast(imu_time as text), position_longitude FROM imu_raw_samples ORDER BY id", func(r *sql.Rows) error {
+		var imuTime string
+		var longitude float64
+		err := r.Scan(&imuTime, &longitude)
+		rows = append(rows, fmt.Sprintf("%s %.2f", imuTime, longitude))
+		return err
+	}, nil))
+	require.Equal(t, []string{"2023-09-01 18:00:00.2 -73.45", "2023-09-01 18:00:00.4 -73.45", "2023-09-01 18:00:01.2 0.00"}, rows)
+}
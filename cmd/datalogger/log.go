@@ -3,23 +3,32 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/handlers"
 	gmux "github.com/gorilla/mux"
-	"github.com/rs/cors"
 	"github.com/spf13/cobra"
 	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/bus"
+	"github.com/streamingfast/hivemapper-data-logger/data/clock"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
+	"github.com/streamingfast/hivemapper-data-logger/data/geofence"
 	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/integrity"
+	"github.com/streamingfast/hivemapper-data-logger/data/odometer"
+	"github.com/streamingfast/hivemapper-data-logger/data/privacy"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+	"github.com/streamingfast/hivemapper-data-logger/data/speeding"
+	"github.com/streamingfast/hivemapper-data-logger/data/trip"
 	"github.com/streamingfast/hivemapper-data-logger/download"
-	"github.com/streamingfast/hivemapper-data-logger/gen/proto/sf/events/v1/eventsv1connect"
 	"github.com/streamingfast/hivemapper-data-logger/webconnect"
 	"github.com/streamingfast/imu-controller/device/iim42652"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 )
 
 var LogCmd = &cobra.Command{
@@ -49,7 +58,7 @@ func init() {
 	LogCmd.Flags().String("time-valid-threshold", "resolved", "resolved, time or date")
 
 	// Sqlite database
-	LogCmd.Flags().String("db-output-path", "/mnt/data/gnss.v1.1.0.db", "path to sqliteLogger database")
+	LogCmd.Flags().String("db-output-path", "/mnt/data/gnss.v1.3.0.db", "path to sqliteLogger database")
 	LogCmd.Flags().Duration("db-log-ttl", 12*time.Hour, "ttl of logs in database")
 	LogCmd.Flags().String("imu-dev-path", "/dev/spidev0.0", "Config serial location")
 
@@ -64,6 +73,40 @@ func init() {
 
 	LogCmd.Flags().Bool("skip-filtering", false, "skip filtering of gnss data")
 
+	// Odometer
+	LogCmd.Flags().Float64("odometer-max-horizontal-accuracy", 10, "gnss fixes less accurate than this, in meters, are not counted by the odometer")
+	LogCmd.Flags().Duration("odometer-persist-interval", 10*time.Second, "interval at which the odometer is saved to the database")
+
+	// Trips
+	LogCmd.Flags().Duration("trip-stop-duration", 5*time.Minute, "how long the vehicle has to stay stopped to end a trip")
+
+	// Geofencing
+	LogCmd.Flags().String("geofences-file", "", "GeoJSON file of the geofence polygons, entering and leaving them emitting GEOFENCE_ENTER and GEOFENCE_EXIT events. No geofencing when empty")
+
+	// Clock
+	LogCmd.Flags().Duration("clock-drift-threshold", time.Second, "by how much the system clock offset from the gnss time has to move to emit a CLOCK_DRIFT event")
+	LogCmd.Flags().Duration("clock-offset-persist-interval", time.Minute, "interval at which the system clock offset from the gnss time is saved to the database")
+
+	// Speeding
+	LogCmd.Flags().String("roads-file", "", "road network file (written by roads import, or GeoJSON ways) the gnss speed is compared with the speed limits of, emitting SPEEDING_START and SPEEDING_END events. No speeding detection when empty")
+	LogCmd.Flags().String("speed-limits", "", "speed limits, in km/h, of the road classes applying when a way has no maxspeed, overriding the defaults (ex: residential=30,motorway=110)")
+	LogCmd.Flags().Float64("speeding-tolerance", 5, "by how many km/h the speed limit has to be exceeded to be speeding")
+
+	// GNSS integrity
+	LogCmd.Flags().Int("integrity-jam-ind-threshold", 200, "MON-RF jamming indicator, from 0 to 255, from which a GNSS_JAMMING event is emitted")
+	LogCmd.Flags().Float64("integrity-max-implied-speed", 100, "speed, in m/s, implied by two consecutive fixes over which the position jump is evidence of a GNSS_SPOOFING_SUSPECTED event")
+	LogCmd.Flags().Duration("integrity-max-time-jump", time.Second, "by how much the gnss time can move differently from the system time between two consecutive fixes before being evidence of a GNSS_SPOOFING_SUSPECTED event")
+
+	// Sinks
+	LogCmd.Flags().Int("sink-queue-size", 1000, "number of handler calls each sink queues, the sinks handling the sensor data in their own goroutine, before applying its drop policy")
+	LogCmd.Flags().String("sink-policies", "", "drop policies (block, drop-oldest or drop-newest) overriding the defaults of the sinks: data, odometer, events, integrity, geofence and speeding (ex: data=drop-oldest,events=drop-newest)")
+
+	// Privacy
+	LogCmd.Flags().String("privacy-zones-file", "", "GeoJSON file of the privacy zones, circles as points with a radius property in meters or polygons, inside which the gnss coordinates are redacted. No redaction when empty")
+	LogCmd.Flags().String("privacy-mode", privacy.ModeOmit, "redaction of the gnss coordinates inside a privacy zone: 'omit' drops the gnss json logs and zeroes the coordinates in the database, 'fuzz' snaps them to a coarse grid")
+	LogCmd.Flags().Float64("privacy-exit-distance", 200, "distance, in meters, travelled after leaving a privacy zone during which the gnss coordinates are still redacted")
+	LogCmd.Flags().Float64("privacy-fuzz-grid", 1000, "size, in meters, of the grid the gnss coordinates are snapped to with the 'fuzz' privacy mode")
+
 	RootCmd.AddCommand(LogCmd)
 }
 
@@ -109,6 +152,12 @@ func logRun(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("initializing neom9n: %w", err)
 	}
 
+	sinkPolicies, err := bus.ParsePolicies(mustGetString(cmd, "sink-policies"))
+	if err != nil {
+		return fmt.Errorf("parsing sink policies: %w", err)
+	}
+	eventBus := bus.NewBus(bus.WithQueueSize(mustGetInt(cmd, "sink-queue-size")), bus.WithPolicies(sinkPolicies))
+
 	listenAddr := mustGetString(cmd, "listen-addr")
 	eventServer := webconnect.NewEventServer()
 
@@ -119,11 +168,51 @@ func logRun(cmd *cobra.Command, _ []string) error {
 		mustGetDuration(cmd, "gnss-json-save-interval"),
 		mustGetString(cmd, "imu-json-destination-folder"),
 		mustGetDuration(cmd, "imu-json-save-interval"),
+		deadreckoning.NewEstimator(deadreckoning.WithYawAxis(yawAxis(mustGetString(cmd, "imu-axis-map")), invZ)),
 	)
 	if err != nil {
 		return fmt.Errorf("creating data handler: %w", err)
 	}
 
+	if privacyZonesFile := mustGetString(cmd, "privacy-zones-file"); privacyZonesFile != "" {
+		zones, err := privacy.LoadZones(privacyZonesFile)
+		if err != nil {
+			return fmt.Errorf("loading privacy zones: %w", err)
+		}
+		fmt.Printf("Loaded %d privacy zones\n", len(zones))
+
+		dataHandler.privacy, err = privacy.NewRedactor(
+			zones,
+			privacy.WithMode(mustGetString(cmd, "privacy-mode")),
+			privacy.WithExitDistance(mustGetFloat64(cmd, "privacy-exit-distance")),
+			privacy.WithFuzzGrid(mustGetFloat64(cmd, "privacy-fuzz-grid")),
+			privacy.WithStore(privacy.NewSqlStore(dataHandler.sqliteLogger)),
+		)
+		if err != nil {
+			return fmt.Errorf("creating privacy redactor: %w", err)
+		}
+	}
+
+	tripStore := trip.NewSqlStore(dataHandler.sqliteLogger)
+	tripTracker, err := trip.NewTracker(
+		[]trip.EventHandler{eventServer.SendEvent},
+		trip.WithStop(4/3.6, mustGetDuration(cmd, "trip-stop-duration")),
+		trip.WithStore(tripStore, 30*time.Second),
+		trip.WithRedaction(dataHandler.privacy.RedactFix),
+	)
+	if err != nil {
+		return fmt.Errorf("creating trip tracker: %w", err)
+	}
+
+	odo, err := odometer.NewOdometer(
+		[]odometer.EventHandler{eventServer.SendEvent, tripTracker.HandleEvent},
+		odometer.WithMaxHorizontalAccuracy(mustGetFloat64(cmd, "odometer-max-horizontal-accuracy")),
+		odometer.WithStore(odometer.NewSqlStore(dataHandler.sqliteLogger), mustGetDuration(cmd, "odometer-persist-interval")),
+	)
+	if err != nil {
+		return fmt.Errorf("creating odometer: %w", err)
+	}
+
 	//directionEventFeed := direction.NewDirectionEventFeed(conf, dataHandler.HandleDirectionEvent, eventServer.HandleDirectionEvent)
 	//orientedEventFeed := imu.NewOrientedAccelerationFeed(directionEventFeed.HandleOrientedAcceleration, dataHandler.HandleOrientedAcceleration)
 	//tiltCorrectedAccelerationEventFeed := imu.NewTiltCorrectedAccelerationFeed(orientedEventFeed.HandleTiltCorrectedAcceleration)
@@ -137,10 +226,22 @@ func logRun(cmd *cobra.Command, _ []string) error {
 	//	}
 	//}()
 
+	clockSync := clock.NewSync(
+		[]clock.EventHandler{eventServer.SendEvent, tripTracker.HandleEvent},
+		clock.WithDriftThreshold(mustGetDuration(cmd, "clock-drift-threshold")),
+		clock.WithStore(clock.NewSqlStore(dataHandler.sqliteLogger), mustGetDuration(cmd, "clock-offset-persist-interval")),
+	)
+	dataHandler.clock = clockSync
+
+	// the handlers sharing state share a sink, getting their calls in order
+	dataSink := eventBus.NewSink("data", bus.PolicyBlock)
+	odometerSink := eventBus.NewSink("odometer", bus.PolicyBlock)
+
 	rawImuEventFeed := imu.NewRawFeed(
 		imuDevice,
 		//tiltCorrectedAccelerationEventFeed.HandleRawFeed,
-		dataHandler.HandleRawImuFeed,
+		bus.RawFeedHandler(dataSink, dataHandler.HandleRawImuFeed),
+		bus.RawFeedHandler(odometerSink, odo.HandleRawImuFeed),
 	)
 	go func() {
 		err := rawImuEventFeed.Run(axisMap)
@@ -149,17 +250,66 @@ func logRun(cmd *cobra.Command, _ []string) error {
 		}
 	}()
 
-	var options []gnss.Option
+	integrityMonitor := newIntegrityMonitor(cmd, []integrity.EventHandler{
+		eventServer.SendEvent,
+		tripTracker.HandleEvent,
+		integrity.NewSqlStore(dataHandler.sqliteLogger, integrity.WithRedaction(dataHandler.privacy.RedactFix)).HandleEvent,
+	})
+
+	options := []gnss.Option{
+		gnss.WithQualityHandlers(
+			bus.QualityHandler(dataSink, dataHandler.HandleGnssQuality),
+			bus.QualityHandler(eventBus.NewSink("integrity", bus.PolicyBlock), integrityMonitor.HandleGnssQuality),
+		),
+		gnss.WithFilteredDataHandlers(bus.FilteredDataHandler(dataSink, dataHandler.HandleGnssFilteredData)),
+	}
 	if mustGetBool(cmd, "skip-filtering") {
 		options = append(options, gnss.WithSkipFiltering())
 	}
+	// the clock sync stays in the gnss goroutine, timing the fixes
+	gnssDataHandlers := []gnss.GnssDataHandler{
+		bus.GnssDataHandler(dataSink, dataHandler.HandlerGnssData),
+		bus.GnssDataHandler(odometerSink, odo.HandleGnssData),
+		clockSync.HandleGnssData,
+		//directionEventFeed.HandleGnssData,
+		bus.GnssDataHandler(eventBus.NewSink("events", bus.PolicyDropOldest), eventServer.HandleGnssData),
+	}
+	if geofencesFile := mustGetString(cmd, "geofences-file"); geofencesFile != "" {
+		fences, err := geofence.LoadFences(geofencesFile)
+		if err != nil {
+			return fmt.Errorf("loading geofences: %w", err)
+		}
+		fmt.Printf("Loaded %d geofences\n", len(fences))
+
+		monitor := geofence.NewMonitor(fences, []geofence.EventHandler{
+			eventServer.SendEvent,
+			tripTracker.HandleEvent,
+			geofence.NewSqlStore(dataHandler.sqliteLogger, geofence.WithRedaction(dataHandler.privacy.RedactFix)).HandleEvent,
+		})
+		gnssDataHandlers = append(gnssDataHandlers, bus.GnssDataHandler(eventBus.NewSink("geofence", bus.PolicyBlock), monitor.HandleGnssData))
+	}
+
+	if roadsFile := mustGetString(cmd, "roads-file"); roadsFile != "" {
+		ways, err := roads.Load(roadsFile)
+		if err != nil {
+			return fmt.Errorf("loading roads: %w", err)
+		}
+		fmt.Printf("Loaded %d ways\n", len(ways))
+
+		tracker, err := newSpeedingTracker(cmd, roads.NewIndex(ways), []speeding.EventHandler{
+			eventServer.SendEvent,
+			tripTracker.HandleEvent,
+			speeding.NewSqlStore(dataHandler.sqliteLogger, speeding.WithRedaction(dataHandler.privacy.RedactFix)).HandleEvent,
+		})
+		if err != nil {
+			return fmt.Errorf("creating speeding tracker: %w", err)
+		}
+		gnssDataHandlers = append(gnssDataHandlers, bus.GnssDataHandler(eventBus.NewSink("speeding", bus.PolicyBlock), tracker.HandleGnssData))
+	}
+
 	gnssEventFeed := gnss.NewGnssFeed(
-		[]gnss.GnssDataHandler{
-			dataHandler.HandlerGnssData,
-			//directionEventFeed.HandleGnssData,
-			eventServer.HandleGnssData,
-		},
-		nil,
+		gnssDataHandlers,
+		[]gnss.TimeHandler{clockSync.HandleGnssTime},
 		options...,
 	)
 
@@ -170,26 +320,23 @@ func logRun(cmd *cobra.Command, _ []string) error {
 		}
 	}()
 
-	mux := http.NewServeMux()
-	path, handler := eventsv1connect.NewEventServiceHandler(eventServer)
-
-	opts := cors.Options{
-		AllowedHeaders: []string{"*"},
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-	}
-	handler = cors.New(opts).Handler(handler)
-
-	mux.Handle(path, handler)
-
+	// the imu data waiting for the next fix and the logs not inserted yet are
+	// written on shutdown
 	go func() {
-		fmt.Printf("Starting GRPC server on %s ...\n", listenAddr)
-		err = http.ListenAndServe(listenAddr, h2c.NewHandler(mux, &http2.Server{}))
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		fmt.Println("Shutting down, flushing the logged data")
+		err := dataHandler.Flush()
 		if err != nil {
-			panic(fmt.Sprintf("running server: %s", err.Error()))
+			fmt.Printf("flushing data handler: %s\n", err)
 		}
+		dataHandler.sqliteLogger.Flush()
+		os.Exit(0)
 	}()
 
+	startConnectServer(listenAddr, eventServer, nil)
+
 	httpListenAddr := mustGetString(cmd, "http-listen-addr")
 
 	origins := handlers.AllowedOrigins([]string{"*"})
@@ -200,6 +347,10 @@ func logRun(cmd *cobra.Command, _ []string) error {
 	down := download.NewDownload(dataHandler.sqliteLogger)
 	router.HandleFunc("/rawData", down.GetRawData)
 	router.HandleFunc("/debug/download", down.GetDatabaseFiles)
+	router.HandleFunc("/odometer", odo.GetOdometer).Methods("GET")
+	router.HandleFunc("/odometer/trip/reset", odo.PostResetTrip).Methods("POST")
+	router.HandleFunc("/debug/bus", eventBus.GetStats).Methods("GET")
+	trip.NewHttpApi(tripStore, tripTracker, clockSync.Correct).Register(router)
 
 	err = http.ListenAndServe(httpListenAddr, handlers.CORS(origins, headers, methods)(router))
 	fmt.Printf("Starting http server on %s ...\n", httpListenAddr)
@@ -210,6 +361,29 @@ func logRun(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+func newIntegrityMonitor(cmd *cobra.Command, handlers []integrity.EventHandler) *integrity.Monitor {
+	return integrity.NewMonitor(
+		handlers,
+		integrity.WithJamIndThreshold(uint8(mustGetInt(cmd, "integrity-jam-ind-threshold"))),
+		integrity.WithMaxImpliedSpeed(mustGetFloat64(cmd, "integrity-max-implied-speed")),
+		integrity.WithMaxTimeJump(mustGetDuration(cmd, "integrity-max-time-jump")),
+	)
+}
+
+func newSpeedingTracker(cmd *cobra.Command, roadIndex *roads.Index, handlers []speeding.EventHandler) (*speeding.Tracker, error) {
+	speedLimits, err := speeding.ParseSpeedLimits(mustGetString(cmd, "speed-limits"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing speed limits: %w", err)
+	}
+
+	return speeding.NewTracker(
+		roadIndex,
+		handlers,
+		speeding.WithSpeedLimits(speedLimits),
+		speeding.WithTolerance(mustGetFloat64(cmd, "speeding-tolerance")),
+	), nil
+}
+
 func mustGnssEvent(e *neom9n.Data) *neom9n.Data {
 	if e == nil {
 		return &neom9n.Data{
@@ -256,6 +430,12 @@ func parseAxisMap(axisMapping string) (*iim42652.AxisMap, error) {
 	), nil
 }
 
+// yawAxis is the camera axis mapped to the real world z, the vertical, of a
+// valid axis mapping.
+func yawAxis(axisMapping string) string {
+	return strings.Split(strings.Split(axisMapping, ",")[2], ":")[1]
+}
+
 func parseInvertedMappings(invertedMapping string) (bool, bool, bool, error) {
 	if !strings.Contains(invertedMapping, ",") {
 		return false, false, false, fmt.Errorf("inverted mapping must contain ','")
@@ -56,6 +56,14 @@ func mustGetInt(cmd *cobra.Command, flagName string) int {
 	return val
 }
 
+func mustGetFloat64(cmd *cobra.Command, flagName string) float64 {
+	val, err := cmd.Flags().GetFloat64(flagName)
+	if err != nil {
+		panic(fmt.Sprintf("flags: couldn't find flag %q", flagName))
+	}
+	return val
+}
+
 func mustGetBool(cmd *cobra.Command, flagName string) bool {
 	val, err := cmd.Flags().GetBool(flagName)
 	if err != nil {
@@ -63,3 +71,11 @@ func mustGetBool(cmd *cobra.Command, flagName string) bool {
 	}
 	return val
 }
+
+func mustGetStringSlice(cmd *cobra.Command, flagName string) []string {
+	val, err := cmd.Flags().GetStringSlice(flagName)
+	if err != nil {
+		panic(fmt.Sprintf("flags: couldn't find flag %q", flagName))
+	}
+	return val
+}
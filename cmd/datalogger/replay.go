@@ -2,24 +2,30 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"strings"
 	"time"
 
 	geojson "github.com/paulmach/go.geojson"
-	"github.com/rosshemsley/kalman"
-	"github.com/rosshemsley/kalman/models"
 	"github.com/spf13/cobra"
 	"github.com/streamingfast/gnss-controller/device/neom9n"
 	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
 	"github.com/streamingfast/hivemapper-data-logger/data/direction"
 	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/integrity"
+	"github.com/streamingfast/hivemapper-data-logger/data/jsonfile"
+	"github.com/streamingfast/hivemapper-data-logger/data/mapmatch"
+	"github.com/streamingfast/hivemapper-data-logger/data/replay"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+	"github.com/streamingfast/hivemapper-data-logger/data/speeding"
 	"github.com/streamingfast/hivemapper-data-logger/data/sql"
 	"github.com/streamingfast/hivemapper-data-logger/logger"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/streamingfast/hivemapper-data-logger/webconnect"
 )
 
 var ReplayCmd = &cobra.Command{
@@ -41,11 +47,41 @@ func init() {
 	ReplayCmd.Flags().Duration("gnss-json-save-interval", 15*time.Second, "json save interval")
 
 	//DB
-	ReplayCmd.Flags().String("db-import-path", "gnss.v1.1.0.db", "path to sqliteLogger database")
+	ReplayCmd.Flags().String("db-import-path", "gnss.v1.3.0.db", "path to sqliteLogger database")
+	ReplayCmd.Flags().String("json-import-dir", "", "replay the json logger output instead of the database: folder holding the imu and gps json folders (ex: /mnt/data)")
+	ReplayCmd.Flags().Bool("raw-gnss", false, "replay the raw gnss positions of the database through the gnss quality gate and filter again, instead of the filtered positions")
+	ReplayCmd.Flags().Bool("smooth", false, "smooth the whole gnss track once replayed (forward Kalman filter and Rauch-Tung-Striebel backward pass), written to the gnss_smoothed table of the output db and to smoothed-locations.json. The raw positions are smoothed with raw-gnss")
 	ReplayCmd.Flags().String("db-output-path", "output.db", "path to sqliteLogger database")
 	ReplayCmd.Flags().Duration("db-log-ttl", 12*time.Hour, "ttl of logs in database")
 	ReplayCmd.Flags().BoolP("clean", "c", false, "purges output db where db-output-path is located before running replay command")
 
+	//Map matching
+	ReplayCmd.Flags().String("roads-file", "", "road network file (written by roads import, or GeoJSON ways) the gnss locations are map matched on, written to fixed-locations.json")
+	ReplayCmd.Flags().String("mongo-uri", "", "mongodb holding the road network points (geo.points), used instead of roads-file (ex: mongodb://localhost:27017)")
+
+	//Speeding
+	ReplayCmd.Flags().Bool("speeding", false, "compare the gnss speed with the speed limits of the roads of roads-file or mongo-uri, emitting SPEEDING_START and SPEEDING_END events")
+	ReplayCmd.Flags().String("speed-limits", "", "speed limits, in km/h, of the road classes applying when a way has no maxspeed, overriding the defaults (ex: residential=30,motorway=110)")
+	ReplayCmd.Flags().Float64("speeding-tolerance", 5, "by how many km/h the speed limit has to be exceeded to be speeding")
+
+	//GNSS integrity
+	ReplayCmd.Flags().Bool("integrity", false, "watch the gnss RF status and fixes consistency, emitting GNSS_JAMMING, GNSS_SPOOFING_SUSPECTED and ANTENNA_FAULT events")
+	ReplayCmd.Flags().Int("integrity-jam-ind-threshold", 200, "MON-RF jamming indicator, from 0 to 255, from which a GNSS_JAMMING event is emitted")
+	ReplayCmd.Flags().Float64("integrity-max-implied-speed", 100, "speed, in m/s, implied by two consecutive fixes over which the position jump is evidence of a GNSS_SPOOFING_SUSPECTED event")
+	ReplayCmd.Flags().Duration("integrity-max-time-jump", time.Second, "by how much the gnss time can move differently from the system time between two consecutive fixes before being evidence of a GNSS_SPOOFING_SUSPECTED event")
+
+	//Pacing
+	ReplayCmd.Flags().String("start-time", "", "only replay what was recorded after this time, RFC3339 or 2006-01-02 15:04:05 (UTC)")
+	ReplayCmd.Flags().String("end-time", "", "only replay what was recorded before this time, RFC3339 or 2006-01-02 15:04:05 (UTC)")
+	ReplayCmd.Flags().Float64("speed", 0, "replay pace relative to the recorded imu time, 1 is real time, 2 twice as fast, 0 as fast as possible")
+	ReplayCmd.Flags().Bool("paused", false, "start the replay paused until resumed through the replay connect service, requires listen-addr")
+	ReplayCmd.Flags().String("listen-addr", "", "address to serve the events and replay control connect services on, so the web ui can follow the replay. Disabled when empty")
+
+	//Report
+	ReplayCmd.Flags().String("report", "", "path of the json report of the replay run (event counts, durations, calibration timing, gnss statistics). No report when empty")
+	ReplayCmd.Flags().String("report-baseline", "", "path of a previous json report to compare the replay run with")
+	ReplayCmd.Flags().String("report-diff", "report-diff.json", "path of the json diff between the report and the report-baseline")
+
 	RootCmd.AddCommand(ReplayCmd)
 }
 
@@ -77,11 +113,26 @@ func replayE(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
-	sqliteImporter := logger.NewSqlite(mustGetString(cmd, "db-import-path"), nil, nil)
-	err = sqliteImporter.Init(0)
+	startTime, err := parseReplayTime(mustGetString(cmd, "start-time"))
+	if err != nil {
+		return fmt.Errorf("parsing start time: %w", err)
+	}
+	endTime, err := parseReplayTime(mustGetString(cmd, "end-time"))
 	if err != nil {
-		return fmt.Errorf("initializing sqlite logger database: %w", err)
+		return fmt.Errorf("parsing end time: %w", err)
+	}
+
+	listenAddr := mustGetString(cmd, "listen-addr")
+	paused := mustGetBool(cmd, "paused")
+	if paused && listenAddr == "" {
+		return fmt.Errorf("paused replay requires a listen-addr to be resumed")
+	}
+
+	speed := mustGetFloat64(cmd, "speed")
+	if speed < 0 {
+		return fmt.Errorf("invalid speed %f, must be positive or 0 for as fast as possible", speed)
 	}
+	controller := replay.NewController(startTime, endTime, speed, paused)
 
 	conf := imu.LoadConfig(mustGetString(cmd, "imu-config-file"))
 	fmt.Println("Config: ", conf.String())
@@ -100,39 +151,177 @@ func replayE(cmd *cobra.Command, _ []string) error {
 		mustGetDuration(cmd, "gnss-json-save-interval"),
 		mustGetString(cmd, "imu-json-destination-folder"),
 		mustGetDuration(cmd, "imu-json-save-interval"),
+		deadreckoning.NewEstimator(deadreckoning.WithYawAxis(yawAxis(mustGetString(cmd, "imu-axis-map")), invZ)),
 	)
 	if err != nil {
 		return fmt.Errorf("creating data handler: %w", err)
 	}
 
-	geoJsonHandler := NewGeoJsonHandler()
+	roadIndex, err := loadRoadIndex(mustGetString(cmd, "roads-file"), mustGetString(cmd, "mongo-uri"))
+	if err != nil {
+		return fmt.Errorf("loading road index: %w", err)
+	}
+	geoJsonHandler := NewGeoJsonHandler(roadIndex)
 
-	directionEventFeed := direction.NewDirectionEventFeed(conf,
+	directionEventHandlers := []direction.DirectionEventHandler{
 		dataHandler.HandleDirectionEvent,
 		geoJsonHandler.HandleDirectionEvent,
-	)
-	orientedEventFeed := imu.NewOrientedAccelerationFeed(
-		directionEventFeed.HandleOrientedAcceleration,
+	}
+	orientedAccelerationHandlers := []imu.OrientedAccelerationHandler{
 		dataHandler.HandleOrientedAcceleration,
+	}
+	var tiltCorrectedAccelerationHandlers []imu.TiltCorrectedAccelerationHandler
+	rawFeedHandlers := []imu.RawFeedHandler{
+		dataHandler.HandleRawImuFeed,
+	}
+	gnssDataHandlers := []gnss.GnssDataHandler{
+		dataHandler.HandlerGnssData,
+		geoJsonHandler.HandleGnss,
+	}
+
+	speedingEventHandlers := []speeding.EventHandler{
+		speeding.NewSqlStore(dataHandler.sqliteLogger).HandleEvent,
+	}
+	integrityEventHandlers := []integrity.EventHandler{
+		integrity.NewSqlStore(dataHandler.sqliteLogger).HandleEvent,
+	}
+
+	if listenAddr != "" {
+		eventServer := webconnect.NewEventServer()
+		directionEventHandlers = append(directionEventHandlers, eventServer.HandleDirectionEvent)
+		speedingEventHandlers = append(speedingEventHandlers, eventServer.SendEvent)
+		integrityEventHandlers = append(integrityEventHandlers, eventServer.SendEvent)
+		gnssDataHandlers = append(gnssDataHandlers, eventServer.HandleGnssData)
+		startConnectServer(listenAddr, eventServer, webconnect.NewReplayServer(controller))
+	}
+
+	reportPath := mustGetString(cmd, "report")
+	var reportHandler *ReportHandler
+	if reportPath != "" {
+		reportHandler = NewReportHandler()
+		directionEventHandlers = append(directionEventHandlers, reportHandler.HandleDirectionEvent)
+		speedingEventHandlers = append(speedingEventHandlers, reportHandler.HandleDirectionEvent)
+		integrityEventHandlers = append(integrityEventHandlers, reportHandler.HandleDirectionEvent)
+		orientedAccelerationHandlers = append(orientedAccelerationHandlers, reportHandler.HandleOrientedAcceleration)
+		tiltCorrectedAccelerationHandlers = append(tiltCorrectedAccelerationHandlers, reportHandler.HandleTiltCorrectedAcceleration)
+		rawFeedHandlers = append(rawFeedHandlers, reportHandler.HandleRawImuFeed)
+		gnssDataHandlers = append(gnssDataHandlers, reportHandler.HandleGnssData)
+	}
+
+	if mustGetBool(cmd, "speeding") {
+		if roadIndex == nil {
+			return fmt.Errorf("speeding requires a roads-file or a mongo-uri")
+		}
+		tracker, err := newSpeedingTracker(cmd, roadIndex, speedingEventHandlers)
+		if err != nil {
+			return fmt.Errorf("creating speeding tracker: %w", err)
+		}
+		gnssDataHandlers = append(gnssDataHandlers, tracker.HandleGnssData)
+	}
+
+	var integrityMonitor *integrity.Monitor
+	if mustGetBool(cmd, "integrity") {
+		integrityMonitor = newIntegrityMonitor(cmd, integrityEventHandlers)
+	}
+
+	directionEventFeed := direction.NewDirectionEventFeed(conf, directionEventHandlers...)
+	orientedEventFeed := imu.NewOrientedAccelerationFeed(
+		append([]imu.OrientedAccelerationHandler{directionEventFeed.HandleOrientedAcceleration}, orientedAccelerationHandlers...)...,
 	)
-	tiltCorrectedAccelerationEventFeed := imu.NewTiltCorrectedAccelerationFeed(orientedEventFeed.HandleTiltCorrectedAcceleration)
-
-	sqlFeed := sql.NewSqlImporterFeed(
-		sqliteImporter,
-		[]imu.RawFeedHandler{
-			tiltCorrectedAccelerationEventFeed.HandleRawFeed,
-			dataHandler.HandleRawImuFeed,
-		},
-		[]gnss.GnssDataHandler{
-			dataHandler.HandlerGnssData,
-			directionEventFeed.HandleGnssData,
-			geoJsonHandler.HandleGnss,
-		},
+	tiltCorrectedAccelerationEventFeed := imu.NewTiltCorrectedAccelerationFeed(
+		append([]imu.TiltCorrectedAccelerationHandler{orientedEventFeed.HandleTiltCorrectedAcceleration}, tiltCorrectedAccelerationHandlers...)...,
 	)
 
-	err = sqlFeed.Run(axisMap)
+	rawFeedHandlers = append([]imu.RawFeedHandler{tiltCorrectedAccelerationEventFeed.HandleRawFeed}, rawFeedHandlers...)
+	gnssDataHandlers = append(gnssDataHandlers, directionEventFeed.HandleGnssData)
+
+	rawGnss := mustGetBool(cmd, "raw-gnss")
+	if integrityMonitor != nil && !rawGnss {
+		gnssDataHandlers = append(gnssDataHandlers, integrityMonitor.HandleGnssData)
+	}
+	var smoother *gnss.Smoother
+	if mustGetBool(cmd, "smooth") {
+		smoother = gnss.NewSmoother()
+		if !rawGnss {
+			gnssDataHandlers = append(gnssDataHandlers, smoother.HandleGnssData)
+		}
+	}
+
+	if jsonImportDir := mustGetString(cmd, "json-import-dir"); jsonImportDir != "" {
+		jsonFeed := jsonfile.NewJsonImporterFeed(
+			path.Join(jsonImportDir, "imu"),
+			path.Join(jsonImportDir, "gps"),
+			rawFeedHandlers,
+			gnssDataHandlers,
+			jsonfile.WithTimeRange(startTime, endTime),
+			jsonfile.WithController(controller),
+		)
+
+		err = jsonFeed.Run()
+		if err != nil {
+			return fmt.Errorf("running json feed: %w", err)
+		}
+	} else {
+		options := []sql.Option{
+			sql.WithTimeRange(startTime, endTime),
+			sql.WithController(controller),
+		}
+		if rawGnss {
+			qualityHandlers := []gnss.QualityHandler{dataHandler.HandleGnssQuality}
+			if integrityMonitor != nil {
+				qualityHandlers = append(qualityHandlers, integrityMonitor.HandleGnssQuality)
+			}
+			if smoother != nil {
+				qualityHandlers = append(qualityHandlers, func(d *neom9n.Data, quality *gnss.Quality) error {
+					if quality.Verdict == gnss.VerdictRejected {
+						return nil
+					}
+					return smoother.HandleGnssData(d)
+				})
+			}
+			gnssFeed := gnss.NewGnssFeed(
+				gnssDataHandlers,
+				nil,
+				gnss.WithQualityHandlers(qualityHandlers...),
+				gnss.WithFilteredDataHandlers(dataHandler.HandleGnssFilteredData),
+			)
+			gnssDataHandlers = []gnss.GnssDataHandler{func(d *neom9n.Data) error {
+				gnssFeed.HandleData(d)
+				return nil
+			}}
+			options = append(options, sql.WithRawGnss())
+		}
+
+		sqlFeed := sql.NewSqlImporterFeed(
+			mustGetString(cmd, "db-import-path"),
+			rawFeedHandlers,
+			gnssDataHandlers,
+			options...,
+		)
+
+		err = sqlFeed.Run(axisMap)
+		if err != nil {
+			return fmt.Errorf("running sql feed: %w", err)
+		}
+	}
+
+	err = dataHandler.Flush()
 	if err != nil {
-		return fmt.Errorf("running sql feed: %w", err)
+		return fmt.Errorf("flushing data handler: %w", err)
+	}
+
+	if reportHandler != nil {
+		err := writeReplayReport(reportHandler.Report(), reportPath, mustGetString(cmd, "report-baseline"), mustGetString(cmd, "report-diff"))
+		if err != nil {
+			return fmt.Errorf("writing replay report: %w", err)
+		}
+	}
+
+	if smoother != nil {
+		err := writeSmoothedTrack(smoother.Smooth(), dataHandler.sqliteLogger)
+		if err != nil {
+			return fmt.Errorf("writing smoothed track: %w", err)
+		}
 	}
 
 	if len(geoJsonHandler.locationCollection.Features) > 0 {
@@ -147,6 +336,7 @@ func replayE(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
+	geoJsonHandler.Flush()
 	if len(geoJsonHandler.fixedLocationCollection.Features) > 0 {
 		fixedLocations, err := geoJsonHandler.fixedLocationCollection.MarshalJSON()
 		if err != nil {
@@ -162,95 +352,146 @@ func replayE(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
-type GeoJsonHandler struct {
-	geometry                *geojson.Geometry
-	fixGeometry             *geojson.Geometry
-	locationCollection      *geojson.FeatureCollection
-	fixedLocationCollection *geojson.FeatureCollection
-	initialized             bool
-
-	lonModel      *models.SimpleModel
-	lonFilter     *kalman.KalmanFilter
-	latModel      *models.SimpleModel
-	latFilter     *kalman.KalmanFilter
-	headingModel  *models.SimpleModel
-	headingFilter *kalman.KalmanFilter
-	//mongoClient   *mongo.Client
-	db              *mongo.Database
-	pointCollection *mongo.Collection
-}
+func writeSmoothedTrack(track []*gnss.GnssFilteredData, sqlite *logger.Sqlite) error {
+	err := gnss.WriteSmoothedTrack(sqlite, track)
+	if err != nil {
+		return fmt.Errorf("writing smoothed track to database: %w", err)
+	}
+
+	collection := geojson.NewFeatureCollection()
+	for _, s := range track {
+		feature := geojson.NewFeature(geojson.NewPointGeometry([]float64{s.Longitude, s.Latitude}))
+		feature.Type = "gnss"
+		feature.SetProperty("time", s.Time)
+		feature.SetProperty("speed", s.Speed)
+		feature.SetProperty("heading", s.Heading)
+		feature.SetProperty("horizontalAccuracy", s.HorizontalAccuracy)
+		collection.AddFeature(feature)
+	}
 
-func NewGeoJsonHandler() *GeoJsonHandler {
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	locations, err := collection.MarshalJSON()
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("marshalling smoothed locations: %w", err)
+	}
+	err = os.WriteFile("smoothed-locations.json", locations, 0644)
+	if err != nil {
+		return fmt.Errorf("writing smoothed locations: %w", err)
 	}
 
-	db := client.Database("geo")
-	pointCollection := db.Collection("points")
+	fmt.Printf("Smoothed %d gnss locations\n", len(track))
+	return nil
+}
 
-	return &GeoJsonHandler{
-		db:                      db,
-		pointCollection:         pointCollection,
-		locationCollection:      geojson.NewFeatureCollection(),
-		fixedLocationCollection: geojson.NewFeatureCollection(),
+// loadRoadIndex returns nil when neither a roads file nor a mongo uri is
+// given, the gnss locations are then not map matched.
+func loadRoadIndex(roadsFile string, mongoURI string) (*roads.Index, error) {
+	var ways []*roads.Way
+	switch {
+	case roadsFile != "" && mongoURI != "":
+		return nil, fmt.Errorf("roads-file and mongo-uri are mutually exclusive")
+	case roadsFile != "":
+		var err error
+		ways, err = roads.Load(roadsFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading roads file: %w", err)
+		}
+	case mongoURI != "":
+		store, err := roads.NewMongoStore(context.Background(), mongoURI)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to mongo: %w", err)
+		}
+		ways, err = store.Ways(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("loading ways from mongo: %w", err)
+		}
+	default:
+		return nil, nil
 	}
+
+	fmt.Printf("Loaded %d ways\n", len(ways))
+	return roads.NewIndex(ways), nil
 }
 
-func (h *GeoJsonHandler) init(now time.Time) {
-	h.initialized = true
-
-	h.lonModel = models.NewSimpleModel(now, 0.0, models.SimpleModelConfig{
-		InitialVariance:     0.0,
-		ProcessVariance:     2.0,
-		ObservationVariance: 2.0,
-	})
-	h.lonFilter = kalman.NewKalmanFilter(h.lonModel)
-
-	h.latModel = models.NewSimpleModel(now, 0.0, models.SimpleModelConfig{
-		InitialVariance:     0.0,
-		ProcessVariance:     2.0,
-		ObservationVariance: 2.0,
-	})
-	h.latFilter = kalman.NewKalmanFilter(h.latModel)
-
-	h.headingModel = models.NewSimpleModel(now, 0.0, models.SimpleModelConfig{
-		InitialVariance:     0.0,
-		ProcessVariance:     2.0,
-		ObservationVariance: 2.0,
-	})
-	h.headingFilter = kalman.NewKalmanFilter(h.headingModel)
+func parseReplayTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expecting RFC3339 or 2006-01-02 15:04:05", value)
+	}
+	return t, nil
 }
 
-func (h *GeoJsonHandler) Update(lon, lat, heading float64, now time.Time) (float64, float64, float64, error) {
-	err := h.lonFilter.Update(now, h.lonModel.NewMeasurement(lon))
+func writeReplayReport(report *ReplayReport, reportPath string, baselinePath string, diffPath string) error {
+	err := report.Write(reportPath)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("updating lon filter: %w", err)
+		return fmt.Errorf("writing report: %w", err)
 	}
-	newLon := h.lonModel.Value(h.lonFilter.State())
+	fmt.Println("Report written to", reportPath)
 
-	err = h.latFilter.Update(now, h.latModel.NewMeasurement(lat))
+	if baselinePath == "" {
+		return nil
+	}
+
+	baseline, err := LoadReplayReport(baselinePath)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("updating lat filter: %w", err)
+		return fmt.Errorf("loading baseline report: %w", err)
 	}
-	newLat := h.latModel.Value(h.latFilter.State())
 
-	err = h.headingFilter.Update(now, h.headingModel.NewMeasurement(heading))
+	diff := DiffReports(baseline, report)
+	content, err := json.MarshalIndent(diff, "", "  ")
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("updating heading filter: %w", err)
+		return fmt.Errorf("marshalling report diff: %w", err)
+	}
+
+	err = os.WriteFile(diffPath, content, 0644)
+	if err != nil {
+		return fmt.Errorf("writing report diff %q: %w", diffPath, err)
+	}
+
+	changes := diff.Changes()
+	fmt.Printf("%d changes from baseline %s, diff written to %s\n", len(changes), baselinePath, diffPath)
+	for _, change := range changes {
+		fmt.Println("  ", change)
 	}
 
-	return newLon, newLat, heading, nil
+	return nil
+}
+
+type GeoJsonHandler struct {
+	geometry                *geojson.Geometry
+	locationCollection      *geojson.FeatureCollection
+	fixedLocationCollection *geojson.FeatureCollection
+
+	matcher   *mapmatch.Matcher
+	fixEvents map[*mapmatch.Fix]string
+}
+
+// NewGeoJsonHandler map matches the gnss locations on roadIndex, nil
+// disabling map matching.
+func NewGeoJsonHandler(roadIndex *roads.Index) *GeoJsonHandler {
+	h := &GeoJsonHandler{
+		locationCollection:      geojson.NewFeatureCollection(),
+		fixedLocationCollection: geojson.NewFeatureCollection(),
+		fixEvents:               map[*mapmatch.Fix]string{},
+	}
+	if roadIndex != nil {
+		h.matcher = mapmatch.NewMatcher(roadIndex)
+	}
+	return h
 }
 
 var lastGnssTime = time.Time{}
 var lastEvent = ""
 
 func (h *GeoJsonHandler) HandleGnss(data *neom9n.Data) error {
-	if !h.initialized {
-		h.init(data.Timestamp)
-	}
-
 	if data.Fix == "none" {
 		return nil
 	}
@@ -269,32 +510,43 @@ func (h *GeoJsonHandler) HandleGnss(data *neom9n.Data) error {
 		feature.SetProperty("headingAccuracy", data.HeadingAccuracy)
 		h.locationCollection.AddFeature(feature)
 
-		//fixing localtion
-		nLon, nLat, _, w1, w2, err := h.magic(data.Longitude, data.Latitude, data.Heading, data.Timestamp)
-		if err != nil {
-			return fmt.Errorf("magic: %w", err)
+		if h.matcher == nil {
+			return nil
 		}
-		//fmt.Println("magic", nLon, nLat)
 
-		h.fixGeometry = geojson.NewPointGeometry([]float64{nLon, nLat})
-		lastGnssTime = data.Timestamp
-		feature = geojson.NewFeature(h.fixGeometry)
-		feature.Type = "gnss"
-		feature.SetProperty("event", lastEvent)
-		feature.SetProperty("origin", []float64{data.Longitude, data.Latitude})
-		if w1 != nil {
-			feature.SetProperty("w1", []float64{w1.Lon, w1.Lat})
+		fix := &mapmatch.Fix{
+			Lon:      data.Longitude,
+			Lat:      data.Latitude,
+			Time:     data.Timestamp,
+			Accuracy: data.HorizontalAccuracy,
 		}
-		if w2 != nil {
-			feature.SetProperty("w2", []float64{w2.Lon, w2.Lat})
-		}
-
-		h.fixedLocationCollection.AddFeature(feature)
+		h.fixEvents[fix] = lastEvent
+		h.addMatches(h.matcher.Add(fix))
 	}
 
 	return nil
 }
 
+// Flush adds the locations still pending in the map matching window.
+func (h *GeoJsonHandler) Flush() {
+	if h.matcher != nil {
+		h.addMatches(h.matcher.Flush())
+	}
+}
+
+func (h *GeoJsonHandler) addMatches(matches []*mapmatch.Match) {
+	for _, match := range matches {
+		feature := geojson.NewFeature(geojson.NewPointGeometry([]float64{match.Lon, match.Lat}))
+		feature.Type = "gnss"
+		feature.SetProperty("event", h.fixEvents[match.Fix])
+		feature.SetProperty("origin", []float64{match.Fix.Lon, match.Fix.Lat})
+		feature.SetProperty("wayID", match.WayID)
+		feature.SetProperty("confidence", match.Confidence)
+		h.fixedLocationCollection.AddFeature(feature)
+		delete(h.fixEvents, match.Fix)
+	}
+}
+
 func (h *GeoJsonHandler) HandleDirectionEvent(e data.Event) error {
 	if e.GetGnssData().Fix == "none" {
 		return nil
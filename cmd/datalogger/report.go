@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/direction"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+)
+
+type ReplayReport struct {
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	DistanceKm  float64                `json:"distance_km"`
+	Events      map[string]*EventStats `json:"events"`
+	Calibration *CalibrationStats      `json:"calibration"`
+	Gnss        *GnssStats             `json:"gnss"`
+}
+
+type EventStats struct {
+	Count         int           `json:"count"`
+	TotalDuration time.Duration `json:"total_duration"`
+	MeanDuration  time.Duration `json:"mean_duration"`
+	MaxDuration   time.Duration `json:"max_duration"`
+	RatePerKm     float64       `json:"rate_per_km"`
+}
+
+type CalibrationStats struct {
+	// TiltCalibratedAfter is the time between the first imu sample and the
+	// first tilt corrected acceleration, 0 if never calibrated.
+	TiltCalibratedAfter time.Duration `json:"tilt_calibrated_after"`
+	// OrientationLockedAfter is the time between the first imu sample and the
+	// first oriented acceleration, 0 if the orientation was never found.
+	OrientationLockedAfter time.Duration   `json:"orientation_locked_after"`
+	Orientation            imu.Orientation `json:"orientation"`
+}
+
+type GnssStats struct {
+	Epochs                 int            `json:"epochs"`
+	FixCounts              map[string]int `json:"fix_counts"`
+	TimeToFirstFix         time.Duration  `json:"time_to_first_fix"`
+	MeanHorizontalAccuracy float64        `json:"mean_horizontal_accuracy"`
+	MaxHorizontalAccuracy  float64        `json:"max_horizontal_accuracy"`
+	MeanSatellitesUsed     float64        `json:"mean_satellites_used"`
+}
+
+func LoadReplayReport(filename string) (*ReplayReport, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading report %q: %w", filename, err)
+	}
+
+	report := &ReplayReport{}
+	err = json.Unmarshal(content, report)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling report %q: %w", filename, err)
+	}
+	return report, nil
+}
+
+func (r *ReplayReport) Write(filename string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling report: %w", err)
+	}
+
+	err = os.WriteFile(filename, content, 0644)
+	if err != nil {
+		return fmt.Errorf("writing report %q: %w", filename, err)
+	}
+	return nil
+}
+
+// ReportHandler gathers the statistics of a replay run. It is plugged at every
+// stage of the pipeline: the tilt corrected and oriented feeds only call their
+// handlers once calibrated, which gives the calibration timing.
+type ReportHandler struct {
+	firstImuTime      time.Time
+	lastImuTime       time.Time
+	tiltCalibratedAt  time.Time
+	orientedAt        time.Time
+	orientation       imu.Orientation
+	firstGnssTime     time.Time
+	firstFixTime      time.Time
+	lastFix           *geo.Coordinate
+	distance          float64
+	events            map[string]*EventStats
+	fixCounts         map[string]int
+	gnssEpochs        int
+	fixEpochs         int
+	horizontalAccSum  float64
+	horizontalAccMax  float64
+	satellitesUsedSum int
+}
+
+func NewReportHandler() *ReportHandler {
+	return &ReportHandler{
+		events:    map[string]*EventStats{},
+		fixCounts: map[string]int{},
+	}
+}
+
+func (h *ReportHandler) HandleRawImuFeed(acceleration *imu.Acceleration, _ *iim42652.AngularRate, _ iim42652.Temperature) error {
+	if h.firstImuTime.IsZero() {
+		h.firstImuTime = acceleration.Time
+	}
+	h.lastImuTime = acceleration.Time
+	return nil
+}
+
+func (h *ReportHandler) HandleTiltCorrectedAcceleration(acceleration *imu.Acceleration, _ *imu.TiltAngles, _ iim42652.Temperature) error {
+	if h.tiltCalibratedAt.IsZero() {
+		h.tiltCalibratedAt = acceleration.Time
+	}
+	return nil
+}
+
+func (h *ReportHandler) HandleOrientedAcceleration(acceleration *imu.Acceleration, _ *imu.TiltAngles, _ iim42652.Temperature, orientation imu.Orientation) error {
+	if h.orientedAt.IsZero() {
+		h.orientedAt = acceleration.Time
+	}
+	h.orientation = orientation
+	return nil
+}
+
+func (h *ReportHandler) HandleGnssData(d *neom9n.Data) error {
+	h.gnssEpochs++
+	h.fixCounts[d.Fix]++
+	if h.firstGnssTime.IsZero() {
+		h.firstGnssTime = d.SystemTime
+	}
+
+	if d.Fix == "none" {
+		return nil
+	}
+
+	if h.firstFixTime.IsZero() {
+		h.firstFixTime = d.SystemTime
+	}
+
+	h.fixEpochs++
+	h.horizontalAccSum += d.HorizontalAccuracy
+	if d.HorizontalAccuracy > h.horizontalAccMax {
+		h.horizontalAccMax = d.HorizontalAccuracy
+	}
+	if d.Satellites != nil {
+		h.satellitesUsedSum += d.Satellites.Used
+	}
+
+	c := geo.NewCoordinate(d.Longitude, d.Latitude)
+	if h.lastFix != nil {
+		h.distance += geo.Distance(h.lastFix, c)
+	}
+	h.lastFix = c
+
+	return nil
+}
+
+func (h *ReportHandler) HandleDirectionEvent(event data.Event) error {
+	if strings.Contains(event.GetName(), "DETECTED") {
+		return nil
+	}
+
+	stats, found := h.events[event.GetName()]
+	if !found {
+		stats = &EventStats{}
+		h.events[event.GetName()] = stats
+	}
+
+	duration := direction.Duration(event)
+	stats.Count++
+	stats.TotalDuration += duration
+	if duration > stats.MaxDuration {
+		stats.MaxDuration = duration
+	}
+	return nil
+}
+
+func (h *ReportHandler) Report() *ReplayReport {
+	report := &ReplayReport{
+		Start:      h.firstImuTime,
+		End:        h.lastImuTime,
+		DistanceKm: h.distance / 1000,
+		Events:     map[string]*EventStats{},
+		Calibration: &CalibrationStats{
+			Orientation: h.orientation,
+		},
+		Gnss: &GnssStats{
+			Epochs:                h.gnssEpochs,
+			FixCounts:             h.fixCounts,
+			MaxHorizontalAccuracy: h.horizontalAccMax,
+		},
+	}
+
+	for name, stats := range h.events {
+		s := *stats
+		s.MeanDuration = s.TotalDuration / time.Duration(s.Count)
+		if report.DistanceKm > 0 {
+			s.RatePerKm = float64(s.Count) / report.DistanceKm
+		}
+		report.Events[name] = &s
+	}
+
+	if !h.tiltCalibratedAt.IsZero() {
+		report.Calibration.TiltCalibratedAfter = h.tiltCalibratedAt.Sub(h.firstImuTime)
+	}
+	if !h.orientedAt.IsZero() {
+		report.Calibration.OrientationLockedAfter = h.orientedAt.Sub(h.firstImuTime)
+	}
+
+	if !h.firstFixTime.IsZero() {
+		report.Gnss.TimeToFirstFix = h.firstFixTime.Sub(h.firstGnssTime)
+	}
+	if h.fixEpochs > 0 {
+		report.Gnss.MeanHorizontalAccuracy = h.horizontalAccSum / float64(h.fixEpochs)
+		report.Gnss.MeanSatellitesUsed = float64(h.satellitesUsedSum) / float64(h.fixEpochs)
+	}
+
+	return report
+}
+
+type ReportDiff struct {
+	DistanceKm  *FloatDiff            `json:"distance_km"`
+	Events      map[string]*EventDiff `json:"events"`
+	Calibration *CalibrationDiff      `json:"calibration,omitempty"`
+	Gnss        *GnssDiff             `json:"gnss,omitempty"`
+	// Missing are the sections a report doesn't have, as "baseline gnss",
+	// which are not diffed.
+	Missing []string `json:"missing,omitempty"`
+}
+
+type FloatDiff struct {
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+}
+
+func newFloatDiff(baseline, current float64) *FloatDiff {
+	return &FloatDiff{Baseline: baseline, Current: current, Delta: current - baseline}
+}
+
+type DurationDiff struct {
+	Baseline time.Duration `json:"baseline"`
+	Current  time.Duration `json:"current"`
+	Delta    time.Duration `json:"delta"`
+}
+
+func newDurationDiff(baseline, current time.Duration) *DurationDiff {
+	return &DurationDiff{Baseline: baseline, Current: current, Delta: current - baseline}
+}
+
+type EventDiff struct {
+	Count        *FloatDiff    `json:"count"`
+	MeanDuration *DurationDiff `json:"mean_duration"`
+	RatePerKm    *FloatDiff    `json:"rate_per_km"`
+}
+
+type CalibrationDiff struct {
+	TiltCalibratedAfter    *DurationDiff `json:"tilt_calibrated_after"`
+	OrientationLockedAfter *DurationDiff `json:"orientation_locked_after"`
+	BaselineOrientation    string        `json:"baseline_orientation"`
+	CurrentOrientation     string        `json:"current_orientation"`
+}
+
+type GnssDiff struct {
+	Epochs                 *FloatDiff            `json:"epochs"`
+	FixCounts              map[string]*FloatDiff `json:"fix_counts"`
+	TimeToFirstFix         *DurationDiff         `json:"time_to_first_fix"`
+	MeanHorizontalAccuracy *FloatDiff            `json:"mean_horizontal_accuracy"`
+	MeanSatellitesUsed     *FloatDiff            `json:"mean_satellites_used"`
+}
+
+// DiffReports diffs current with baseline, the baseline being a report file
+// which can be partial or from an older version. Only the sections both reports
+// have are diffed, the others being listed in Missing.
+func DiffReports(baseline, current *ReplayReport) *ReportDiff {
+	diff := &ReportDiff{
+		DistanceKm: newFloatDiff(baseline.DistanceKm, current.DistanceKm),
+		Events:     map[string]*EventDiff{},
+	}
+	for _, report := range []struct {
+		name   string
+		report *ReplayReport
+	}{{"baseline", baseline}, {"current", current}} {
+		if report.report.Calibration == nil {
+			diff.Missing = append(diff.Missing, report.name+" calibration")
+		}
+		if report.report.Gnss == nil {
+			diff.Missing = append(diff.Missing, report.name+" gnss")
+		}
+	}
+
+	if baseline.Calibration != nil && current.Calibration != nil {
+		diff.Calibration = &CalibrationDiff{
+			TiltCalibratedAfter:    newDurationDiff(baseline.Calibration.TiltCalibratedAfter, current.Calibration.TiltCalibratedAfter),
+			OrientationLockedAfter: newDurationDiff(baseline.Calibration.OrientationLockedAfter, current.Calibration.OrientationLockedAfter),
+			BaselineOrientation:    string(baseline.Calibration.Orientation),
+			CurrentOrientation:     string(current.Calibration.Orientation),
+		}
+	}
+
+	if baseline.Gnss != nil && current.Gnss != nil {
+		diff.Gnss = &GnssDiff{
+			Epochs:                 newFloatDiff(float64(baseline.Gnss.Epochs), float64(current.Gnss.Epochs)),
+			FixCounts:              map[string]*FloatDiff{},
+			TimeToFirstFix:         newDurationDiff(baseline.Gnss.TimeToFirstFix, current.Gnss.TimeToFirstFix),
+			MeanHorizontalAccuracy: newFloatDiff(baseline.Gnss.MeanHorizontalAccuracy, current.Gnss.MeanHorizontalAccuracy),
+			MeanSatellitesUsed:     newFloatDiff(baseline.Gnss.MeanSatellitesUsed, current.Gnss.MeanSatellitesUsed),
+		}
+		for _, fix := range unionKeys(baseline.Gnss.FixCounts, current.Gnss.FixCounts) {
+			diff.Gnss.FixCounts[fix] = newFloatDiff(float64(baseline.Gnss.FixCounts[fix]), float64(current.Gnss.FixCounts[fix]))
+		}
+	}
+
+	for _, name := range unionKeys(baseline.Events, current.Events) {
+		b := baseline.Events[name]
+		if b == nil {
+			b = &EventStats{}
+		}
+		c := current.Events[name]
+		if c == nil {
+			c = &EventStats{}
+		}
+		diff.Events[name] = &EventDiff{
+			Count:        newFloatDiff(float64(b.Count), float64(c.Count)),
+			MeanDuration: newDurationDiff(b.MeanDuration, c.MeanDuration),
+			RatePerKm:    newFloatDiff(b.RatePerKm, c.RatePerKm),
+		}
+	}
+
+	return diff
+}
+
+// Changes lists, in a human readable form, the values that differ from the baseline.
+func (d *ReportDiff) Changes() []string {
+	var changes []string
+	if d.DistanceKm.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("distance: %.3f km -> %.3f km", d.DistanceKm.Baseline, d.DistanceKm.Current))
+	}
+
+	var names []string
+	for name := range d.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := d.Events[name]
+		if e.Count.Delta != 0 {
+			changes = append(changes, fmt.Sprintf("%s count: %.0f -> %.0f", name, e.Count.Baseline, e.Count.Current))
+		}
+		if e.MeanDuration.Delta != 0 {
+			changes = append(changes, fmt.Sprintf("%s mean duration: %s -> %s", name, e.MeanDuration.Baseline, e.MeanDuration.Current))
+		}
+	}
+
+	for _, missing := range d.Missing {
+		changes = append(changes, fmt.Sprintf("%s: missing, not diffed", missing))
+	}
+
+	if d.Calibration != nil {
+		changes = append(changes, d.Calibration.changes()...)
+	}
+	if d.Gnss != nil {
+		changes = append(changes, d.Gnss.changes()...)
+	}
+
+	return changes
+}
+
+func (d *CalibrationDiff) changes() []string {
+	var changes []string
+	if d.TiltCalibratedAfter.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("tilt calibrated after: %s -> %s", d.TiltCalibratedAfter.Baseline, d.TiltCalibratedAfter.Current))
+	}
+	if d.OrientationLockedAfter.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("orientation locked after: %s -> %s", d.OrientationLockedAfter.Baseline, d.OrientationLockedAfter.Current))
+	}
+	if d.BaselineOrientation != d.CurrentOrientation {
+		changes = append(changes, fmt.Sprintf("orientation: %q -> %q", d.BaselineOrientation, d.CurrentOrientation))
+	}
+
+	return changes
+}
+
+func (d *GnssDiff) changes() []string {
+	var changes []string
+	if d.Epochs.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("gnss epochs: %.0f -> %.0f", d.Epochs.Baseline, d.Epochs.Current))
+	}
+	var fixes []string
+	for fix := range d.FixCounts {
+		fixes = append(fixes, fix)
+	}
+	sort.Strings(fixes)
+	for _, fix := range fixes {
+		if c := d.FixCounts[fix]; c.Delta != 0 {
+			changes = append(changes, fmt.Sprintf("gnss %s fixes: %.0f -> %.0f", fix, c.Baseline, c.Current))
+		}
+	}
+	if d.TimeToFirstFix.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("gnss time to first fix: %s -> %s", d.TimeToFirstFix.Baseline, d.TimeToFirstFix.Current))
+	}
+	if d.MeanHorizontalAccuracy.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("gnss mean horizontal accuracy: %.3f -> %.3f", d.MeanHorizontalAccuracy.Baseline, d.MeanHorizontalAccuracy.Current))
+	}
+	if d.MeanSatellitesUsed.Delta != 0 {
+		changes = append(changes, fmt.Sprintf("gnss mean satellites used: %.1f -> %.1f", d.MeanSatellitesUsed.Baseline, d.MeanSatellitesUsed.Current))
+	}
+
+	return changes
+}
+
+func unionKeys[T any](a, b map[string]T) []string {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	var out []string
+	for k := range keys {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
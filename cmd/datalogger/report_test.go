@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffReports(t *testing.T) {
+	baseline := &ReplayReport{
+		DistanceKm: 10,
+		Events: map[string]*EventStats{
+			"LEFT_TURN_EVENT": {Count: 4, MeanDuration: 3 * time.Second, RatePerKm: 0.4},
+			"STOP_END_EVENT":  {Count: 2, MeanDuration: 20 * time.Second, RatePerKm: 0.2},
+		},
+		Calibration: &CalibrationStats{TiltCalibratedAfter: 2 * time.Second, Orientation: imu.OrientationFront},
+		Gnss:        &GnssStats{Epochs: 100, FixCounts: map[string]int{"3D": 100}, MeanSatellitesUsed: 12},
+	}
+	current := &ReplayReport{
+		DistanceKm: 10,
+		Events: map[string]*EventStats{
+			"LEFT_TURN_EVENT":  {Count: 5, MeanDuration: 3 * time.Second, RatePerKm: 0.5},
+			"RIGHT_TURN_EVENT": {Count: 1, MeanDuration: time.Second, RatePerKm: 0.1},
+		},
+		Calibration: &CalibrationStats{TiltCalibratedAfter: 2 * time.Second, Orientation: imu.OrientationFront},
+		Gnss:        &GnssStats{Epochs: 100, FixCounts: map[string]int{"3D": 90, "2D": 10}, MeanSatellitesUsed: 10.5},
+	}
+
+	diff := DiffReports(baseline, current)
+	require.Len(t, diff.Events, 3)
+	require.Equal(t, 1.0, diff.Events["LEFT_TURN_EVENT"].Count.Delta)
+	require.Equal(t, -2.0, diff.Events["STOP_END_EVENT"].Count.Delta)
+	require.Equal(t, 1.0, diff.Events["RIGHT_TURN_EVENT"].Count.Delta)
+	require.Equal(t, -10.0, diff.Gnss.FixCounts["3D"].Delta)
+	require.Equal(t, 10.0, diff.Gnss.FixCounts["2D"].Delta)
+
+	require.Equal(t, []string{
+		"LEFT_TURN_EVENT count: 4 -> 5",
+		"RIGHT_TURN_EVENT count: 0 -> 1",
+		"RIGHT_TURN_EVENT mean duration: 0s -> 1s",
+		"STOP_END_EVENT count: 2 -> 0",
+		"STOP_END_EVENT mean duration: 20s -> 0s",
+		"gnss 2D fixes: 0 -> 10",
+		"gnss 3D fixes: 100 -> 90",
+		"gnss mean satellites used: 12.0 -> 10.5",
+	}, diff.Changes())
+}
+
+func TestDiffReportsPartialBaseline(t *testing.T) {
+	current := &ReplayReport{
+		DistanceKm:  12,
+		Calibration: &CalibrationStats{Orientation: imu.OrientationFront},
+		Gnss:        &GnssStats{Epochs: 120},
+	}
+
+	tests := []struct {
+		name     string
+		baseline string
+		missing  []string
+		changes  []string
+	}{
+		{
+			name:     "no calibration",
+			baseline: `{"distance_km": 10, "gnss": {"epochs": 100}}`,
+			missing:  []string{"baseline calibration"},
+			changes:  []string{"distance: 10.000 km -> 12.000 km", "baseline calibration: missing, not diffed", "gnss epochs: 100 -> 120"},
+		},
+		{
+			name:     "no gnss",
+			baseline: `{"distance_km": 10, "calibration": {"orientation": "OrientationFront"}}`,
+			missing:  []string{"baseline gnss"},
+			changes:  []string{"distance: 10.000 km -> 12.000 km", "baseline gnss: missing, not diffed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baselinePath := path.Join(t.TempDir(), "baseline.json")
+			require.NoError(t, os.WriteFile(baselinePath, []byte(test.baseline), 0644))
+			baseline, err := LoadReplayReport(baselinePath)
+			require.NoError(t, err)
+
+			diff := DiffReports(baseline, current)
+			require.Equal(t, test.missing, diff.Missing)
+			require.Equal(t, test.changes, diff.Changes())
+		})
+	}
+}
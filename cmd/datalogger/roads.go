@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+)
+
+var RoadsCmd = &cobra.Command{
+	Use:   "roads",
+	Short: "Manage the local road network used for map matching",
+}
+
+var RoadsImportCmd = &cobra.Command{
+	Use:   "import <file.osm.pbf|file.osm>",
+	Short: "Extract the drivable ways of an OpenStreetMap file to a road network file",
+	Args:  cobra.ExactArgs(1),
+	RunE:  roadsImportE,
+}
+
+func init() {
+	RoadsImportCmd.Flags().String("bbox", "", "only keep the ways with a node in minLon,minLat,maxLon,maxLat, ex: -73.70,45.40,-73.40,45.70. Everything when empty")
+	RoadsImportCmd.Flags().String("output", "roads.bin", "road network file to write, to use as replay --roads-file")
+
+	RoadsCmd.AddCommand(RoadsImportCmd)
+	RootCmd.AddCommand(RoadsCmd)
+}
+
+func roadsImportE(cmd *cobra.Command, args []string) error {
+	bbox, err := roads.ParseBoundingBox(mustGetString(cmd, "bbox"))
+	if err != nil {
+		return fmt.Errorf("parsing bbox: %w", err)
+	}
+
+	ways, err := roads.ImportOsm(args[0], bbox)
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", args[0], err)
+	}
+
+	points := 0
+	classes := map[string]int{}
+	for _, way := range ways {
+		points += len(way.Points)
+		classes[way.Class]++
+	}
+	fmt.Printf("Imported %d ways and %d points\n", len(ways), points)
+	for class, count := range classes {
+		fmt.Printf("  %s: %d\n", class, count)
+	}
+
+	output := mustGetString(cmd, "output")
+	err = roads.WriteFile(output, ways)
+	if err != nil {
+		return fmt.Errorf("writing road network: %w", err)
+	}
+	fmt.Println("Road network written to", output)
+
+	return nil
+}
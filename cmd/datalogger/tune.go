@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/hivemapper-data-logger/data/direction"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/sql"
+	"github.com/streamingfast/hivemapper-data-logger/data/tuning"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+)
+
+var TuneCmd = &cobra.Command{
+	Use:   "tune",
+	Short: "Search the imu config thresholds that best detect the labelled events of recorded drives",
+	RunE:  tuneE,
+}
+
+func init() {
+	TuneCmd.Flags().StringSlice("db-import-paths", []string{"gnss.v1.3.0.db"}, "paths to the sqliteLogger databases of the recorded drives")
+	TuneCmd.Flags().String("labels-file", "labels.json", "json file of the ground-truth events: [{\"name\":\"LEFT_TURN_EVENT\",\"start\":\"...\",\"end\":\"...\"}]")
+	TuneCmd.Flags().String("grid-file", "", "json file mapping imu config fields to the values to try, ex: {\"left_turn_threshold\":[0.15,0.2]}. Default grid varies the g-force thresholds by +/- 25%")
+	TuneCmd.Flags().Duration("match-tolerance", 2*time.Second, "time tolerance when matching a detected event with a label")
+	TuneCmd.Flags().String("imu-config-file", "imu-logger.json", "base imu logger config file")
+	TuneCmd.Flags().String("output-config-file", "imu-logger.json", "where to write the best imu logger config")
+	TuneCmd.Flags().String("imu-axis-map", "CamX:Z,CamY:X,CamZ:Y", "axis mapping of camera x,y,z values to real world x,y,z values. Default value are HDC mappings")
+	TuneCmd.Flags().String("imu-inverted", "X:false,Y:false,Z:false", "axis inverted mapping of x,y,z values")
+
+	RootCmd.AddCommand(TuneCmd)
+}
+
+func tuneE(cmd *cobra.Command, _ []string) error {
+	axisMap, err := parseAxisMap(mustGetString(cmd, "imu-axis-map"))
+	if err != nil {
+		return fmt.Errorf("parsing axis map: %w", err)
+	}
+
+	invX, invY, invZ, err := parseInvertedMappings(mustGetString(cmd, "imu-inverted"))
+	if err != nil {
+		return fmt.Errorf("parsing inverted mappings: %w", err)
+	}
+
+	axisMap.SetInvertedAxes(invX, invY, invZ)
+
+	labels, err := tuning.LoadLabels(mustGetString(cmd, "labels-file"))
+	if err != nil {
+		return fmt.Errorf("loading labels: %w", err)
+	}
+	fmt.Printf("Loaded %d labels\n", len(labels))
+
+	baseConf := imu.LoadConfig(mustGetString(cmd, "imu-config-file"))
+
+	grid := tuning.DefaultGrid(baseConf)
+	if gridFile := mustGetString(cmd, "grid-file"); gridFile != "" {
+		grid, err = tuning.LoadGrid(gridFile)
+		if err != nil {
+			return fmt.Errorf("loading grid: %w", err)
+		}
+	}
+
+	configs, err := grid.Configs(baseConf)
+	if err != nil {
+		return fmt.Errorf("building configs from grid: %w", err)
+	}
+	fmt.Printf("Evaluating %d configs\n", len(configs))
+
+	dbPaths := mustGetStringSlice(cmd, "db-import-paths")
+	tolerance := mustGetDuration(cmd, "match-tolerance")
+
+	var bestConf *imu.Config
+	var bestScores []*tuning.Score
+	bestF1 := -1.0
+	for i, conf := range configs {
+		collector := tuning.NewEventCollector()
+		for _, dbPath := range dbPaths {
+			err := runDirectionPipeline(dbPath, axisMap, conf, collector)
+			if err != nil {
+				return fmt.Errorf("running direction pipeline: %w", err)
+			}
+		}
+
+		scores := tuning.Evaluate(labels, collector.Events, tolerance)
+		f1 := tuning.MeanF1(scores)
+		fmt.Printf("config %d/%d: mean f1 %.3f\n", i+1, len(configs), f1)
+
+		if f1 > bestF1 {
+			bestF1 = f1
+			bestConf = conf
+			bestScores = scores
+		}
+	}
+
+	if bestConf == nil {
+		return fmt.Errorf("no config evaluated")
+	}
+
+	fmt.Println("Best config:", bestConf.String())
+	for _, score := range bestScores {
+		fmt.Println(score.String())
+	}
+	fmt.Printf("mean f1: %.3f\n", bestF1)
+
+	outputConfigFile := mustGetString(cmd, "output-config-file")
+	err = os.WriteFile(outputConfigFile, []byte(bestConf.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("writing best config: %w", err)
+	}
+	fmt.Println("Best config written to", outputConfigFile)
+
+	return nil
+}
+
+func runDirectionPipeline(dbPath string, axisMap *iim42652.AxisMap, conf *imu.Config, collector *tuning.EventCollector) error {
+	directionEventFeed := direction.NewDirectionEventFeed(conf, collector.HandleDirectionEvent)
+	orientedEventFeed := imu.NewOrientedAccelerationFeed(directionEventFeed.HandleOrientedAcceleration)
+	tiltCorrectedAccelerationEventFeed := imu.NewTiltCorrectedAccelerationFeed(orientedEventFeed.HandleTiltCorrectedAcceleration)
+
+	sqlFeed := sql.NewSqlImporterFeed(
+		dbPath,
+		[]imu.RawFeedHandler{tiltCorrectedAccelerationEventFeed.HandleRawFeed},
+		[]gnss.GnssDataHandler{directionEventFeed.HandleGnssData},
+	)
+
+	return sqlFeed.Run(axisMap)
+}
@@ -0,0 +1,191 @@
+package align
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+)
+
+// Aligned is the gnss position, speed and heading at the time of a sample,
+// interpolated between the fixes around it, or held from the last fix.
+type Aligned struct {
+	Latitude  float64
+	Longitude float64
+	Speed     float64
+	Heading   float64
+	// FixAge is the time since the last fix before the sample.
+	FixAge       time.Duration
+	Interpolated bool
+}
+
+// Sample is aligned on the gnss fixes at its time, in the system clock like
+// the fixes SystemTime.
+type Sample interface {
+	SampleTime() time.Time
+	Align(aligned *Aligned)
+}
+
+type SampleHandler func(s Sample) error
+
+type Option func(*Aligner)
+
+// WithLookAhead sets how long a sample waits for the next fix to be
+// interpolated, before being held from the last fix.
+func WithLookAhead(lookAhead time.Duration) Option {
+	return func(a *Aligner) {
+		a.lookAhead = lookAhead
+	}
+}
+
+// WithMaxGap sets the time between two fixes over which the samples between
+// them are held from the first instead of being interpolated.
+func WithMaxGap(gap time.Duration) Option {
+	return func(a *Aligner) {
+		a.maxGap = gap
+	}
+}
+
+// Aligner buffers the samples until the fix following them is received, the
+// look-ahead, to interpolate the gnss position, speed and heading at their
+// time. The samples are passed to the handlers in order, aligned, the ones
+// before the first fix with a nil Aligned. The fixes are expected in the
+// system time order.
+type Aligner struct {
+	lock sync.Mutex
+
+	handlers  []SampleHandler
+	lookAhead time.Duration
+	maxGap    time.Duration
+
+	last    *neom9n.Data
+	pending []Sample
+}
+
+func NewAligner(handlers []SampleHandler, opts ...Option) *Aligner {
+	a := &Aligner{
+		handlers:  handlers,
+		lookAhead: 250 * time.Millisecond,
+		maxGap:    2 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Aligner) HandleGnssData(d *neom9n.Data) error {
+	if d.Fix != "2D" && d.Fix != "3D" {
+		return nil
+	}
+
+	a.lock.Lock()
+	var ready []Sample
+	for len(a.pending) > 0 && !a.pending[0].SampleTime().After(d.SystemTime) {
+		s := a.pending[0]
+		s.Align(a.interpolate(d, s.SampleTime()))
+		ready = append(ready, s)
+		a.pending = a.pending[1:]
+	}
+	if a.last == nil || d.SystemTime.After(a.last.SystemTime) {
+		a.last = d
+	}
+	a.lock.Unlock()
+
+	return a.emit(ready)
+}
+
+// AddSample buffers s, passing the samples which waited longer than the
+// look-ahead to the handlers, held from the last fix.
+func (a *Aligner) AddSample(s Sample) error {
+	a.lock.Lock()
+	a.pending = append(a.pending, s)
+	var ready []Sample
+	for len(a.pending) > 0 && s.SampleTime().Sub(a.pending[0].SampleTime()) >= a.lookAhead {
+		ready = append(ready, a.hold(a.pending[0]))
+		a.pending = a.pending[1:]
+	}
+	a.lock.Unlock()
+
+	return a.emit(ready)
+}
+
+// Flush passes all the buffered samples to the handlers, held from the last
+// fix.
+func (a *Aligner) Flush() error {
+	a.lock.Lock()
+	var ready []Sample
+	for _, s := range a.pending {
+		ready = append(ready, a.hold(s))
+	}
+	a.pending = nil
+	a.lock.Unlock()
+
+	return a.emit(ready)
+}
+
+func (a *Aligner) emit(samples []Sample) error {
+	for _, s := range samples {
+		for _, handler := range a.handlers {
+			err := handler(s)
+			if err != nil {
+				return fmt.Errorf("handling aligned sample: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Aligner) hold(s Sample) Sample {
+	if a.last == nil {
+		s.Align(nil)
+		return s
+	}
+	s.Align(held(a.last, s.SampleTime()))
+	return s
+}
+
+// interpolate aligns t, at or before next, between the last fix and next. It
+// is nil before the first fix.
+func (a *Aligner) interpolate(next *neom9n.Data, t time.Time) *Aligned {
+	previous := a.last
+	if previous == nil {
+		return nil
+	}
+
+	gap := next.SystemTime.Sub(previous.SystemTime)
+	if gap <= 0 || gap > a.maxGap || t.Before(previous.SystemTime) {
+		return held(previous, t)
+	}
+
+	ratio := float64(t.Sub(previous.SystemTime)) / float64(gap)
+	return &Aligned{
+		Latitude:     previous.Latitude + (next.Latitude-previous.Latitude)*ratio,
+		Longitude:    previous.Longitude + (next.Longitude-previous.Longitude)*ratio,
+		Speed:        previous.Speed + (next.Speed-previous.Speed)*ratio,
+		Heading:      interpolateHeading(previous.Heading, next.Heading, ratio),
+		FixAge:       t.Sub(previous.SystemTime),
+		Interpolated: true,
+	}
+}
+
+func held(d *neom9n.Data, t time.Time) *Aligned {
+	return &Aligned{
+		Latitude:  d.Latitude,
+		Longitude: d.Longitude,
+		Speed:     d.Speed,
+		Heading:   d.Heading,
+		FixAge:    t.Sub(d.SystemTime),
+	}
+}
+
+// interpolateHeading goes the shortest way around from one heading to the
+// other, in degrees clockwise from the north.
+func interpolateHeading(from float64, to float64, ratio float64) float64 {
+	delta := math.Mod(to-from+540, 360) - 180
+	return math.Mod(from+delta*ratio+360, 360)
+}
@@ -0,0 +1,112 @@
+package align
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func at(milliseconds int) time.Time {
+	return start.Add(time.Duration(milliseconds) * time.Millisecond)
+}
+
+func fix(milliseconds int, longitude float64, speed float64, heading float64) *neom9n.Data {
+	return &neom9n.Data{
+		SystemTime: at(milliseconds),
+		Fix:        "3D",
+		Latitude:   45.575,
+		Longitude:  longitude,
+		Speed:      speed,
+		Heading:    heading,
+	}
+}
+
+type sample struct {
+	time    time.Time
+	aligned *Aligned
+}
+
+func (s *sample) SampleTime() time.Time {
+	return s.time
+}
+
+func (s *sample) Align(aligned *Aligned) {
+	s.aligned = aligned
+}
+
+func TestAligner(t *testing.T) {
+	var handled []*sample
+	a := NewAligner([]SampleHandler{func(s Sample) error {
+		handled = append(handled, s.(*sample))
+		return nil
+	}})
+
+	before := &sample{time: at(-25)}
+	require.NoError(t, a.AddSample(before))
+	require.NoError(t, a.HandleGnssData(fix(0, -73.44, 10, 350)))
+	require.Equal(t, []*sample{before}, handled)
+	require.Nil(t, before.aligned, "no fix before the first one")
+
+	first := &sample{time: at(25)}
+	second := &sample{time: at(75)}
+	require.NoError(t, a.AddSample(first))
+	require.NoError(t, a.AddSample(second))
+	require.Len(t, handled, 1, "waiting for the next fix")
+
+	require.NoError(t, a.HandleGnssData(fix(100, -73.439, 12, 10)))
+	require.Len(t, handled, 3)
+	require.True(t, first.aligned.Interpolated)
+	require.InDelta(t, -73.43975, first.aligned.Longitude, 1e-9)
+	require.InDelta(t, 10.5, first.aligned.Speed, 1e-9)
+	require.InDelta(t, 355, first.aligned.Heading, 1e-9)
+	require.Equal(t, 25*time.Millisecond, first.aligned.FixAge)
+	require.InDelta(t, -73.43925, second.aligned.Longitude, 1e-9)
+	require.InDelta(t, 5, second.aligned.Heading, 1e-9)
+	require.Equal(t, 75*time.Millisecond, second.aligned.FixAge)
+
+	// no fix within the look-ahead, held from the last one
+	lost := &sample{time: at(125)}
+	require.NoError(t, a.AddSample(lost))
+	require.NoError(t, a.AddSample(&sample{time: at(375)}))
+	require.Len(t, handled, 4)
+	require.False(t, lost.aligned.Interpolated)
+	require.Equal(t, -73.439, lost.aligned.Longitude)
+	require.Equal(t, 25*time.Millisecond, lost.aligned.FixAge)
+
+	// fixes too far apart are not interpolated between
+	require.NoError(t, a.HandleGnssData(fix(3000, -73.43, 12, 10)))
+	require.Len(t, handled, 5)
+	require.False(t, handled[4].aligned.Interpolated)
+	require.Equal(t, -73.439, handled[4].aligned.Longitude)
+
+	last := &sample{time: at(3025)}
+	require.NoError(t, a.AddSample(last))
+	require.NoError(t, a.Flush())
+	require.Len(t, handled, 6)
+	require.Equal(t, -73.43, last.aligned.Longitude)
+}
+
+func TestInterpolateHeading(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     float64
+		to       float64
+		ratio    float64
+		expected float64
+	}{
+		{name: "clockwise", from: 10, to: 50, ratio: 0.5, expected: 30},
+		{name: "counter clockwise", from: 50, to: 10, ratio: 0.25, expected: 40},
+		{name: "across the north", from: 350, to: 30, ratio: 0.5, expected: 10},
+		{name: "across the north counter clockwise", from: 20, to: 340, ratio: 0.75, expected: 350},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.InDelta(t, tt.expected, interpolateHeading(tt.from, tt.to, tt.ratio), 1e-9)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Bus fans the sensor data out to sinks, so that a slow consumer, like a
+// sqlite flush or a json write, doesn't stall the sampling of the sensors.
+// Each sink has its own bounded queue and goroutine, and drops events
+// according to its policy when the consumer can't keep up.
+type Bus struct {
+	lock     sync.Mutex
+	sinks    []*Sink
+	size     int
+	policies map[string]Policy
+}
+
+type Option func(*Bus)
+
+// WithQueueSize sets the number of calls each sink queues before applying its
+// drop policy.
+func WithQueueSize(size int) Option {
+	return func(b *Bus) {
+		b.size = size
+	}
+}
+
+// WithPolicies overrides the drop policy of the named sinks.
+func WithPolicies(policies map[string]Policy) Option {
+	return func(b *Bus) {
+		b.policies = policies
+	}
+}
+
+func NewBus(opts ...Option) *Bus {
+	b := &Bus{
+		size:     1000,
+		policies: map[string]Policy{},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// NewSink starts a sink with the given policy, unless overridden for its name.
+func (b *Bus) NewSink(name string, policy Policy) *Sink {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if p, found := b.policies[name]; found {
+		policy = p
+	}
+	s := newSink(name, b.size, policy)
+	b.sinks = append(b.sinks, s)
+	return s
+}
+
+func (b *Bus) Stats() []*Stats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var stats []*Stats
+	for _, s := range b.sinks {
+		stats = append(stats, s.Stats())
+	}
+	return stats
+}
+
+// Close waits for all the sinks to handle their queued calls.
+func (b *Bus) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, s := range b.sinks {
+		s.Close()
+	}
+}
+
+func (b *Bus) GetStats(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(b.Stats())
+	if err != nil {
+		fmt.Fprintf(w, "error: %s", err)
+	}
+}
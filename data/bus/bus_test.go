@@ -0,0 +1,157 @@
+package bus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/daedaleanai/ublox/ubx"
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		expected []int
+		dropped  uint64
+	}{
+		{
+			name:     "drop oldest",
+			policy:   PolicyDropOldest,
+			expected: []int{3, 4, 5},
+			dropped:  2,
+		},
+		{
+			name:     "drop newest",
+			policy:   PolicyDropNewest,
+			expected: []int{1, 2, 3},
+			dropped:  2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := NewQueue[int](3, test.policy)
+			for i := 1; i <= 5; i++ {
+				q.Push(i)
+			}
+			q.Close()
+
+			var values []int
+			for v := range q.C() {
+				values = append(values, v)
+			}
+			require.Equal(t, test.expected, values)
+			require.Equal(t, test.dropped, q.Dropped())
+		})
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	q := NewQueue[int](1, PolicyBlock)
+	q.Push(1)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(2)
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push did not block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.Equal(t, 1, <-q.C())
+	<-pushed
+	require.Equal(t, 2, <-q.C())
+	require.Equal(t, uint64(0), q.Dropped())
+}
+
+func TestSink(t *testing.T) {
+	b := NewBus(WithQueueSize(2), WithPolicies(map[string]Policy{"slow": PolicyDropNewest}))
+
+	release := make(chan struct{})
+	var handled []int
+	slow := b.NewSink("slow", PolicyBlock)
+	for i := 1; i <= 5; i++ {
+		i := i
+		slow.Send(func() error {
+			<-release
+			handled = append(handled, i)
+			if i == 2 {
+				return fmt.Errorf("failing %d", i)
+			}
+			return nil
+		})
+		// let the sink pick the first call, the next ones being queued
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	b.Close()
+
+	require.Equal(t, []int{1, 2, 3}, handled)
+	require.Equal(t, []*Stats{{Name: "slow", Policy: PolicyDropNewest, Size: 2, Handled: 3, Dropped: 2, Failed: 1}}, b.Stats())
+}
+
+func TestGnssHandlers(t *testing.T) {
+	handlers := map[string]func(s *Sink, handler gnss.GnssDataHandler) gnss.GnssDataHandler{
+		"gnss data": GnssDataHandler,
+		"quality": func(s *Sink, handler gnss.GnssDataHandler) gnss.GnssDataHandler {
+			h := QualityHandler(s, func(d *neom9n.Data, _ *gnss.Quality) error { return handler(d) })
+			return func(d *neom9n.Data) error { return h(d, &gnss.Quality{}) }
+		},
+		"filtered data": func(s *Sink, handler gnss.GnssDataHandler) gnss.GnssDataHandler {
+			h := FilteredDataHandler(s, func(d *neom9n.Data, _ *gnss.GnssFilteredData) error { return handler(d) })
+			return func(d *neom9n.Data) error { return h(d, &gnss.GnssFilteredData{}) }
+		},
+	}
+
+	for name, newHandler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			b := NewBus()
+			var handled []string
+			handler := newHandler(b.NewSink("data", PolicyBlock), func(d *neom9n.Data) error {
+				handled = append(handled, fmt.Sprintf("%.1f %.1f %d %d %d %d", d.Latitude, d.Dop.HDop, d.Satellites.Used, d.RF.JamInd, d.RxmMeasx.GpsTOW_ms, d.RxmMeasx.SV[0].CNo))
+				return nil
+			})
+
+			// d is updated while the sink handles the previous fixes
+			d := &neom9n.Data{
+				Dop:        &neom9n.Dop{},
+				Satellites: &neom9n.Satellites{},
+				RF:         &neom9n.RF{},
+				RxmMeasx:   &ubx.RxmMeasx{SV: []*ubx.RxmMeasxSVType{{}}},
+			}
+			for i := 1; i <= 3; i++ {
+				d.Latitude = float64(i)
+				d.Dop.HDop = float64(i)
+				d.Satellites.Used = i
+				d.RF.JamInd = uint8(i)
+				d.RxmMeasx.GpsTOW_ms = uint32(i)
+				d.RxmMeasx.SV[0].CNo = byte(i)
+				require.NoError(t, handler(d))
+			}
+			b.Close()
+
+			require.Equal(t, []string{"1.0 1.0 1 1 1 1", "2.0 2.0 2 2 2 2", "3.0 3.0 3 3 3 3"}, handled)
+		})
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("data=drop-oldest, events = drop-newest")
+	require.NoError(t, err)
+	require.Equal(t, map[string]Policy{"data": PolicyDropOldest, "events": PolicyDropNewest}, policies)
+
+	_, err = ParsePolicies("data=drop-all")
+	require.EqualError(t, err, `sink "data": unknown drop policy "drop-all", expected block, drop-oldest or drop-newest`)
+
+	_, err = ParsePolicies("data")
+	require.Error(t, err)
+}
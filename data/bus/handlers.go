@@ -0,0 +1,95 @@
+package bus
+
+import (
+	"github.com/daedaleanai/ublox/ubx"
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+)
+
+// The handlers below queue the calls of a feed handler to a sink, returning
+// right away. The handler errors are printed by the sink.
+
+func RawFeedHandler(s *Sink, handler imu.RawFeedHandler) imu.RawFeedHandler {
+	return func(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, temperature iim42652.Temperature) error {
+		s.Send(func() error {
+			return handler(acceleration, angularRate, temperature)
+		})
+		return nil
+	}
+}
+
+// The gnss handlers get a copy of the fix, the gnss data feed updating the
+// same data, and what it points to, from one fix to the next. The handlers
+// behind a sink can then keep the fix they get, like the previous fix.
+
+func GnssDataHandler(s *Sink, handler gnss.GnssDataHandler) gnss.GnssDataHandler {
+	return func(d *neom9n.Data) error {
+		c := copyData(d)
+		s.Send(func() error {
+			return handler(c)
+		})
+		return nil
+	}
+}
+
+func QualityHandler(s *Sink, handler gnss.QualityHandler) gnss.QualityHandler {
+	return func(d *neom9n.Data, quality *gnss.Quality) error {
+		c := copyData(d)
+		s.Send(func() error {
+			return handler(c, quality)
+		})
+		return nil
+	}
+}
+
+func FilteredDataHandler(s *Sink, handler gnss.FilteredDataHandler) gnss.FilteredDataHandler {
+	return func(d *neom9n.Data, filtered *gnss.GnssFilteredData) error {
+		c := copyData(d)
+		s.Send(func() error {
+			return handler(c, filtered)
+		})
+		return nil
+	}
+}
+
+func copyData(d *neom9n.Data) *neom9n.Data {
+	c := *d
+	if d.Dop != nil {
+		dop := *d.Dop
+		c.Dop = &dop
+	}
+	if d.Satellites != nil {
+		satellites := *d.Satellites
+		c.Satellites = &satellites
+	}
+	if d.RF != nil {
+		rf := *d.RF
+		c.RF = &rf
+	}
+	if d.RxmMeasx != nil {
+		measx := *d.RxmMeasx
+		measx.SV = make([]*ubx.RxmMeasxSVType, len(d.RxmMeasx.SV))
+		for i, sv := range d.RxmMeasx.SV {
+			if sv != nil {
+				satellite := *sv
+				measx.SV[i] = &satellite
+			}
+		}
+		c.RxmMeasx = &measx
+	}
+	return &c
+}
+
+// EventHandler is assignable to the event handlers of all the feeds, like
+// direction.DirectionEventHandler.
+func EventHandler(s *Sink, handler func(event data.Event) error) func(event data.Event) error {
+	return func(event data.Event) error {
+		s.Send(func() error {
+			return handler(event)
+		})
+		return nil
+	}
+}
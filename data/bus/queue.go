@@ -0,0 +1,116 @@
+package bus
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy is what a full queue does with a pushed value.
+type Policy string
+
+const (
+	// PolicyBlock waits for room in the queue, stalling the pusher.
+	PolicyBlock Policy = "block"
+	// PolicyDropOldest drops the oldest queued value to make room.
+	PolicyDropOldest Policy = "drop-oldest"
+	// PolicyDropNewest drops the pushed value.
+	PolicyDropNewest Policy = "drop-newest"
+)
+
+func ParsePolicy(value string) (Policy, error) {
+	switch p := Policy(value); p {
+	case PolicyBlock, PolicyDropOldest, PolicyDropNewest:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown drop policy %q, expected %s, %s or %s", value, PolicyBlock, PolicyDropOldest, PolicyDropNewest)
+}
+
+// ParsePolicies parses the policies of named sinks, as "name=policy,...".
+func ParsePolicies(value string) (map[string]Policy, error) {
+	policies := map[string]Policy{}
+	if value == "" {
+		return policies, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		name, policy, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid sink policy %q, expected name=policy", entry)
+		}
+		p, err := ParsePolicy(strings.TrimSpace(policy))
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: %w", name, err)
+		}
+		policies[strings.TrimSpace(name)] = p
+	}
+	return policies, nil
+}
+
+// Queue is a bounded queue applying its policy when full, counting the
+// values it drops.
+type Queue[T any] struct {
+	lock    sync.Mutex // serializes the drop-oldest pushes
+	policy  Policy
+	items   chan T
+	dropped atomic.Uint64
+}
+
+func NewQueue[T any](size int, policy Policy) *Queue[T] {
+	return &Queue[T]{
+		policy: policy,
+		items:  make(chan T, size),
+	}
+}
+
+// Push queues v, telling if a value was dropped for it, or v itself.
+func (q *Queue[T]) Push(v T) (dropped bool) {
+	switch q.policy {
+	case PolicyDropNewest:
+		select {
+		case q.items <- v:
+			return false
+		default:
+			q.dropped.Add(1)
+			return true
+		}
+	case PolicyDropOldest:
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		for {
+			select {
+			case q.items <- v:
+				return dropped
+			default:
+			}
+			select {
+			case <-q.items:
+				q.dropped.Add(1)
+				dropped = true
+			default:
+			}
+		}
+	default:
+		q.items <- v
+		return false
+	}
+}
+
+// C receives the queued values, until the queue is closed and drained.
+func (q *Queue[T]) C() <-chan T {
+	return q.items
+}
+
+// Close stops the queue, no value being pushed anymore.
+func (q *Queue[T]) Close() {
+	close(q.items)
+}
+
+func (q *Queue[T]) Len() int {
+	return len(q.items)
+}
+
+func (q *Queue[T]) Dropped() uint64 {
+	return q.dropped.Load()
+}
@@ -0,0 +1,81 @@
+package bus
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Sink calls the handlers of a consumer in its own goroutine, through a
+// bounded queue. The handlers of a sink are called in the order they were
+// sent, so that the handlers of a consumer sharing state can share a sink.
+type Sink struct {
+	name    string
+	size    int
+	policy  Policy
+	queue   *Queue[func() error]
+	handled atomic.Uint64
+	failed  atomic.Uint64
+	done    chan struct{}
+}
+
+func newSink(name string, size int, policy Policy) *Sink {
+	s := &Sink{
+		name:   name,
+		size:   size,
+		policy: policy,
+		queue:  NewQueue[func() error](size, policy),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	for call := range s.queue.C() {
+		// the handler errors can't go back to the feed anymore
+		if err := call(); err != nil {
+			s.failed.Add(1)
+			fmt.Printf("sink %s: %s\n", s.name, err)
+		}
+		s.handled.Add(1)
+	}
+}
+
+// Send queues a handler call, applying the drop policy of the sink when full.
+func (s *Sink) Send(call func() error) {
+	s.queue.Push(call)
+}
+
+// Close waits for the queued calls to be handled, nothing being sent to the
+// sink anymore.
+func (s *Sink) Close() {
+	s.queue.Close()
+	<-s.done
+}
+
+func (s *Sink) Stats() *Stats {
+	return &Stats{
+		Name:    s.name,
+		Policy:  s.policy,
+		Size:    s.size,
+		Queued:  s.queue.Len(),
+		Handled: s.handled.Load(),
+		Dropped: s.queue.Dropped(),
+		Failed:  s.failed.Load(),
+	}
+}
+
+type Stats struct {
+	Name    string `json:"name"`
+	Policy  Policy `json:"policy"`
+	Size    int    `json:"size"`
+	Queued  int    `json:"queued"`
+	Handled uint64 `json:"handled"`
+	Dropped uint64 `json:"dropped"`
+	Failed  uint64 `json:"failed"`
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%s (%s): %d/%d queued, %d handled, %d dropped, %d failed", s.Name, s.Policy, s.Queued, s.Size, s.Handled, s.Dropped, s.Failed)
+}
@@ -0,0 +1,59 @@
+package clock
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS clock_offsets (
+		id INTEGER NOT NULL PRIMARY KEY,
+		time TIMESTAMP NOT NULL,
+		system_time TIMESTAMP NOT NULL,
+		clock_offset REAL NOT NULL,
+		measured_offset REAL NOT NULL,
+		source TEXT NOT NULL
+	);
+	create index if not exists clock_offsets_time_idx on clock_offsets(time);
+`
+
+const insertQuery string = `
+	INSERT INTO clock_offsets VALUES(NULL,?,?,?,?,?);
+`
+
+const purgeQuery string = `
+	DELETE FROM clock_offsets WHERE time < ?;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+func PurgeQuery() string {
+	return purgeQuery
+}
+
+// SqlStore writes the offsets, in seconds, as they are saved, them being
+// rare.
+type SqlStore struct {
+	sqlite *logger.Sqlite
+}
+
+func NewSqlStore(sqlite *logger.Sqlite) *SqlStore {
+	return &SqlStore{sqlite: sqlite}
+}
+
+func (s *SqlStore) SaveOffset(o *Offset) error {
+	err := s.sqlite.Exec(insertQuery,
+		o.Time.Format("2006-01-02 15:04:05.99999"),
+		o.SystemTime.Format("2006-01-02 15:04:05.99999"),
+		o.Offset.Seconds(),
+		o.Measured.Seconds(),
+		o.Source,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting clock offset: %w", err)
+	}
+	return nil
+}
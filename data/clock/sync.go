@@ -0,0 +1,197 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+)
+
+const (
+	// SourceTimeValid is the offset measured when the gnss time becomes valid.
+	SourceTimeValid = "time_valid"
+	// SourceFix is the offset measured from the time of a fix.
+	SourceFix = "fix"
+)
+
+// Offset is a measure of the gnss time minus the system time.
+type Offset struct {
+	Time       time.Time // gnss time
+	SystemTime time.Time
+	// Offset is the smoothed offset, Measured the offset of this measure.
+	Offset   time.Duration
+	Measured time.Duration
+	Source   string
+}
+
+type EventHandler func(event data.Event) error
+
+// Store keeps the measured offsets.
+type Store interface {
+	SaveOffset(offset *Offset) error
+}
+
+type Option func(*Sync)
+
+// WithDriftThreshold sets by how much the offset has to move, from the last
+// one reported, to emit a DriftEvent. A measure further than that from the
+// smoothed offset is a clock jump, taken as is.
+func WithDriftThreshold(threshold time.Duration) Option {
+	return func(s *Sync) {
+		s.driftThreshold = threshold
+	}
+}
+
+// WithStore saves the offset every persistInterval, and on each drift.
+func WithStore(store Store, persistInterval time.Duration) Option {
+	return func(s *Sync) {
+		s.store = store
+		s.persistInterval = persistInterval
+	}
+}
+
+// smoothing is the weight of a new measure in the smoothed offset, the time
+// of a fix being stamped with the system time on reception, after a serial
+// latency varying by tens of milliseconds.
+const smoothing = 0.1
+
+// Sync measures the offset of the system clock from the gnss time, from the
+// gnss time becoming valid and from the time of every fix. The system times,
+// the imu ones included, are corrected with it. A DriftEvent is emitted when
+// the offset moves by more than the drift threshold: a wrong system clock at
+// boot, or it being stepped later.
+type Sync struct {
+	lock sync.Mutex
+
+	handlers        []EventHandler
+	driftThreshold  time.Duration
+	store           Store
+	persistInterval time.Duration
+	now             func() time.Time
+
+	synced        bool
+	offset        time.Duration
+	reported      time.Duration
+	lastPersisted time.Time
+}
+
+func NewSync(handlers []EventHandler, opts ...Option) *Sync {
+	s := &Sync{
+		handlers:       handlers,
+		driftThreshold: time.Second,
+		now:            time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// HandleGnssTime is the gnss.TimeHandler called when the gnss time becomes
+// valid.
+func (s *Sync) HandleGnssTime(now time.Time) error {
+	return s.measure(now, s.now(), SourceTimeValid, nil)
+}
+
+func (s *Sync) HandleGnssData(d *neom9n.Data) error {
+	if (d.Fix != "2D" && d.Fix != "3D") || d.Timestamp.IsZero() || d.SystemTime.IsZero() {
+		return nil
+	}
+	return s.measure(d.Timestamp, d.SystemTime, SourceFix, d)
+}
+
+func (s *Sync) measure(gnssTime time.Time, systemTime time.Time, source string, d *neom9n.Data) error {
+	measured := gnssTime.Sub(systemTime)
+
+	s.lock.Lock()
+	jumped := !s.synced || absDuration(measured-s.offset) > s.driftThreshold
+	if jumped {
+		s.offset = measured
+	} else {
+		s.offset += time.Duration(smoothing * float64(measured-s.offset))
+	}
+	s.synced = true
+
+	offset := &Offset{Time: gnssTime, SystemTime: systemTime, Offset: s.offset, Measured: measured, Source: source}
+	var event *DriftEvent
+	if absDuration(s.offset-s.reported) > s.driftThreshold {
+		event = NewDriftEvent(s.offset, s.reported, gnssTime, d)
+		s.reported = s.offset
+	}
+	persist := s.store != nil && (jumped || event != nil || gnssTime.Sub(s.lastPersisted) >= s.persistInterval)
+	if persist {
+		s.lastPersisted = gnssTime
+	}
+	s.lock.Unlock()
+
+	if persist {
+		err := s.store.SaveOffset(offset)
+		if err != nil {
+			return fmt.Errorf("saving clock offset: %w", err)
+		}
+	}
+
+	if event != nil {
+		for _, handler := range s.handlers {
+			err := handler(event)
+			if err != nil {
+				return fmt.Errorf("handling clock drift event: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Synced tells if the offset was measured.
+func (s *Sync) Synced() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.synced
+}
+
+// Offset is the gnss time minus the system time, 0 until measured.
+func (s *Sync) Offset() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.offset
+}
+
+// Correct converts a system time to the gnss time.
+func (s *Sync) Correct(systemTime time.Time) time.Time {
+	return systemTime.Add(s.Offset())
+}
+
+// Now is the current gnss time, the system time until the offset is measured.
+func (s *Sync) Now() time.Time {
+	return s.Correct(s.now())
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+type DriftEvent struct {
+	*data.BaseEvent
+	Offset         float64 `json:"offset"`          // seconds, gnss time minus system time
+	PreviousOffset float64 `json:"previous_offset"` // seconds, last reported
+}
+
+func NewDriftEvent(offset time.Duration, previous time.Duration, t time.Time, gnssData *neom9n.Data) *DriftEvent {
+	return &DriftEvent{
+		BaseEvent:      data.NewBaseEvent("CLOCK_DRIFT", "CLOCK", t, gnssData),
+		Offset:         math.Round(offset.Seconds()*1000) / 1000,
+		PreviousOffset: math.Round(previous.Seconds()*1000) / 1000,
+	}
+}
+
+func (e *DriftEvent) String() string {
+	return fmt.Sprintf("Clock Drift Event offset %.3fs from %.3fs", e.Offset, e.PreviousOffset)
+}
@@ -0,0 +1,136 @@
+package clock
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	offsets []*Offset
+}
+
+func (s *memoryStore) SaveOffset(o *Offset) error {
+	s.offsets = append(s.offsets, o)
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	boot := time.Date(2023, 9, 8, 6, 40, 0, 0, time.UTC)
+	firstSecond := boot.Add(time.Second)
+	secondSecond := boot.Add(2 * time.Second)
+	thirdSecond := boot.Add(3 * time.Second)
+	afterSaving := boot.Add(70 * time.Second)
+
+	tests := []struct {
+		name           string
+		fixes          []*neom9n.Data
+		expectedOffset time.Duration
+		expectedEvents []string
+		expectedSaved  int
+	}{
+		{
+			name: "system clock in sync",
+			fixes: []*neom9n.Data{
+				{SystemTime: boot, Timestamp: boot.Add(100 * time.Millisecond), Fix: "3D"},
+				{SystemTime: firstSecond, Timestamp: firstSecond.Add(200 * time.Millisecond), Fix: "3D"},
+				{SystemTime: secondSecond, Timestamp: secondSecond.Add(100 * time.Millisecond), Fix: "3D"},
+				{SystemTime: afterSaving, Timestamp: afterSaving.Add(100 * time.Millisecond), Fix: "3D"},
+			},
+			expectedOffset: 108100 * time.Microsecond,
+			expectedSaved:  2,
+		},
+		{
+			name: "system clock wrong at boot",
+			fixes: []*neom9n.Data{
+				{SystemTime: boot, Timestamp: boot.Add(-time.Hour), Fix: "3D"},
+				{SystemTime: firstSecond, Timestamp: firstSecond.Add(-time.Hour), Fix: "3D"},
+			},
+			expectedOffset: -time.Hour,
+			expectedEvents: []string{"Clock Drift Event offset -3600.000s from 0.000s"},
+			expectedSaved:  1,
+		},
+		{
+			name: "system clock stepped",
+			fixes: []*neom9n.Data{
+				{SystemTime: boot, Timestamp: boot, Fix: "3D"},
+				{SystemTime: firstSecond, Timestamp: firstSecond, Fix: "3D"},
+				{SystemTime: secondSecond, Timestamp: secondSecond.Add(5 * time.Second), Fix: "3D"},
+				{SystemTime: thirdSecond, Timestamp: thirdSecond.Add(5 * time.Second), Fix: "3D"},
+			},
+			expectedOffset: 5 * time.Second,
+			expectedEvents: []string{"Clock Drift Event offset 5.000s from 0.000s"},
+			expectedSaved:  2,
+		},
+		{
+			name:          "fixes without time are ignored",
+			fixes:         []*neom9n.Data{{SystemTime: boot, Fix: "none"}, {SystemTime: boot, Fix: "3D"}},
+			expectedSaved: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &memoryStore{}
+			var events []string
+			s := NewSync([]EventHandler{func(event data.Event) error {
+				events = append(events, event.String())
+				return nil
+			}}, WithStore(store, time.Minute))
+
+			for _, d := range test.fixes {
+				require.NoError(t, s.HandleGnssData(d))
+			}
+			require.Equal(t, test.expectedOffset, s.Offset())
+			require.Equal(t, test.expectedEvents, events)
+			require.Len(t, store.offsets, test.expectedSaved)
+		})
+	}
+}
+
+func TestSync_HandleGnssTime(t *testing.T) {
+	boot := time.Date(2023, 9, 8, 6, 40, 0, 0, time.UTC)
+	gnssTime := boot.Add(90 * time.Second)
+	s := NewSync(nil)
+	s.now = func() time.Time { return boot }
+	require.False(t, s.Synced())
+	require.Equal(t, boot, s.Now())
+
+	require.NoError(t, s.HandleGnssTime(gnssTime))
+	require.True(t, s.Synced())
+	require.Equal(t, 90*time.Second, s.Offset())
+	require.Equal(t, gnssTime, s.Now())
+	require.Equal(t, gnssTime.Add(10*time.Second), s.Correct(boot.Add(10*time.Second)))
+}
+
+func TestSqlStore(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "clock.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	store := NewSqlStore(sqlite)
+
+	systemTime := time.Date(2023, 9, 8, 6, 41, 0, 0, time.UTC)
+	require.NoError(t, store.SaveOffset(&Offset{
+		Time:       systemTime.Add(2 * time.Second),
+		SystemTime: systemTime,
+		Offset:     1500 * time.Millisecond,
+		Measured:   2 * time.Second,
+		Source:     SourceFix,
+	}))
+
+	var rows []string
+	require.NoError(t, sqlite.Query(false, "SELECT clock_offset, measured_offset, source FROM clock_offsets", func(r *sql.Rows) error {
+		var offset, measured float64
+		var source string
+		err := r.Scan(&offset, &measured, &source)
+		rows = append(rows, fmt.Sprintf("%.1f %.1f %s", offset, measured, source))
+		return err
+	}, nil))
+	require.Equal(t, []string{"1.5 2.0 fix"}, rows)
+}
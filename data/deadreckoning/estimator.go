@@ -0,0 +1,272 @@
+package deadreckoning
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+)
+
+const (
+	SourceGnss         = "gnss"
+	SourceDeadReckoned = "dead_reckoned"
+	SourceNone         = "none"
+)
+
+const gravity = 9.8
+
+// Position is the best known position of the vehicle. Accuracy is the
+// estimated horizontal error in meters.
+type Position struct {
+	Time      time.Time
+	Latitude  float64
+	Longitude float64
+	Speed     float64 // m/s
+	Heading   float64 // degrees clockwise from the north
+	Accuracy  float64
+	Source    string
+}
+
+// NewGnssPosition is the position of a gnss fix.
+func NewGnssPosition(d *neom9n.Data) *Position {
+	source := SourceGnss
+	if d.Fix != "2D" && d.Fix != "3D" {
+		source = SourceNone
+	}
+	return &Position{
+		Time:      d.SystemTime,
+		Latitude:  d.Latitude,
+		Longitude: d.Longitude,
+		Speed:     d.Speed,
+		Heading:   d.Heading,
+		Accuracy:  d.HorizontalAccuracy,
+		Source:    source,
+	}
+}
+
+type Option func(*Estimator)
+
+// WithYawAxis sets the gyroscope axis measuring the rotation around the
+// vertical ("X", "Y" or "Z"), the same one as the imu axis map Z, inverted
+// like it.
+func WithYawAxis(axis string, inverted bool) Option {
+	return func(e *Estimator) {
+		e.yawAxis = axis
+		e.yawInverted = inverted
+	}
+}
+
+// WithMaxGap sets how long without a good fix before the position is dead
+// reckoned.
+func WithMaxGap(gap time.Duration) Option {
+	return func(e *Estimator) {
+		e.maxGap = gap
+	}
+}
+
+// WithMaxDuration sets how long the position is propagated after the last
+// good fix. Past it, the position is held, its accuracy still growing.
+func WithMaxDuration(duration time.Duration) Option {
+	return func(e *Estimator) {
+		e.maxDuration = duration
+	}
+}
+
+// WithMaxHorizontalAccuracy sets the horizontal accuracy, in meters, over
+// which a fix is not good enough to reset the estimate.
+func WithMaxHorizontalAccuracy(accuracy float64) Option {
+	return func(e *Estimator) {
+		e.maxHorizontalAccuracy = accuracy
+	}
+}
+
+// Estimator propagates the last good gnss fix when the fix is lost: the speed
+// integrates the longitudinal acceleration (imu X, once axis mapped), the
+// heading integrates the gyroscope yaw rate, and the position moves along
+// them. The accelerometer bias, mostly the mount tilt, is learnt while the
+// fix is good by comparing the imu acceleration to the gnss speed changes.
+//
+// The accuracy grows from the accuracy of the last fix with the along track
+// error (speed accuracy and acceleration bias) and the cross track error
+// (gyroscope drift on the travelled distance).
+type Estimator struct {
+	lock sync.Mutex
+
+	yawAxis               string
+	yawInverted           bool
+	maxGap                time.Duration
+	maxDuration           time.Duration
+	maxHorizontalAccuracy float64
+	accelerationNoise     float64 // m/s², along track
+	gyroDrift             float64 // degrees/s
+
+	lastFix   *neom9n.Data
+	estimate  *Position // propagated since lastFix
+	reckoning bool      // estimate is used, lastFix being too old
+	travelled float64   // meters since lastFix
+	lastImu   time.Time
+
+	bias          float64 // g
+	biasSum       float64
+	biasCount     int
+	biasFixSpeed  float64
+	biasFixTime   time.Time
+	biasAvailable bool
+}
+
+func NewEstimator(opts ...Option) *Estimator {
+	e := &Estimator{
+		yawAxis:               "Z",
+		maxGap:                1500 * time.Millisecond,
+		maxDuration:           time.Minute,
+		maxHorizontalAccuracy: 25,
+		accelerationNoise:     0.3,
+		gyroDrift:             0.5,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+func (e *Estimator) isGood(d *neom9n.Data) bool {
+	return (d.Fix == "2D" || d.Fix == "3D") && d.HorizontalAccuracy <= e.maxHorizontalAccuracy
+}
+
+func (e *Estimator) HandleGnssData(d *neom9n.Data) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if !e.isGood(d) {
+		return nil
+	}
+
+	e.learnBias(d)
+	e.lastFix = d
+	e.estimate = NewGnssPosition(d)
+	e.reckoning = false
+	e.travelled = 0
+	return nil
+}
+
+// learnBias compares the mean imu acceleration between 2 consecutive good
+// fixes to their speed change.
+func (e *Estimator) learnBias(d *neom9n.Data) {
+	defer func() {
+		e.biasSum = 0
+		e.biasCount = 0
+		e.biasFixSpeed = d.Speed
+		e.biasFixTime = d.SystemTime
+	}()
+
+	dt := d.SystemTime.Sub(e.biasFixTime).Seconds()
+	if e.biasFixTime.IsZero() || e.biasCount == 0 || dt <= 0 || dt > 2 {
+		return
+	}
+
+	measured := e.biasSum/float64(e.biasCount) - (d.Speed-e.biasFixSpeed)/dt/gravity
+	if !e.biasAvailable {
+		e.bias = measured
+		e.biasAvailable = true
+		return
+	}
+	e.bias += 0.05 * (measured - e.bias)
+}
+
+func (e *Estimator) HandleRawImuFeed(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, _ iim42652.Temperature) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	previous := e.lastImu
+	e.lastImu = acceleration.Time
+	if e.lastFix == nil {
+		return nil
+	}
+
+	sinceFix := acceleration.Time.Sub(e.lastFix.SystemTime)
+	if sinceFix <= e.maxGap {
+		e.biasSum += acceleration.X
+		e.biasCount++
+	} else {
+		e.reckoning = true
+	}
+
+	if previous.Before(e.lastFix.SystemTime) {
+		previous = e.lastFix.SystemTime
+	}
+	// a pause of the feed is not a constant motion
+	dt := math.Min(acceleration.Time.Sub(previous).Seconds(), 1)
+	if dt <= 0 {
+		return nil
+	}
+
+	p := e.estimate
+	p.Time = acceleration.Time
+	p.Source = SourceDeadReckoned
+	if sinceFix <= e.maxDuration {
+		p.Speed = math.Max(0, p.Speed+(acceleration.X-e.bias)*gravity*dt)
+		p.Heading = math.Mod(p.Heading-e.yawRate(angularRate)*dt+360, 360)
+
+		moved := geo.DestinationPoint(geo.NewCoordinate(p.Longitude, p.Latitude), p.Heading, p.Speed*dt)
+		p.Longitude = moved.Lon
+		p.Latitude = moved.Lat
+		e.travelled += p.Speed * dt
+	}
+
+	t := sinceFix.Seconds()
+	alongTrack := e.lastFix.SpeedAccuracy*t + 0.5*e.accelerationNoise*t*t
+	crossTrack := e.travelled * math.Sin(geo.DegreesToRadians(math.Min(e.gyroDrift*t, 90)))
+	p.Accuracy = e.lastFix.HorizontalAccuracy + math.Hypot(alongTrack, crossTrack)
+	return nil
+}
+
+// yawRate is the rotation rate around the vertical axis, in degrees/s,
+// positive counterclockwise (to the left).
+func (e *Estimator) yawRate(angularRate *iim42652.AngularRate) float64 {
+	if angularRate == nil {
+		return 0
+	}
+
+	var rate float64
+	switch e.yawAxis {
+	case "X":
+		rate = angularRate.X
+	case "Y":
+		rate = angularRate.Y
+	default:
+		rate = angularRate.Z
+	}
+	if e.yawInverted {
+		return -rate
+	}
+	return rate
+}
+
+// Travelled is the distance, in meters, dead reckoned since the last good fix.
+func (e *Estimator) Travelled() float64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.travelled
+}
+
+// Position returns the last good fix, or the dead reckoned estimate once
+// the fix is lost. It is nil before the first good fix.
+func (e *Estimator) Position() *Position {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.lastFix == nil {
+		return nil
+	}
+	if !e.reckoning {
+		return NewGnssPosition(e.lastFix)
+	}
+	p := *e.estimate
+	return &p
+}
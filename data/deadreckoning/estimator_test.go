@@ -0,0 +1,119 @@
+package deadreckoning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+var origin = geo.NewCoordinate(-73.4391, 45.5752)
+
+func at(seconds float64) time.Time {
+	return start.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+func fix(seconds float64, c *geo.Coordinate, speed float64, heading float64) *neom9n.Data {
+	return &neom9n.Data{
+		SystemTime:         at(seconds),
+		Fix:                "3D",
+		Longitude:          c.Lon,
+		Latitude:           c.Lat,
+		Speed:              speed,
+		Heading:            heading,
+		HorizontalAccuracy: 2,
+		SpeedAccuracy:      0.2,
+	}
+}
+
+// imuFeed feeds the estimator at 100Hz from `from` to `to` seconds.
+func imuFeed(t *testing.T, e *Estimator, from float64, to float64, x float64, yawRate float64) {
+	t.Helper()
+	for s := from; s <= to+1e-9; s += 0.01 {
+		acceleration := imu.NewAcceleration(x, 0, 1, 1, at(s))
+		require.NoError(t, e.HandleRawImuFeed(acceleration, &iim42652.AngularRate{Z: yawRate}, nil))
+	}
+}
+
+func TestEstimator(t *testing.T) {
+	tests := []struct {
+		name            string
+		acceleration    float64 // g
+		yawRate         float64 // degrees/s
+		expectedEast    float64
+		expectedNorth   float64
+		expectedHeading float64
+	}{
+		{name: "straight", expectedEast: 100, expectedHeading: 90},
+		{name: "braking", acceleration: -0.102, expectedEast: 50, expectedHeading: 90},
+		// a quarter of a circle of 10/(9*pi/180) meters
+		{name: "left turn", yawRate: 9, expectedEast: 63.66, expectedNorth: 63.66, expectedHeading: 0},
+		{name: "right turn", yawRate: -9, expectedEast: 63.66, expectedNorth: -63.66, expectedHeading: 180},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := NewEstimator()
+			require.Nil(t, e.Position())
+
+			require.NoError(t, e.HandleGnssData(fix(0, origin, 10, 90)))
+			imuFeed(t, e, 0.01, 1, test.acceleration, test.yawRate)
+			require.Equal(t, SourceGnss, e.Position().Source)
+
+			imuFeed(t, e, 1.01, 10, test.acceleration, test.yawRate)
+			p := e.Position()
+			require.Equal(t, SourceDeadReckoned, p.Source)
+
+			frame := geo.NewLocalFrame(origin, 0)
+			enu := frame.ToENU(geo.NewCoordinate(p.Longitude, p.Latitude), 0)
+			require.InDelta(t, test.expectedEast, enu.East, 1)
+			require.InDelta(t, test.expectedNorth, enu.North, 1)
+			require.InDelta(t, test.expectedHeading, p.Heading, 0.5)
+		})
+	}
+}
+
+func TestEstimator_Accuracy(t *testing.T) {
+	e := NewEstimator(WithMaxDuration(20 * time.Second))
+	require.NoError(t, e.HandleGnssData(fix(0, origin, 10, 90)))
+
+	previous := 0.0
+	for s := 2.0; s <= 30; s += 2 {
+		imuFeed(t, e, s-1.99, s, 0, 0)
+		p := e.Position()
+		require.Greater(t, p.Accuracy, previous)
+		previous = p.Accuracy
+	}
+
+	// held after the max duration
+	p := e.Position()
+	imuFeed(t, e, 30.01, 32, 0, 0)
+	require.Equal(t, p.Latitude, e.Position().Latitude)
+	require.Equal(t, p.Longitude, e.Position().Longitude)
+
+	require.NoError(t, e.HandleGnssData(fix(33, origin, 0, 0)))
+	require.Equal(t, &Position{Time: at(33), Latitude: origin.Lat, Longitude: origin.Lon, Accuracy: 2, Source: SourceGnss}, e.Position())
+}
+
+func TestEstimator_Bias(t *testing.T) {
+	e := NewEstimator()
+
+	// a camera tilted forward reads part of the gravity while driving at a
+	// constant speed
+	tilt := 0.05
+	for s := 0; s < 30; s++ {
+		require.NoError(t, e.HandleGnssData(fix(float64(s), geo.DestinationPoint(origin, 90, float64(s)*10), 10, 90)))
+		imuFeed(t, e, float64(s)+0.01, float64(s)+0.99, tilt, 0)
+	}
+	require.InDelta(t, tilt, e.bias, 0.001)
+
+	imuFeed(t, e, 30, 39, tilt, 0)
+	p := e.Position()
+	require.InDelta(t, 10, p.Speed, 0.1)
+	require.InDelta(t, 390, geo.Distance(origin, geo.NewCoordinate(p.Longitude, p.Latitude)), 1)
+}
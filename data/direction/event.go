@@ -173,3 +173,22 @@ func NewStopEndEvent(duration time.Duration, t time.Time, gnssData *neom9n.Data)
 func (e *StopEndEvent) String() string {
 	return fmt.Sprintf("Stop End for %s", e.Duration)
 }
+
+// Duration returns how long the event lasted, 0 for the events that are not
+// the end of a tracked period (ex: the *_DETECTED_EVENT).
+func Duration(event data.Event) time.Duration {
+	switch e := event.(type) {
+	case *LeftTurnEvent:
+		return e.Duration
+	case *RightTurnEvent:
+		return e.Duration
+	case *AccelerationEvent:
+		return e.Duration
+	case *DecelerationEvent:
+		return e.Duration
+	case *StopEndEvent:
+		return e.Duration
+	default:
+		return 0
+	}
+}
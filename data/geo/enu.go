@@ -0,0 +1,97 @@
+package geo
+
+import (
+	"math"
+)
+
+// WGS84 ellipsoid
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+	eccentricity2 = flattening * (2 - flattening)
+)
+
+// ENU is a position in meters east, north and up of the origin of a
+// LocalFrame.
+type ENU struct {
+	East  float64
+	North float64
+	Up    float64
+}
+
+// LocalFrame converts between geodetic coordinates and the East North Up
+// tangent plane at its origin. Distances are exact in the plane near the
+// origin, making it the frame of choice for filtering positions in meters.
+type LocalFrame struct {
+	Origin   *Coordinate
+	Altitude float64
+
+	x, y, z        float64
+	sinLat, cosLat float64
+	sinLon, cosLon float64
+}
+
+func NewLocalFrame(origin *Coordinate, altitude float64) *LocalFrame {
+	f := &LocalFrame{
+		Origin:   origin,
+		Altitude: altitude,
+		sinLat:   math.Sin(DegreesToRadians(origin.Lat)),
+		cosLat:   math.Cos(DegreesToRadians(origin.Lat)),
+		sinLon:   math.Sin(DegreesToRadians(origin.Lon)),
+		cosLon:   math.Cos(DegreesToRadians(origin.Lon)),
+	}
+	f.x, f.y, f.z = toEcef(origin, altitude)
+	return f
+}
+
+// ToENU converts c, at altitude meters above the ellipsoid, to the frame.
+func (f *LocalFrame) ToENU(c *Coordinate, altitude float64) *ENU {
+	x, y, z := toEcef(c, altitude)
+	dx, dy, dz := x-f.x, y-f.y, z-f.z
+
+	return &ENU{
+		East:  -f.sinLon*dx + f.cosLon*dy,
+		North: -f.sinLat*f.cosLon*dx - f.sinLat*f.sinLon*dy + f.cosLat*dz,
+		Up:    f.cosLat*f.cosLon*dx + f.cosLat*f.sinLon*dy + f.sinLat*dz,
+	}
+}
+
+// FromENU converts e back to a coordinate and its altitude above the
+// ellipsoid.
+func (f *LocalFrame) FromENU(e *ENU) (*Coordinate, float64) {
+	x := f.x - f.sinLon*e.East - f.sinLat*f.cosLon*e.North + f.cosLat*f.cosLon*e.Up
+	y := f.y + f.cosLon*e.East - f.sinLat*f.sinLon*e.North + f.cosLat*f.sinLon*e.Up
+	z := f.z + f.cosLat*e.North + f.sinLat*e.Up
+
+	return fromEcef(x, y, z)
+}
+
+func toEcef(c *Coordinate, altitude float64) (x, y, z float64) {
+	lat := DegreesToRadians(c.Lat)
+	lon := DegreesToRadians(c.Lon)
+	sinLat := math.Sin(lat)
+	n := semiMajorAxis / math.Sqrt(1-eccentricity2*sinLat*sinLat)
+
+	x = (n + altitude) * math.Cos(lat) * math.Cos(lon)
+	y = (n + altitude) * math.Cos(lat) * math.Sin(lon)
+	z = (n*(1-eccentricity2) + altitude) * sinLat
+	return x, y, z
+}
+
+// fromEcef iterates on the latitude, converging to well under a millimeter
+// in a few iterations for positions near the surface.
+func fromEcef(x, y, z float64) (*Coordinate, float64) {
+	lon := math.Atan2(y, x)
+	p := math.Hypot(x, y)
+
+	lat := math.Atan2(z, p*(1-eccentricity2))
+	altitude := 0.0
+	for i := 0; i < 5; i++ {
+		sinLat := math.Sin(lat)
+		n := semiMajorAxis / math.Sqrt(1-eccentricity2*sinLat*sinLat)
+		altitude = p/math.Cos(lat) - n
+		lat = math.Atan2(z, p*(1-eccentricity2*n/(n+altitude)))
+	}
+
+	return NewCoordinate(RadiansToDegrees(lon), RadiansToDegrees(lat)), altitude
+}
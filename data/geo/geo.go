@@ -1,11 +1,11 @@
-package main
+package geo
 
 import (
 	"math"
 )
 
 const (
-	earthRadius = 6371 * 1000 // meters
+	EarthRadius = 6371 * 1000 // meters
 )
 
 type Coordinate struct {
@@ -21,11 +21,13 @@ func NewCoordinate(lon float64, lat float64) *Coordinate {
 	}
 }
 
+// HeadingTo is the initial bearing from c to `to`, in degrees clockwise from
+// the north.
 func (c *Coordinate) HeadingTo(to *Coordinate) float64 {
-	lat1 := degreesToRadians(c.Lat)
-	lon1 := degreesToRadians(c.Lon)
-	lat2 := degreesToRadians(to.Lat)
-	lon2 := degreesToRadians(to.Lon)
+	lat1 := DegreesToRadians(c.Lat)
+	lon1 := DegreesToRadians(c.Lon)
+	lat2 := DegreesToRadians(to.Lat)
+	lon2 := DegreesToRadians(to.Lon)
 
 	// Compute differences in longitude and latitude
 	deltaLon := lon2 - lon1
@@ -46,19 +48,20 @@ func (c *Coordinate) HeadingTo(to *Coordinate) float64 {
 	return heading
 }
 
-func degreesToRadians(d float64) float64 {
+func DegreesToRadians(d float64) float64 {
 	return d * math.Pi / 180
 }
 
-func radiansToDegrees(r float64) float64 {
+func RadiansToDegrees(r float64) float64 {
 	return r * 180 / math.Pi
 }
 
+// Distance is the great circle distance in meters between c1 and c2.
 func Distance(c1, c2 *Coordinate) float64 {
-	lat1 := degreesToRadians(c1.Lat)
-	lon1 := degreesToRadians(c1.Lon)
-	lat2 := degreesToRadians(c2.Lat)
-	lon2 := degreesToRadians(c2.Lon)
+	lat1 := DegreesToRadians(c1.Lat)
+	lon1 := DegreesToRadians(c1.Lon)
+	lat2 := DegreesToRadians(c2.Lat)
+	lon2 := DegreesToRadians(c2.Lon)
 
 	diffLat := lat2 - lat1
 	diffLon := lon2 - lon1
@@ -67,7 +70,7 @@ func Distance(c1, c2 *Coordinate) float64 {
 		math.Pow(math.Sin(diffLon/2), 2)
 
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return c * earthRadius
+	return c * EarthRadius
 }
 
 func ClosestPoint(c *Coordinate, points []*Coordinate) (closestPoints []*Coordinate) {
@@ -116,7 +119,7 @@ func ClosestWay(closests []*Coordinate, origin *Coordinate, heading float64, poi
 				continue
 			}
 
-			_, b, _ := calculateTriangleAngles(c, origin, corrected)
+			_, b, _ := TriangleAngles(c, origin, corrected)
 			distance := Distance(origin, point)
 			if closestWayPoints[i][1] == nil || (b > 88 && b < 92 && distance < smallestDistance) {
 				closestWayPoints[i][0] = c
@@ -143,6 +146,8 @@ func ClosestWay(closests []*Coordinate, origin *Coordinate, heading float64, poi
 	return closestWayPoint[0], closestWayPoint[1]
 }
 
+// Correct projects c on the line going through w1 and w2, on a flat
+// lon/lat plane.
 func Correct(c, w1, w2 *Coordinate) *Coordinate {
 	directionX := w2.Lon - w1.Lon
 	directionY := w2.Lat - w1.Lat
@@ -155,7 +160,9 @@ func Correct(c, w1, w2 *Coordinate) *Coordinate {
 	}
 }
 
-func calculateTriangleAngles(closest, origin, corrected *Coordinate) (float64, float64, float64) {
+// TriangleAngles returns the angles, in degrees, of the triangle at closest,
+// origin and corrected.
+func TriangleAngles(closest, origin, corrected *Coordinate) (float64, float64, float64) {
 	sideA := Distance(origin, corrected)
 	sideB := Distance(closest, corrected)
 	sideC := Distance(closest, origin)
@@ -1,4 +1,4 @@
-package main
+package geo
 
 import (
 	"encoding/json"
@@ -0,0 +1,47 @@
+package geo
+
+import (
+	"math"
+)
+
+// DestinationPoint is the point reached from c after distance meters along
+// the great circle of initial bearing heading, in degrees.
+func DestinationPoint(c *Coordinate, heading float64, distance float64) *Coordinate {
+	lat1 := DegreesToRadians(c.Lat)
+	lon1 := DegreesToRadians(c.Lon)
+	bearing := DegreesToRadians(heading)
+	angular := distance / EarthRadius
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angular) + math.Cos(lat1)*math.Sin(angular)*math.Cos(bearing))
+	lon2 := lon1 + math.Atan2(math.Sin(bearing)*math.Sin(angular)*math.Cos(lat1), math.Cos(angular)-math.Sin(lat1)*math.Sin(lat2))
+
+	return NewCoordinate(normalizeLongitude(RadiansToDegrees(lon2)), RadiansToDegrees(lat2))
+}
+
+// CrossTrackDistance is the distance in meters from c to the great circle
+// going through start and end, positive when c is on the right of it.
+func CrossTrackDistance(c, start, end *Coordinate) float64 {
+	angular := Distance(start, c) / EarthRadius
+	delta := DegreesToRadians(start.HeadingTo(c) - start.HeadingTo(end))
+
+	return math.Asin(math.Sin(angular)*math.Sin(delta)) * EarthRadius
+}
+
+// AlongTrackDistance is the distance in meters from start to the projection
+// of c on the great circle going through start and end, negative when the
+// projection is behind start.
+func AlongTrackDistance(c, start, end *Coordinate) float64 {
+	angular := Distance(start, c) / EarthRadius
+	crossTrack := CrossTrackDistance(c, start, end) / EarthRadius
+	delta := DegreesToRadians(start.HeadingTo(c) - start.HeadingTo(end))
+
+	along := math.Acos(math.Max(-1, math.Min(1, math.Cos(angular)/math.Cos(crossTrack)))) * EarthRadius
+	if math.Cos(delta) < 0 {
+		return -along
+	}
+	return along
+}
+
+func normalizeLongitude(lon float64) float64 {
+	return math.Mod(lon+540, 360) - 180
+}
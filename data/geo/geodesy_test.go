@@ -0,0 +1,130 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinationPoint(t *testing.T) {
+	origin := NewCoordinate(-73.4391, 45.5752)
+
+	tests := []struct {
+		name     string
+		heading  float64
+		distance float64
+	}{
+		{name: "north", heading: 0, distance: 100},
+		{name: "east", heading: 90, distance: 250},
+		{name: "south west", heading: 225, distance: 1000},
+		{name: "no move", heading: 45, distance: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destination := DestinationPoint(origin, test.heading, test.distance)
+			require.InDelta(t, test.distance, Distance(origin, destination), 0.01)
+			if test.distance > 0 {
+				require.InDelta(t, test.heading, origin.HeadingTo(destination), 0.01)
+			}
+		})
+	}
+
+	require.InDelta(t, -179.9, DestinationPoint(NewCoordinate(179.9, 0), 90, DegreesToRadians(0.2)*EarthRadius).Lon, 1e-6)
+}
+
+func TestCrossTrackDistance(t *testing.T) {
+	start := NewCoordinate(-73.4400, 45.5750)
+	end := DestinationPoint(start, 90, 1000)
+
+	tests := []struct {
+		name          string
+		point         *Coordinate
+		expectedCross float64
+		expectedAlong float64
+	}{
+		{name: "right", point: DestinationPoint(DestinationPoint(start, 90, 400), 180, 30), expectedCross: 30, expectedAlong: 400},
+		{name: "left", point: DestinationPoint(DestinationPoint(start, 90, 600), 0, 12), expectedCross: -12, expectedAlong: 600},
+		{name: "behind", point: DestinationPoint(DestinationPoint(start, 270, 50), 0, 5), expectedCross: -5, expectedAlong: -50},
+		{name: "on track", point: DestinationPoint(start, 90, 700), expectedCross: 0, expectedAlong: 700},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.InDelta(t, test.expectedCross, CrossTrackDistance(test.point, start, end), 0.05)
+			require.InDelta(t, test.expectedAlong, AlongTrackDistance(test.point, start, end), 0.05)
+		})
+	}
+}
+
+func TestLocalFrame(t *testing.T) {
+	frame := NewLocalFrame(NewCoordinate(-73.4391, 45.5752), 30)
+
+	origin := frame.ToENU(frame.Origin, 30)
+	require.InDelta(t, 0, origin.East, 1e-6)
+	require.InDelta(t, 0, origin.North, 1e-6)
+	require.InDelta(t, 0, origin.Up, 1e-6)
+
+	east := frame.ToENU(DestinationPoint(frame.Origin, 90, 100), 30)
+	require.InDelta(t, 100, east.East, 0.5)
+	require.InDelta(t, 0, east.North, 0.5)
+
+	north := frame.ToENU(DestinationPoint(frame.Origin, 0, 100), 30)
+	require.InDelta(t, 0, north.East, 0.5)
+	require.InDelta(t, 100, north.North, 0.5)
+
+	for _, e := range []*ENU{{East: 10, North: -20, Up: 1}, {East: -1500, North: 2500, Up: -10}} {
+		c, altitude := frame.FromENU(e)
+		back := frame.ToENU(c, altitude)
+		require.InDelta(t, e.East, back.East, 1e-3)
+		require.InDelta(t, e.North, back.North, 1e-3)
+		require.InDelta(t, e.Up, back.Up, 1e-3)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	start := NewCoordinate(-73.4400, 45.5750)
+	corner := DestinationPoint(start, 90, 200)
+	end := DestinationPoint(corner, 0, 200)
+
+	points := []*Coordinate{
+		start,
+		DestinationPoint(DestinationPoint(start, 90, 50), 0, 1),
+		DestinationPoint(DestinationPoint(start, 90, 100), 180, 2),
+		corner,
+		DestinationPoint(DestinationPoint(corner, 0, 100), 90, 1.5),
+		end,
+	}
+
+	require.Equal(t, []*Coordinate{start, corner, end}, Simplify(points, 5))
+	require.Equal(t, points, Simplify(points, 0.5))
+	require.Equal(t, points[:2], Simplify(points[:2], 5))
+
+	require.InDelta(t, 400, PolylineLength([]*Coordinate{start, corner, end}), 0.01)
+	require.Equal(t, 0.0, PolylineLength(points[:1]))
+}
+
+func TestPolygon_Contains(t *testing.T) {
+	// a 2x2 square with a 1x1 hole in its middle
+	square := NewPolygonFromGeoJson([][][]float64{
+		{{-73, 45}, {-71, 45}, {-71, 47}, {-73, 47}, {-73, 45}},
+		{{-72.5, 45.5}, {-71.5, 45.5}, {-71.5, 46.5}, {-72.5, 46.5}},
+	})
+
+	tests := []struct {
+		name     string
+		c        *Coordinate
+		expected bool
+	}{
+		{name: "inside", c: NewCoordinate(-72.75, 46), expected: true},
+		{name: "in the hole", c: NewCoordinate(-72, 46)},
+		{name: "outside", c: NewCoordinate(-70, 46)},
+		{name: "outside the bounds latitude", c: NewCoordinate(-72.75, 48)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, square.Contains(test.c))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package geo
+
+import (
+	"math"
+)
+
+// Polygon is an outer ring followed by its holes, each ring being a list of
+// coordinates, closed or not.
+type Polygon struct {
+	Rings [][]*Coordinate
+
+	minLat, maxLat float64
+	minLon, maxLon float64
+}
+
+func NewPolygon(rings [][]*Coordinate) *Polygon {
+	p := &Polygon{
+		Rings:  rings,
+		minLat: math.Inf(1),
+		maxLat: math.Inf(-1),
+		minLon: math.Inf(1),
+		maxLon: math.Inf(-1),
+	}
+	if len(rings) > 0 {
+		for _, c := range rings[0] {
+			p.minLat = math.Min(p.minLat, c.Lat)
+			p.maxLat = math.Max(p.maxLat, c.Lat)
+			p.minLon = math.Min(p.minLon, c.Lon)
+			p.maxLon = math.Max(p.maxLon, c.Lon)
+		}
+	}
+	return p
+}
+
+// NewPolygonFromGeoJson builds a polygon from GeoJSON polygon coordinates,
+// [longitude, latitude] pairs.
+func NewPolygonFromGeoJson(coordinates [][][]float64) *Polygon {
+	rings := make([][]*Coordinate, len(coordinates))
+	for i, ring := range coordinates {
+		for _, c := range ring {
+			rings[i] = append(rings[i], NewCoordinate(c[0], c[1]))
+		}
+	}
+	return NewPolygon(rings)
+}
+
+// Contains tells if c is inside the outer ring and outside the holes, with the
+// even-odd rule on the longitude and latitude. The polygons are expected to be
+// small enough for the edges to be straight in degrees.
+func (p *Polygon) Contains(c *Coordinate) bool {
+	if c.Lat < p.minLat || c.Lat > p.maxLat || c.Lon < p.minLon || c.Lon > p.maxLon {
+		return false
+	}
+
+	inside := false
+	for _, ring := range p.Rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a.Lat > c.Lat) != (b.Lat > c.Lat) && c.Lon < (b.Lon-a.Lon)*(c.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
@@ -0,0 +1,72 @@
+package geo
+
+import (
+	"math"
+)
+
+// PolylineLength is the length in meters of the path going through points.
+func PolylineLength(points []*Coordinate) float64 {
+	length := 0.0
+	for i := 1; i < len(points); i++ {
+		length += Distance(points[i-1], points[i])
+	}
+	return length
+}
+
+// Simplify drops the points of the polyline closer than tolerance meters to
+// the simplified line (Douglas-Peucker). The first and last points are
+// always kept.
+func Simplify(points []*Coordinate, tolerance float64) []*Coordinate {
+	if len(points) < 3 {
+		return points
+	}
+
+	frame := NewLocalFrame(points[0], 0)
+	projected := make([]*ENU, len(points))
+	for i, p := range points {
+		projected[i] = frame.ToENU(p, 0)
+	}
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+
+		farthest := -1
+		maxDistance := tolerance
+		for i := first + 1; i < last; i++ {
+			d := segmentDistance(projected[i], projected[first], projected[last])
+			if d > maxDistance {
+				maxDistance = d
+				farthest = i
+			}
+		}
+
+		if farthest >= 0 {
+			keep[farthest] = true
+			stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+
+	var simplified []*Coordinate
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// segmentDistance is the planar distance from p to the segment a-b.
+func segmentDistance(p, a, b *ENU) float64 {
+	dx, dy := b.East-a.East, b.North-a.North
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p.East-a.East)*dx+(p.North-a.North)*dy)/l))
+	}
+	return math.Hypot(p.East-(a.East+t*dx), p.North-(a.North+t*dy))
+}
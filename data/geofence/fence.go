@@ -0,0 +1,87 @@
+package geofence
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+// Fence is an area, a depot, a restricted area or a customer zone, made of
+// one or many polygons.
+type Fence struct {
+	ID       string
+	Name     string
+	Polygons []*geo.Polygon
+}
+
+func (f *Fence) Contains(c *geo.Coordinate) bool {
+	for _, p := range f.Polygons {
+		if p.Contains(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFences reads the Polygon and MultiPolygon features of a GeoJSON
+// FeatureCollection. The fence id is the feature id or its "id" property,
+// defaulting to the feature index, and its name the "name" property,
+// defaulting to the id.
+func LoadFences(filePath string) ([]*Fence, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", filePath, err)
+	}
+
+	collection, err := geojson.UnmarshalFeatureCollection(content)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling feature collection: %w", err)
+	}
+
+	var fences []*Fence
+	for i, feature := range collection.Features {
+		if feature.Geometry == nil {
+			continue
+		}
+
+		var polygons []*geo.Polygon
+		switch {
+		case feature.Geometry.IsPolygon():
+			polygons = append(polygons, geo.NewPolygonFromGeoJson(feature.Geometry.Polygon))
+		case feature.Geometry.IsMultiPolygon():
+			for _, polygon := range feature.Geometry.MultiPolygon {
+				polygons = append(polygons, geo.NewPolygonFromGeoJson(polygon))
+			}
+		default:
+			continue
+		}
+
+		id := featureID(feature, i)
+		fences = append(fences, &Fence{
+			ID:       id,
+			Name:     feature.PropertyMustString("name", id),
+			Polygons: polygons,
+		})
+	}
+
+	return fences, nil
+}
+
+func featureID(feature *geojson.Feature, index int) string {
+	id := feature.ID
+	if id == nil {
+		id = feature.Properties["id"]
+	}
+
+	switch v := id.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return strconv.Itoa(index)
+	}
+}
@@ -0,0 +1,115 @@
+package geofence
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+type EventHandler func(event data.Event) error
+
+type Option func(*Monitor)
+
+// WithMaxHorizontalAccuracy sets the horizontal accuracy, in meters, over
+// which a fix is too inaccurate to tell if it is inside a fence.
+func WithMaxHorizontalAccuracy(accuracy float64) Option {
+	return func(m *Monitor) {
+		m.maxHorizontalAccuracy = accuracy
+	}
+}
+
+// Monitor evaluates each gnss fix against the fences, emitting an EnterEvent
+// when entering a fence and an ExitEvent, with the dwell time, when leaving
+// it. Being inside a fence when the logger starts is entering it.
+type Monitor struct {
+	lock sync.Mutex
+
+	fences                []*Fence
+	handlers              []EventHandler
+	maxHorizontalAccuracy float64
+
+	entered map[string]time.Time
+}
+
+func NewMonitor(fences []*Fence, handlers []EventHandler, opts ...Option) *Monitor {
+	m := &Monitor{
+		fences:                fences,
+		handlers:              handlers,
+		maxHorizontalAccuracy: 25,
+		entered:               map[string]time.Time{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *Monitor) HandleGnssData(d *neom9n.Data) error {
+	if (d.Fix != "2D" && d.Fix != "3D") || d.HorizontalAccuracy > m.maxHorizontalAccuracy {
+		return nil
+	}
+
+	var events []data.Event
+	m.lock.Lock()
+	c := geo.NewCoordinate(d.Longitude, d.Latitude)
+	for _, fence := range m.fences {
+		enteredAt, wasInside := m.entered[fence.ID]
+		inside := fence.Contains(c)
+		switch {
+		case inside && !wasInside:
+			m.entered[fence.ID] = d.SystemTime
+			events = append(events, NewEnterEvent(fence, d.SystemTime, d))
+		case !inside && wasInside:
+			delete(m.entered, fence.ID)
+			events = append(events, NewExitEvent(fence, d.SystemTime.Sub(enteredAt), d.SystemTime, d))
+		}
+	}
+	m.lock.Unlock()
+
+	for _, event := range events {
+		for _, handler := range m.handlers {
+			err := handler(event)
+			if err != nil {
+				return fmt.Errorf("handling geofence event: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+type Event struct {
+	*data.BaseEvent
+	FenceID   string  `json:"fence_id"`
+	FenceName string  `json:"fence_name"`
+	Dwell     float64 `json:"dwell"` // seconds inside the fence, on exit
+}
+
+func NewEnterEvent(fence *Fence, t time.Time, gnssData *neom9n.Data) *Event {
+	return &Event{
+		BaseEvent: data.NewBaseEvent("GEOFENCE_ENTER", "GEOFENCE", t, gnssData),
+		FenceID:   fence.ID,
+		FenceName: fence.Name,
+	}
+}
+
+func NewExitEvent(fence *Fence, dwell time.Duration, t time.Time, gnssData *neom9n.Data) *Event {
+	return &Event{
+		BaseEvent: data.NewBaseEvent("GEOFENCE_EXIT", "GEOFENCE", t, gnssData),
+		FenceID:   fence.ID,
+		FenceName: fence.Name,
+		Dwell:     dwell.Seconds(),
+	}
+}
+
+func (e *Event) String() string {
+	if e.Name == "GEOFENCE_EXIT" {
+		return fmt.Sprintf("Geofence Exit Event %s after %.0fs", e.FenceName, e.Dwell)
+	}
+	return fmt.Sprintf("Geofence Enter Event %s", e.FenceName)
+}
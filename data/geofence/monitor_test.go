@@ -0,0 +1,131 @@
+package geofence
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFences(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "fences.geojson")
+	content := `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "id": "depot-1",
+      "properties": {"name": "Depot"},
+      "geometry": {"type": "Polygon", "coordinates": [[[-73.441, 45.574], [-73.437, 45.574], [-73.437, 45.576], [-73.441, 45.576], [-73.441, 45.574]]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"id": 7},
+      "geometry": {"type": "MultiPolygon", "coordinates": [[[[-73.40, 45.50], [-73.39, 45.50], [-73.39, 45.51], [-73.40, 45.50]]], [[[-73.30, 45.50], [-73.29, 45.50], [-73.29, 45.51], [-73.30, 45.50]]]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"name": "not a zone"},
+      "geometry": {"type": "Point", "coordinates": [-73.4, 45.5]}
+    }
+  ]
+}`
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	fences, err := LoadFences(filePath)
+	require.NoError(t, err)
+	require.Len(t, fences, 2)
+
+	require.Equal(t, "depot-1", fences[0].ID)
+	require.Equal(t, "Depot", fences[0].Name)
+	require.Len(t, fences[0].Polygons, 1)
+	require.Equal(t, "7", fences[1].ID)
+	require.Equal(t, "7", fences[1].Name)
+	require.Len(t, fences[1].Polygons, 2)
+}
+
+func TestMonitor(t *testing.T) {
+	depot := &Fence{ID: "depot-1", Name: "Depot", Polygons: []*geo.Polygon{
+		geo.NewPolygonFromGeoJson([][][]float64{{{-73.441, 45.574}, {-73.437, 45.574}, {-73.437, 45.576}, {-73.441, 45.576}}}),
+	}}
+	onTheRoad := time.Date(2023, 9, 4, 7, 30, 0, 0, time.UTC)
+	atTheGate := onTheRoad.Add(10 * time.Second)
+	atTheDock := onTheRoad.Add(100 * time.Second)
+	leftTheDepot := onTheRoad.Add(130 * time.Second)
+
+	tests := []struct {
+		name     string
+		fixes    []*neom9n.Data
+		expected []string
+	}{
+		{
+			name: "drive through",
+			fixes: []*neom9n.Data{
+				{SystemTime: onTheRoad, Fix: "3D", Latitude: 45.575, Longitude: -73.45, HorizontalAccuracy: 2},
+				{SystemTime: atTheGate, Fix: "3D", Latitude: 45.575, Longitude: -73.439, HorizontalAccuracy: 2},
+				{SystemTime: atTheDock, Fix: "3D", Latitude: 45.575, Longitude: -73.438, HorizontalAccuracy: 2},
+				{SystemTime: leftTheDepot, Fix: "3D", Latitude: 45.575, Longitude: -73.43, HorizontalAccuracy: 2},
+			},
+			expected: []string{"Geofence Enter Event Depot", "Geofence Exit Event Depot after 120s"},
+		},
+		{
+			name: "starting inside",
+			fixes: []*neom9n.Data{
+				{SystemTime: atTheGate, Fix: "3D", Latitude: 45.575, Longitude: -73.439, HorizontalAccuracy: 2},
+				{SystemTime: atTheDock, Fix: "3D", Latitude: 45.575, Longitude: -73.438, HorizontalAccuracy: 2},
+			},
+			expected: []string{"Geofence Enter Event Depot"},
+		},
+		{
+			name: "inaccurate fixes are ignored",
+			fixes: []*neom9n.Data{
+				{SystemTime: onTheRoad, Fix: "3D", Latitude: 45.575, Longitude: -73.45, HorizontalAccuracy: 2},
+				{SystemTime: atTheGate, Fix: "3D", Latitude: 45.575, Longitude: -73.439, HorizontalAccuracy: 40},
+				{SystemTime: leftTheDepot, Fix: "3D", Latitude: 45.575, Longitude: -73.45, HorizontalAccuracy: 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []string
+			m := NewMonitor([]*Fence{depot}, []EventHandler{func(event data.Event) error {
+				events = append(events, event.String())
+				return nil
+			}})
+			for _, d := range test.fixes {
+				require.NoError(t, m.HandleGnssData(d))
+			}
+			require.Equal(t, test.expected, events)
+		})
+	}
+}
+
+func TestSqlStore(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "geofences.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	store := NewSqlStore(sqlite)
+
+	fence := &Fence{ID: "depot-1", Name: "Depot"}
+	d := &neom9n.Data{SystemTime: time.Date(2023, 9, 4, 16, 45, 0, 0, time.UTC), Fix: "3D", Latitude: 45.575, Longitude: -73.436, HorizontalAccuracy: 2}
+	require.NoError(t, store.HandleEvent(NewExitEvent(fence, 90*time.Second, d.SystemTime, d)))
+	require.NoError(t, store.HandleEvent(data.NewBaseEvent("TRIP_START_EVENT", "TRIP", d.SystemTime, d)))
+
+	var rows []string
+	require.NoError(t, sqlite.Query(false, "SELECT name, fence_id, dwell FROM geofence_events", func(r *sql.Rows) error {
+		var name, fenceID string
+		var dwell float64
+		err := r.Scan(&name, &fenceID, &dwell)
+		rows = append(rows, fmt.Sprintf("%s %s %.0f", name, fenceID, dwell))
+		return err
+	}, nil))
+	require.Equal(t, []string{"GEOFENCE_EXIT depot-1 90"}, rows)
+}
@@ -0,0 +1,91 @@
+package geofence
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS geofence_events (
+		id INTEGER NOT NULL PRIMARY KEY,
+		time TIMESTAMP NOT NULL,
+		name TEXT NOT NULL,
+		fence_id TEXT NOT NULL,
+		fence_name TEXT NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		dwell REAL NOT NULL
+	);
+	create index if not exists geofence_events_time_idx on geofence_events(time);
+`
+
+const insertQuery string = `
+	INSERT INTO geofence_events VALUES(NULL,?,?,?,?,?,?,?);
+`
+
+const purgeQuery string = `
+	DELETE FROM geofence_events WHERE time < ?;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+func PurgeQuery() string {
+	return purgeQuery
+}
+
+// SqlStore writes the geofence events as they happen, them being rare.
+type SqlStore struct {
+	sqlite *logger.Sqlite
+	redact func(d *neom9n.Data) *neom9n.Data
+}
+
+type SqlStoreOption func(*SqlStore)
+
+// WithRedaction redacts the coordinates stored inside the privacy zones,
+// privacy.Redactor.RedactFix being the redact func.
+func WithRedaction(redact func(d *neom9n.Data) *neom9n.Data) SqlStoreOption {
+	return func(s *SqlStore) {
+		s.redact = redact
+	}
+}
+
+func NewSqlStore(sqlite *logger.Sqlite, opts ...SqlStoreOption) *SqlStore {
+	s := &SqlStore{sqlite: sqlite}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// HandleEvent stores the geofence events, ignoring the others.
+func (s *SqlStore) HandleEvent(event data.Event) error {
+	e, ok := event.(*Event)
+	if !ok {
+		return nil
+	}
+
+	gnssData := e.GnssData
+	if s.redact != nil {
+		gnssData = s.redact(gnssData)
+	}
+	err := s.sqlite.Exec(insertQuery,
+		e.Time.Format("2006-01-02 15:04:05.99999"),
+		e.Name,
+		e.FenceID,
+		e.FenceName,
+		gnssData.Latitude,
+		gnssData.Longitude,
+		e.Dwell,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting geofence event: %w", err)
+	}
+	return nil
+}
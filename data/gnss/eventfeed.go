@@ -4,59 +4,33 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/rosshemsley/kalman"
-	"github.com/rosshemsley/kalman/models"
 	"github.com/streamingfast/gnss-controller/device/neom9n"
 )
 
 type GnssDataHandler func(data *neom9n.Data) error
 type TimeHandler func(now time.Time) error
-
-type GnssFilteredData struct {
-	*neom9n.Data
-	initialized bool
-	lonModel    *models.SimpleModel
-	lonFilter   *kalman.KalmanFilter
-	latModel    *models.SimpleModel
-	latFilter   *kalman.KalmanFilter
-}
-
-func NewGnssFilteredData() *GnssFilteredData {
-	return &GnssFilteredData{Data: &neom9n.Data{}}
-}
-
-func (g *GnssFilteredData) init(d *neom9n.Data) {
-	g.initialized = true
-	g.lonModel = models.NewSimpleModel(d.Timestamp, 0.0, models.SimpleModelConfig{
-		InitialVariance:     0.0,
-		ProcessVariance:     2.0,
-		ObservationVariance: 2.0,
-	})
-	g.lonFilter = kalman.NewKalmanFilter(g.lonModel)
-	g.latModel = models.NewSimpleModel(d.Timestamp, 0.0, models.SimpleModelConfig{
-		InitialVariance:     0.0,
-		ProcessVariance:     2.0,
-		ObservationVariance: 2.0,
-	})
-	g.latFilter = kalman.NewKalmanFilter(g.latModel)
-	g.Data = d
-}
+type FilteredDataHandler func(d *neom9n.Data, filtered *GnssFilteredData) error
+type QualityHandler func(d *neom9n.Data, quality *Quality) error
 
 type Option func(*GnssFeed)
 
 type GnssFeed struct {
-	dataHandlers     []GnssDataHandler
-	timeHandlers     []TimeHandler
-	gnssFilteredData *GnssFilteredData
+	dataHandlers         []GnssDataHandler
+	timeHandlers         []TimeHandler
+	filteredDataHandlers []FilteredDataHandler
+	qualityHandlers      []QualityHandler
+	filter               *KalmanFilter
+	qualityGate          *QualityGate
 
 	skipFiltering bool
 }
 
 func NewGnssFeed(dataHandlers []GnssDataHandler, timeHandlers []TimeHandler, opts ...Option) *GnssFeed {
 	g := &GnssFeed{
-		dataHandlers:     dataHandlers,
-		timeHandlers:     timeHandlers,
-		gnssFilteredData: NewGnssFilteredData(),
+		dataHandlers: dataHandlers,
+		timeHandlers: timeHandlers,
+		filter:       NewKalmanFilter(),
+		qualityGate:  NewQualityGate(),
 	}
 
 	for _, opt := range opts {
@@ -72,6 +46,29 @@ func WithSkipFiltering() func(*GnssFeed) {
 	}
 }
 
+// WithFilteredDataHandlers adds handlers receiving the filtered state,
+// velocity and covariance included, along with each raw fix.
+func WithFilteredDataHandlers(handlers ...FilteredDataHandler) func(*GnssFeed) {
+	return func(f *GnssFeed) {
+		f.filteredDataHandlers = append(f.filteredDataHandlers, handlers...)
+	}
+}
+
+// WithQualityGate replaces the default quality gate.
+func WithQualityGate(gate *QualityGate) func(*GnssFeed) {
+	return func(f *GnssFeed) {
+		f.qualityGate = gate
+	}
+}
+
+// WithQualityHandlers adds handlers receiving every fix with its quality,
+// before the data handlers. The rejected fixes only reach them.
+func WithQualityHandlers(handlers ...QualityHandler) func(*GnssFeed) {
+	return func(f *GnssFeed) {
+		f.qualityHandlers = append(f.qualityHandlers, handlers...)
+	}
+}
+
 func (f *GnssFeed) Run(gnssDevice *neom9n.Neom9n, timeValidThreshold string) error {
 	//todo: datafeed is ugly
 	dataFeed := neom9n.NewDataFeed(f.HandleData)
@@ -92,28 +89,34 @@ func (f *GnssFeed) Run(gnssDevice *neom9n.Neom9n, timeValidThreshold string) err
 }
 
 func (f *GnssFeed) HandleData(d *neom9n.Data) {
-	if !f.gnssFilteredData.initialized {
-		f.gnssFilteredData.init(d)
+	quality := f.qualityGate.Check(d)
+	for _, handler := range f.qualityHandlers {
+		err := handler(d, quality)
+		if err != nil {
+			fmt.Printf("handling gnss quality: %s\n", err)
+		}
+	}
+	if quality.Verdict == VerdictRejected {
+		return
 	}
 
+	// the data handlers get a copy with the filtered position, d staying the
+	// raw fix
 	if !f.skipFiltering {
-		filteredLon := d.Longitude
-		filteredLat := d.Latitude
+		filtered := f.filter.Update(d)
+		if filtered != nil {
+			for _, handler := range f.filteredDataHandlers {
+				err := handler(d, filtered)
+				if err != nil {
+					fmt.Printf("handling filtered gnss data: %s\n", err)
+				}
+			}
 
-		err := f.gnssFilteredData.lonFilter.Update(d.Timestamp, f.gnssFilteredData.lonModel.NewMeasurement(d.Longitude))
-		if err != nil {
-			panic("updating lon filter: " + err.Error())
+			filteredData := *d
+			filteredData.Longitude = filtered.Longitude
+			filteredData.Latitude = filtered.Latitude
+			d = &filteredData
 		}
-		err = f.gnssFilteredData.latFilter.Update(d.Timestamp, f.gnssFilteredData.latModel.NewMeasurement(d.Latitude))
-		if err != nil {
-			panic("updating lat filter: " + err.Error())
-		}
-
-		filteredLon = f.gnssFilteredData.lonModel.Value(f.gnssFilteredData.lonFilter.State())
-		filteredLat = f.gnssFilteredData.latModel.Value(f.gnssFilteredData.latFilter.State())
-
-		d.Longitude = filteredLon
-		d.Latitude = filteredLat
 	}
 
 	for _, handler := range f.dataHandlers {
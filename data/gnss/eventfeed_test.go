@@ -0,0 +1,45 @@
+package gnss
+
+import (
+	"testing"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGnssFeed_HandleData(t *testing.T) {
+	var received []*neom9n.Data
+	var raws []*neom9n.Data
+	var verdicts []string
+	feed := NewGnssFeed(
+		[]GnssDataHandler{func(d *neom9n.Data) error {
+			received = append(received, d)
+			return nil
+		}},
+		nil,
+		WithQualityHandlers(func(d *neom9n.Data, quality *Quality) error {
+			verdicts = append(verdicts, quality.Verdict)
+			return nil
+		}),
+		WithFilteredDataHandlers(func(d *neom9n.Data, filtered *GnssFilteredData) error {
+			raws = append(raws, d)
+			return nil
+		}),
+	)
+
+	fixes := []*neom9n.Data{fix(0, 0, 0), fix(0.1, 0, 2), fix(0.2, 0, 300)}
+	for _, d := range fixes {
+		d.Dop = &neom9n.Dop{HDop: 1}
+		d.Satellites = &neom9n.Satellites{Used: 10}
+		feed.HandleData(d)
+	}
+	require.Equal(t, []string{VerdictGood, VerdictGood, VerdictRejected}, verdicts)
+	require.Len(t, received, 2)
+	require.Equal(t, fixes[:2], raws)
+
+	// the raw fix is left untouched, the data handlers get the filtered one
+	c := truth(0.1)
+	require.NotEqual(t, fixes[1].Latitude, received[1].Latitude)
+	require.Less(t, received[1].Latitude-c.Lat, fixes[1].Latitude-c.Lat)
+	require.Equal(t, fixes[1].Timestamp, received[1].Timestamp)
+}
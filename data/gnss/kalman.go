@@ -0,0 +1,358 @@
+package gnss
+
+import (
+	"math"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+const (
+	// gateThreshold is the chi-square value of 2 degrees of freedom at 99.9%:
+	// a position further than it, in standard deviations, is an outlier.
+	gateThreshold = 13.82
+	// maxRejections consecutive outliers are taken as a real jump, after a
+	// tunnel or a cold start, and reset the filter.
+	maxRejections = 5
+	// maxFilterGap without a fix resets the filter.
+	maxFilterGap = 10 * time.Second
+	// maxFrameDistance from the local frame origin re-centers the frame.
+	maxFrameDistance = 10000.0
+
+	minPositionAccuracy = 0.5  // meters
+	minSpeedAccuracy    = 0.1  // m/s
+	minHeadingAccuracy  = 1.0  // degrees
+	defaultAccuracy     = 50.0 // meters, of a fix without accuracy
+)
+
+type vector [4]float64
+type matrix [4][4]float64
+
+// GnssFilteredData is the state of the KalmanFilter after a fix. The
+// Covariance is the one of the east, north, east velocity and north velocity
+// state, in meters and m/s.
+type GnssFilteredData struct {
+	Time               time.Time     `json:"time"`
+	Latitude           float64       `json:"latitude"`
+	Longitude          float64       `json:"longitude"`
+	VelocityEast       float64       `json:"velocity_east"`       // m/s
+	VelocityNorth      float64       `json:"velocity_north"`      // m/s
+	Speed              float64       `json:"speed"`               // m/s
+	Heading            float64       `json:"heading"`             // degrees clockwise from the north
+	HorizontalAccuracy float64       `json:"horizontal_accuracy"` // meters, one standard deviation
+	SpeedAccuracy      float64       `json:"speed_accuracy"`      // m/s, one standard deviation
+	Covariance         [4][4]float64 `json:"covariance"`
+	// Rejected is set when the fix failed the outlier gate and only the
+	// prediction was kept.
+	Rejected bool `json:"rejected"`
+}
+
+// KalmanFilter is a 2-D constant velocity filter of the gnss fixes, in the
+// east north plane of a local frame. The measurement noise of the position
+// and the velocity comes from the accuracies reported by the receiver, and a
+// position too far from the prediction for its accuracy is rejected.
+type KalmanFilter struct {
+	accelerationNoise float64 // m/s², one standard deviation
+
+	frame      *geo.LocalFrame
+	x          vector
+	p          matrix
+	lastTime   time.Time
+	rejections int
+
+	// the prediction of the last update, kept for the smoothing, restarted
+	// when the last update reset the filter or moved its frame
+	predictedX vector
+	predictedP matrix
+	transition matrix
+	restarted  bool
+}
+
+func NewKalmanFilter() *KalmanFilter {
+	return &KalmanFilter{
+		accelerationNoise: 2,
+	}
+}
+
+// Update filters the fix d. It returns nil when d has no fix.
+func (k *KalmanFilter) Update(d *neom9n.Data) *GnssFilteredData {
+	if d.Fix != "2D" && d.Fix != "3D" {
+		return nil
+	}
+
+	if k.frame == nil || d.Timestamp.Sub(k.lastTime) > maxFilterGap || d.Timestamp.Before(k.lastTime) {
+		k.reset(d)
+		return k.output(d, false)
+	}
+
+	k.restarted = false
+	k.predict(d.Timestamp.Sub(k.lastTime).Seconds())
+	k.lastTime = d.Timestamp
+
+	z, r := k.measurement(d)
+	rejected := !k.gate(z, r)
+	if rejected {
+		k.rejections++
+		if k.rejections >= maxRejections {
+			k.reset(d)
+			return k.output(d, false)
+		}
+		return k.output(d, true)
+	}
+
+	k.rejections = 0
+	k.update(z, r)
+	k.recenter()
+	return k.output(d, false)
+}
+
+func (k *KalmanFilter) reset(d *neom9n.Data) {
+	k.frame = geo.NewLocalFrame(geo.NewCoordinate(d.Longitude, d.Latitude), 0)
+	k.lastTime = d.Timestamp
+	k.rejections = 0
+	k.restarted = true
+
+	z, r := k.measurement(d)
+	k.x = z
+	k.p = r
+}
+
+// measurement is the position and velocity of d in the local frame, with
+// their covariance. The velocity error is split along track, from the speed
+// accuracy, and across track, from the heading accuracy.
+func (k *KalmanFilter) measurement(d *neom9n.Data) (vector, matrix) {
+	position := k.frame.ToENU(geo.NewCoordinate(d.Longitude, d.Latitude), 0)
+
+	heading := geo.DegreesToRadians(d.Heading)
+	along := [2]float64{math.Sin(heading), math.Cos(heading)}
+	across := [2]float64{math.Cos(heading), -math.Sin(heading)}
+	z := vector{position.East, position.North, d.Speed * along[0], d.Speed * along[1]}
+
+	positionVariance := math.Pow(accuracy(d.HorizontalAccuracy, minPositionAccuracy), 2)
+	alongVariance := math.Pow(accuracy(d.SpeedAccuracy, minSpeedAccuracy), 2)
+	headingAccuracy := geo.DegreesToRadians(accuracy(d.HeadingAccuracy, minHeadingAccuracy))
+	acrossVariance := math.Max(math.Pow(d.Speed*headingAccuracy, 2), alongVariance)
+
+	var r matrix
+	r[0][0] = positionVariance
+	r[1][1] = positionVariance
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			r[2+i][2+j] = alongVariance*along[i]*along[j] + acrossVariance*across[i]*across[j]
+		}
+	}
+	return z, r
+}
+
+func accuracy(reported float64, min float64) float64 {
+	if reported <= 0 {
+		return defaultAccuracy
+	}
+	return math.Max(reported, min)
+}
+
+// predict moves the state dt seconds forward, the acceleration being a
+// white noise.
+func (k *KalmanFilter) predict(dt float64) {
+	f := transition(dt)
+	k.x = f.apply(k.x)
+	k.p = f.mul(k.p).mul(f.transpose()).add(processNoise(dt, k.accelerationNoise))
+
+	k.predictedX = k.x
+	k.predictedP = k.p
+	k.transition = f
+}
+
+func transition(dt float64) matrix {
+	f := identity()
+	f[0][2] = dt
+	f[1][3] = dt
+	return f
+}
+
+func processNoise(dt float64, accelerationNoise float64) matrix {
+	q := accelerationNoise * accelerationNoise
+	var m matrix
+	for i := 0; i < 2; i++ {
+		m[i][i] = q * math.Pow(dt, 4) / 4
+		m[i][i+2] = q * math.Pow(dt, 3) / 2
+		m[i+2][i] = q * math.Pow(dt, 3) / 2
+		m[i+2][i+2] = q * dt * dt
+	}
+	return m
+}
+
+// gate checks the Mahalanobis distance of the measured position to the
+// predicted one.
+func (k *KalmanFilter) gate(z vector, r matrix) bool {
+	dx := z[0] - k.x[0]
+	dy := z[1] - k.x[1]
+	a := k.p[0][0] + r[0][0]
+	b := k.p[0][1] + r[0][1]
+	c := k.p[1][0] + r[1][0]
+	d := k.p[1][1] + r[1][1]
+	det := a*d - b*c
+	if det <= 0 {
+		return true
+	}
+
+	distance := (d*dx*dx - (b+c)*dx*dy + a*dy*dy) / det
+	return distance <= gateThreshold
+}
+
+func (k *KalmanFilter) update(z vector, r matrix) {
+	s, ok := k.p.add(r).inverse()
+	if !ok {
+		return
+	}
+	gain := k.p.mul(s)
+
+	var innovation vector
+	for i := range z {
+		innovation[i] = z[i] - k.x[i]
+	}
+	correction := gain.apply(innovation)
+	for i := range k.x {
+		k.x[i] += correction[i]
+	}
+
+	// Joseph form, keeping the covariance symmetric
+	a := identity().sub(gain)
+	k.p = a.mul(k.p).mul(a.transpose()).add(gain.mul(r).mul(gain.transpose()))
+}
+
+// recenter moves the frame origin to the current position once far from it,
+// the plane approximation degrading with the distance.
+func (k *KalmanFilter) recenter() {
+	if math.Hypot(k.x[0], k.x[1]) < maxFrameDistance {
+		return
+	}
+	c, _ := k.frame.FromENU(&geo.ENU{East: k.x[0], North: k.x[1]})
+	k.frame = geo.NewLocalFrame(c, 0)
+	k.x[0] = 0
+	k.x[1] = 0
+	k.restarted = true
+}
+
+func (k *KalmanFilter) output(d *neom9n.Data, rejected bool) *GnssFilteredData {
+	return newGnssFilteredData(k.frame, k.x, k.p, d, rejected)
+}
+
+func newGnssFilteredData(frame *geo.LocalFrame, x vector, p matrix, d *neom9n.Data, rejected bool) *GnssFilteredData {
+	c, _ := frame.FromENU(&geo.ENU{East: x[0], North: x[1]})
+	speed := math.Hypot(x[2], x[3])
+
+	// the heading of a vehicle barely moving is noise
+	heading := d.Heading
+	if speed > 0.5 {
+		heading = math.Mod(geo.RadiansToDegrees(math.Atan2(x[2], x[3]))+360, 360)
+	}
+
+	return &GnssFilteredData{
+		Time:               d.Timestamp,
+		Latitude:           c.Lat,
+		Longitude:          c.Lon,
+		VelocityEast:       x[2],
+		VelocityNorth:      x[3],
+		Speed:              speed,
+		Heading:            heading,
+		HorizontalAccuracy: math.Sqrt((p[0][0] + p[1][1]) / 2),
+		SpeedAccuracy:      math.Sqrt((p[2][2] + p[3][3]) / 2),
+		Covariance:         p,
+		Rejected:           rejected,
+	}
+}
+
+func identity() matrix {
+	var m matrix
+	for i := range m {
+		m[i][i] = 1
+	}
+	return m
+}
+
+func (m matrix) apply(v vector) vector {
+	var r vector
+	for i := range m {
+		for j := range v {
+			r[i] += m[i][j] * v[j]
+		}
+	}
+	return r
+}
+
+func (m matrix) mul(o matrix) matrix {
+	var r matrix
+	for i := range m {
+		for j := range o {
+			for k := range o {
+				r[i][j] += m[i][k] * o[k][j]
+			}
+		}
+	}
+	return r
+}
+
+func (m matrix) add(o matrix) matrix {
+	for i := range m {
+		for j := range m[i] {
+			m[i][j] += o[i][j]
+		}
+	}
+	return m
+}
+
+func (m matrix) sub(o matrix) matrix {
+	for i := range m {
+		for j := range m[i] {
+			m[i][j] -= o[i][j]
+		}
+	}
+	return m
+}
+
+func (m matrix) transpose() matrix {
+	var r matrix
+	for i := range m {
+		for j := range m[i] {
+			r[j][i] = m[i][j]
+		}
+	}
+	return r
+}
+
+// inverse is the Gauss-Jordan inverse of m, false when m is singular.
+func (m matrix) inverse() (matrix, bool) {
+	r := identity()
+	for col := range m {
+		pivot := col
+		for row := col + 1; row < len(m); row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return matrix{}, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		r[col], r[pivot] = r[pivot], r[col]
+
+		scale := m[col][col]
+		for j := range m {
+			m[col][j] /= scale
+			r[col][j] /= scale
+		}
+		for row := range m {
+			if row == col {
+				continue
+			}
+			factor := m[row][col]
+			for j := range m {
+				m[row][j] -= factor * m[col][j]
+				r[row][j] -= factor * r[col][j]
+			}
+		}
+	}
+	return r, true
+}
@@ -0,0 +1,119 @@
+package gnss
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+var origin = geo.NewCoordinate(-73.4391, 45.5752)
+
+// fix is the fix at `seconds` of a vehicle driving east at 10 m/s from the
+// origin, its position off by `noise` meters east and north.
+func fix(seconds float64, noiseEast float64, noiseNorth float64) *neom9n.Data {
+	c := geo.DestinationPoint(origin, 90, 10*seconds+noiseEast)
+	c = geo.DestinationPoint(c, 0, noiseNorth)
+	return &neom9n.Data{
+		Timestamp:          start.Add(time.Duration(seconds * float64(time.Second))),
+		Fix:                "3D",
+		Latitude:           c.Lat,
+		Longitude:          c.Lon,
+		Speed:              10,
+		Heading:            90,
+		HorizontalAccuracy: 3,
+		SpeedAccuracy:      0.3,
+		HeadingAccuracy:    2,
+	}
+}
+
+func truth(seconds float64) *geo.Coordinate {
+	return geo.DestinationPoint(origin, 90, 10*seconds)
+}
+
+func TestKalmanFilter(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	k := NewKalmanFilter()
+
+	var rawError, filteredError float64
+	var filtered *GnssFilteredData
+	for i := 0; i < 300; i++ {
+		seconds := float64(i) / 10
+		d := fix(seconds, random.NormFloat64()*3, random.NormFloat64()*3)
+		filtered = k.Update(d)
+		require.NotNil(t, filtered)
+		require.False(t, filtered.Rejected)
+
+		if i >= 50 {
+			rawError += geo.Distance(truth(seconds), geo.NewCoordinate(d.Longitude, d.Latitude))
+			filteredError += geo.Distance(truth(seconds), geo.NewCoordinate(filtered.Longitude, filtered.Latitude))
+		}
+	}
+
+	require.Less(t, filteredError, rawError/2)
+	require.InDelta(t, 10, filtered.VelocityEast, 0.2)
+	require.InDelta(t, 0, filtered.VelocityNorth, 0.2)
+	require.InDelta(t, 10, filtered.Speed, 0.2)
+	require.InDelta(t, 90, filtered.Heading, 1)
+	require.Less(t, filtered.HorizontalAccuracy, 3.0)
+	require.InDelta(t, filtered.Covariance[0][2], filtered.Covariance[2][0], 1e-12)
+}
+
+func TestKalmanFilter_Gating(t *testing.T) {
+	tests := []struct {
+		name             string
+		jumps            int
+		expectedRejected []bool
+		expectedError    float64 // meters from the truth of the last output
+	}{
+		{name: "single outlier", jumps: 1, expectedRejected: []bool{true}},
+		{name: "burst of outliers", jumps: 4, expectedRejected: []bool{true, true, true, true}},
+		{name: "real jump", jumps: 5, expectedRejected: []bool{true, true, true, true, false}, expectedError: 150},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k := NewKalmanFilter()
+			for i := 0; i < 50; i++ {
+				require.False(t, k.Update(fix(float64(i)/10, 0, 0)).Rejected)
+			}
+
+			var rejected []bool
+			var filtered *GnssFilteredData
+			for i := 0; i < test.jumps; i++ {
+				seconds := float64(50+i) / 10
+				filtered = k.Update(fix(seconds, 0, 150))
+				rejected = append(rejected, filtered.Rejected)
+			}
+			require.Equal(t, test.expectedRejected, rejected)
+
+			seconds := float64(50+test.jumps-1) / 10
+			distance := geo.Distance(truth(seconds), geo.NewCoordinate(filtered.Longitude, filtered.Latitude))
+			require.InDelta(t, test.expectedError, distance, 1)
+		})
+	}
+}
+
+func TestKalmanFilter_NoFix(t *testing.T) {
+	k := NewKalmanFilter()
+	require.Nil(t, k.Update(&neom9n.Data{Timestamp: start, Fix: "none"}))
+
+	filtered := k.Update(fix(0, 0, 0))
+	require.InDelta(t, origin.Lat, filtered.Latitude, 1e-9)
+	require.InDelta(t, origin.Lon, filtered.Longitude, 1e-9)
+	require.InDelta(t, 3, filtered.HorizontalAccuracy, 1e-9)
+}
+
+func TestKalmanFilter_Recenter(t *testing.T) {
+	k := NewKalmanFilter()
+	for i := 0; i < 1200; i++ {
+		filtered := k.Update(fix(float64(i), 0, 0))
+		require.Less(t, geo.Distance(truth(float64(i)), geo.NewCoordinate(filtered.Longitude, filtered.Latitude)), 0.5)
+	}
+	require.Less(t, math.Hypot(k.x[0], k.x[1]), maxFrameDistance)
+}
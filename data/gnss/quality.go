@@ -0,0 +1,193 @@
+package gnss
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+const (
+	VerdictGood     = "good"
+	VerdictFlagged  = "flagged"
+	VerdictRejected = "rejected"
+	VerdictNoFix    = "no_fix"
+)
+
+// Quality is the verdict of the QualityGate on a fix, with the reasons it was
+// flagged or rejected, comma separated.
+type Quality struct {
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RawPosition is the position reported by the receiver, before filtering.
+type RawPosition struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// QualifiedData is a fix annotated with its quality, logged with the fix
+// fields at the top level, its position being the filtered one, the raw
+// position under "raw", the filtered state under "filtered" and the quality
+// under "quality".
+type QualifiedData struct {
+	*neom9n.Data
+	Raw      *RawPosition      `json:"raw,omitempty"`
+	Filtered *GnssFilteredData `json:"filtered,omitempty"`
+	Quality  *Quality          `json:"quality,omitempty"`
+}
+
+// NewQualifiedData annotates d, raw being nil when d was not filtered.
+func NewQualifiedData(d *neom9n.Data, raw *neom9n.Data, filtered *GnssFilteredData, quality *Quality) *QualifiedData {
+	q := &QualifiedData{Data: d, Filtered: filtered, Quality: quality}
+	if raw != nil {
+		q.Raw = &RawPosition{Latitude: raw.Latitude, Longitude: raw.Longitude}
+	}
+	return q
+}
+
+type QualityOption func(*QualityGate)
+
+// WithMaxImpliedSpeed sets the speed, in m/s, over which the distance from the
+// previous fix is a jump and the fix is rejected.
+func WithMaxImpliedSpeed(speed float64) QualityOption {
+	return func(g *QualityGate) {
+		g.maxImpliedSpeed = speed
+	}
+}
+
+// WithMaxAcceleration sets the speed change, in m/s², over which the fix is
+// flagged.
+func WithMaxAcceleration(acceleration float64) QualityOption {
+	return func(g *QualityGate) {
+		g.maxAcceleration = acceleration
+	}
+}
+
+// WithMaxHorizontalAccuracy sets the horizontal accuracy, in meters, over
+// which the fix is rejected.
+func WithMaxHorizontalAccuracy(accuracy float64) QualityOption {
+	return func(g *QualityGate) {
+		g.maxHorizontalAccuracy = accuracy
+	}
+}
+
+// WithMaxHDop sets the horizontal dilution of precision over which the fix is
+// flagged.
+func WithMaxHDop(hdop float64) QualityOption {
+	return func(g *QualityGate) {
+		g.maxHDop = hdop
+	}
+}
+
+// WithMinSatellites sets the number of satellites used under which the fix is
+// flagged.
+func WithMinSatellites(satellites int) QualityOption {
+	return func(g *QualityGate) {
+		g.minSatellites = satellites
+	}
+}
+
+// QualityGate judges each fix on its own (accuracy, dilution of precision,
+// satellites used, jamming) and against the previous accepted fix (implied
+// speed and acceleration). A rejected fix is not used as the previous one,
+// unless maxRejections jumps in a row show the previous one was the outlier.
+type QualityGate struct {
+	maxImpliedSpeed       float64
+	maxAcceleration       float64
+	maxHorizontalAccuracy float64
+	maxHDop               float64
+	minSatellites         int
+
+	previous   *neom9n.Data
+	rejections int
+}
+
+func NewQualityGate(opts ...QualityOption) *QualityGate {
+	g := &QualityGate{
+		maxImpliedSpeed:       70,
+		maxAcceleration:       10,
+		maxHorizontalAccuracy: 50,
+		maxHDop:               5,
+		minSatellites:         6,
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+func (g *QualityGate) Check(d *neom9n.Data) *Quality {
+	if d.Fix != "2D" && d.Fix != "3D" {
+		return &Quality{Verdict: VerdictNoFix}
+	}
+
+	var rejections, flags []string
+	if d.HorizontalAccuracy > g.maxHorizontalAccuracy {
+		rejections = append(rejections, fmt.Sprintf("horizontal accuracy %.1fm", d.HorizontalAccuracy))
+	}
+	if d.Dop != nil && d.Dop.HDop > g.maxHDop {
+		flags = append(flags, fmt.Sprintf("hdop %.1f", d.Dop.HDop))
+	}
+	if d.Satellites != nil && d.Satellites.Used < g.minSatellites {
+		flags = append(flags, fmt.Sprintf("%d satellites used", d.Satellites.Used))
+	}
+	if d.RF != nil {
+		switch d.RF.JammingState {
+		case "critical":
+			rejections = append(rejections, "jamming critical")
+		case "warning":
+			flags = append(flags, "jamming warning")
+		}
+	}
+
+	jumped := false
+	if g.previous != nil {
+		dt := d.Timestamp.Sub(g.previous.Timestamp).Seconds()
+		if dt > 0 {
+			// the accuracies are slack, a fix within them did not jump
+			distance := geo.Distance(geo.NewCoordinate(g.previous.Longitude, g.previous.Latitude), geo.NewCoordinate(d.Longitude, d.Latitude))
+			impliedSpeed := (distance - d.HorizontalAccuracy - g.previous.HorizontalAccuracy) / dt
+			if impliedSpeed > g.maxImpliedSpeed {
+				jumped = true
+				rejections = append(rejections, fmt.Sprintf("implied speed %.1fm/s", impliedSpeed))
+			}
+
+			acceleration := (d.Speed - g.previous.Speed) / dt
+			if acceleration > g.maxAcceleration || -acceleration > g.maxAcceleration {
+				flags = append(flags, fmt.Sprintf("acceleration %.1fm/s²", acceleration))
+			}
+		}
+	}
+
+	if jumped {
+		g.rejections++
+		if g.rejections >= maxRejections && len(rejections) == 1 {
+			g.rejections = 0
+			g.keep(d)
+			return &Quality{Verdict: VerdictFlagged, Reason: strings.Join(append(flags, "position reset after jumps"), ", ")}
+		}
+	} else {
+		g.rejections = 0
+	}
+
+	if len(rejections) > 0 {
+		return &Quality{Verdict: VerdictRejected, Reason: strings.Join(append(rejections, flags...), ", ")}
+	}
+
+	g.keep(d)
+	if len(flags) > 0 {
+		return &Quality{Verdict: VerdictFlagged, Reason: strings.Join(flags, ", ")}
+	}
+	return &Quality{Verdict: VerdictGood}
+}
+
+// keep copies d, the filtering overwriting its position.
+func (g *QualityGate) keep(d *neom9n.Data) {
+	previous := *d
+	g.previous = &previous
+}
@@ -0,0 +1,96 @@
+package gnss
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/stretchr/testify/require"
+)
+
+func goodFix(seconds float64, meters float64, speed float64) *neom9n.Data {
+	c := geo.DestinationPoint(origin, 90, meters)
+	return &neom9n.Data{
+		Timestamp:          start.Add(time.Duration(seconds * float64(time.Second))),
+		Fix:                "3D",
+		Latitude:           c.Lat,
+		Longitude:          c.Lon,
+		Speed:              speed,
+		HorizontalAccuracy: 2,
+		Dop:                &neom9n.Dop{HDop: 0.8},
+		Satellites:         &neom9n.Satellites{Seen: 20, Used: 12},
+		RF:                 &neom9n.RF{JammingState: "ok"},
+	}
+}
+
+func TestQualityGate(t *testing.T) {
+	tests := []struct {
+		name     string
+		fix      func(d *neom9n.Data)
+		expected *Quality
+	}{
+		{name: "good", fix: func(d *neom9n.Data) {}, expected: &Quality{Verdict: VerdictGood}},
+		{name: "no fix", fix: func(d *neom9n.Data) { d.Fix = "none" }, expected: &Quality{Verdict: VerdictNoFix}},
+		{
+			name:     "inaccurate",
+			fix:      func(d *neom9n.Data) { d.HorizontalAccuracy = 80 },
+			expected: &Quality{Verdict: VerdictRejected, Reason: "horizontal accuracy 80.0m"},
+		},
+		{
+			name: "poor geometry",
+			fix: func(d *neom9n.Data) {
+				d.Dop.HDop = 7.5
+				d.Satellites.Used = 4
+			},
+			expected: &Quality{Verdict: VerdictFlagged, Reason: "hdop 7.5, 4 satellites used"},
+		},
+		{
+			name:     "jamming warning",
+			fix:      func(d *neom9n.Data) { d.RF.JammingState = "warning" },
+			expected: &Quality{Verdict: VerdictFlagged, Reason: "jamming warning"},
+		},
+		{
+			name:     "jamming critical",
+			fix:      func(d *neom9n.Data) { d.RF.JammingState = "critical" },
+			expected: &Quality{Verdict: VerdictRejected, Reason: "jamming critical"},
+		},
+		{
+			name: "jump",
+			fix: func(d *neom9n.Data) {
+				c := geo.DestinationPoint(origin, 0, 100)
+				d.Latitude = c.Lat
+				d.Longitude = c.Lon
+			},
+			expected: &Quality{Verdict: VerdictRejected, Reason: "implied speed 960.0m/s"},
+		},
+		{
+			name:     "hard acceleration",
+			fix:      func(d *neom9n.Data) { d.Speed = 12 },
+			expected: &Quality{Verdict: VerdictFlagged, Reason: "acceleration 20.0m/s²"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewQualityGate()
+			require.Equal(t, &Quality{Verdict: VerdictGood}, g.Check(goodFix(0, 0, 10)))
+
+			d := goodFix(0.1, 1, 10)
+			test.fix(d)
+			require.Equal(t, test.expected, g.Check(d))
+		})
+	}
+}
+
+func TestQualityGate_Jumps(t *testing.T) {
+	g := NewQualityGate()
+	require.Equal(t, VerdictGood, g.Check(goodFix(0, 0, 10)).Verdict)
+
+	// the first fix was the outlier, the following ones agree with each other
+	var verdicts []string
+	for i := 1; i <= 6; i++ {
+		verdicts = append(verdicts, g.Check(goodFix(float64(i)/10, 500+float64(i), 10)).Verdict)
+	}
+	require.Equal(t, []string{VerdictRejected, VerdictRejected, VerdictRejected, VerdictRejected, VerdictFlagged, VerdictGood}, verdicts)
+}
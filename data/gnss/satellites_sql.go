@@ -0,0 +1,158 @@
+package gnss
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+
+	"github.com/daedaleanai/ublox/ubx"
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+)
+
+const SatellitesCreateTable string = `
+	CREATE TABLE IF NOT EXISTS gnss_satellites (
+		id INTEGER NOT NULL PRIMARY KEY,
+		gnss_system_time TIMESTAMP NOT NULL,
+		gnss_time TIMESTAMP NOT NULL,
+		gnss_id INTEGER NOT NULL,
+		constellation TEXT NOT NULL,
+		sv_id INTEGER NOT NULL,
+		cno INTEGER NOT NULL,
+		pseudorange_rate REAL NOT NULL,
+		multipath INTEGER NOT NULL
+	);
+	create index if not exists gnss_satellites_gnss_system_time_idx on gnss_satellites(gnss_system_time);
+`
+
+const insertSatelliteQuery string = `INSERT INTO gnss_satellites VALUES`
+
+const insertSatelliteFields string = `(NULL,?,?,?,?,?,?,?,?),`
+
+const satellitesPurgeQuery string = `
+	DELETE FROM gnss_satellites WHERE gnss_system_time < ?;
+`
+
+const satellitesQuery string = `
+	SELECT cast(gnss_system_time as text), gnss_id, sv_id, cno, pseudorange_rate, multipath
+	FROM gnss_satellites
+	WHERE gnss_system_time >= ? AND gnss_system_time <= ?
+	ORDER BY gnss_system_time ASC, id ASC;
+`
+
+func SatellitesCreateTableQuery() string {
+	return SatellitesCreateTable
+}
+
+func SatellitesPurgeQuery() string {
+	return satellitesPurgeQuery
+}
+
+// pseudorangeRateScale is the m/s of a unit of the RXM-MEASX pseudorange rate,
+// DopplerMS_m_s.
+const pseudorangeRateScale = 0.04
+
+var constellations = map[byte]string{
+	0: "GPS",
+	1: "SBAS",
+	2: "Galileo",
+	3: "BeiDou",
+	4: "IMES",
+	5: "QZSS",
+	6: "GLONASS",
+}
+
+// Constellation is the name of the constellation of a ubx gnssId.
+func Constellation(gnssID byte) string {
+	if name, found := constellations[gnssID]; found {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", gnssID)
+}
+
+// SatelliteSqlWrapper logs one satellite of the RXM-MEASX measurements of a
+// gnss epoch, the epoch being keyed by the gnss data system time as in
+// imu_raw.
+type SatelliteSqlWrapper struct {
+	data      *neom9n.Data
+	gnssID    byte
+	svID      byte
+	cno       byte
+	doppler   int32
+	multipath byte
+}
+
+// NewSatelliteSqlWrappers are the satellites of the RXM-MEASX measurements of
+// data, none when it has no measurements.
+func NewSatelliteSqlWrappers(data *neom9n.Data) []*SatelliteSqlWrapper {
+	if data.RxmMeasx == nil {
+		return nil
+	}
+
+	wrappers := make([]*SatelliteSqlWrapper, 0, len(data.RxmMeasx.SV))
+	for _, sv := range data.RxmMeasx.SV {
+		wrappers = append(wrappers, &SatelliteSqlWrapper{
+			data:      data,
+			gnssID:    sv.GnssId,
+			svID:      sv.SvId,
+			cno:       sv.CNo,
+			doppler:   sv.DopplerMS_m_s,
+			multipath: sv.MpathIndic,
+		})
+	}
+	return wrappers
+}
+
+func (w *SatelliteSqlWrapper) InsertQuery() (string, string, []any) {
+	return insertSatelliteQuery, insertSatelliteFields, []any{
+		w.data.SystemTime.Format("2006-01-02 15:04:05.99999"),
+		w.data.Timestamp.Format("2006-01-02 15:04:05.99999"),
+		w.gnssID,
+		Constellation(w.gnssID),
+		w.svID,
+		w.cno,
+		float64(w.doppler) * pseudorangeRateScale,
+		w.multipath,
+	}
+}
+
+// ReadSatellites rebuilds the RXM-MEASX measurements of the epochs with a gnss
+// system time between from and to, keyed by the gnss system time as stored.
+// Only the logged fields of the satellites are set.
+func ReadSatellites(ctx context.Context, db *sql.DB, from string, to string) (map[string]*ubx.RxmMeasx, error) {
+	rows, err := db.QueryContext(ctx, satellitesQuery, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("querying satellites from %s to %s: %w", from, to, err)
+	}
+	defer rows.Close()
+
+	epochs := map[string]*ubx.RxmMeasx{}
+	for rows.Next() {
+		var systemTime string
+		var gnssID, svID, cno, multipath byte
+		var pseudorangeRate float64
+		err := rows.Scan(&systemTime, &gnssID, &svID, &cno, &pseudorangeRate, &multipath)
+		if err != nil {
+			return nil, fmt.Errorf("scanning satellite: %w", err)
+		}
+
+		measx := epochs[systemTime]
+		if measx == nil {
+			measx = &ubx.RxmMeasx{}
+			epochs[systemTime] = measx
+		}
+		measx.SV = append(measx.SV, &ubx.RxmMeasxSVType{
+			GnssId:        gnssID,
+			SvId:          svID,
+			CNo:           cno,
+			MpathIndic:    multipath,
+			DopplerMS_m_s: int32(math.Round(pseudorangeRate / pseudorangeRateScale)),
+		})
+		measx.NumSV++
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating satellites: %w", err)
+	}
+	return epochs, nil
+}
@@ -0,0 +1,64 @@
+package gnss
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const SmoothedCreateTable string = `
+	CREATE TABLE IF NOT EXISTS gnss_smoothed (
+		id INTEGER NOT NULL PRIMARY KEY,
+		time TIMESTAMP NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		velocity_east REAL NOT NULL,
+		velocity_north REAL NOT NULL,
+		speed REAL NOT NULL,
+		heading REAL NOT NULL,
+		horizontal_accuracy REAL NOT NULL,
+		speed_accuracy REAL NOT NULL
+	);
+	create index if not exists gnss_smoothed_time_idx on gnss_smoothed(time);
+`
+
+const insertSmoothedQuery string = `
+	INSERT INTO gnss_smoothed VALUES(NULL,?,?,?,?,?,?,?,?,?);
+`
+
+func SmoothedCreateTableQuery() string {
+	return SmoothedCreateTable
+}
+
+// WriteSmoothedTrack replaces the track of the gnss_smoothed table.
+func WriteSmoothedTrack(sqlite *logger.Sqlite, track []*GnssFilteredData) error {
+	err := sqlite.Exec(SmoothedCreateTable)
+	if err != nil {
+		return fmt.Errorf("creating gnss_smoothed table: %w", err)
+	}
+	err = sqlite.Exec("DELETE FROM gnss_smoothed")
+	if err != nil {
+		return fmt.Errorf("clearing gnss_smoothed table: %w", err)
+	}
+
+	params := make([][]any, len(track))
+	for i, s := range track {
+		params[i] = []any{
+			s.Time.Format("2006-01-02 15:04:05.99999"),
+			s.Latitude,
+			s.Longitude,
+			s.VelocityEast,
+			s.VelocityNorth,
+			s.Speed,
+			s.Heading,
+			s.HorizontalAccuracy,
+			s.SpeedAccuracy,
+		}
+	}
+
+	err = sqlite.ExecBatch(insertSmoothedQuery, params)
+	if err != nil {
+		return fmt.Errorf("inserting smoothed track: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package gnss
+
+import (
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+type smootherStep struct {
+	d          *neom9n.Data
+	frame      *geo.LocalFrame
+	x          vector
+	p          matrix
+	predictedX vector
+	predictedP matrix
+	transition matrix
+	restarted  bool
+	rejected   bool
+}
+
+// Smoother smooths a whole recorded trajectory: the fixes go through the
+// KalmanFilter forward, then a Rauch-Tung-Striebel backward pass corrects
+// each state with the ones following it. A reset of the filter, after a gap
+// or a jump, splits the trajectory in segments smoothed on their own.
+type Smoother struct {
+	filter *KalmanFilter
+	steps  []*smootherStep
+}
+
+func NewSmoother() *Smoother {
+	return &Smoother{filter: NewKalmanFilter()}
+}
+
+func (s *Smoother) HandleGnssData(d *neom9n.Data) error {
+	if len(s.steps) > 0 && !d.Timestamp.After(s.steps[len(s.steps)-1].d.Timestamp) {
+		return nil
+	}
+
+	filtered := s.filter.Update(d)
+	if filtered == nil {
+		return nil
+	}
+
+	k := s.filter
+	s.steps = append(s.steps, &smootherStep{
+		d:          d,
+		frame:      k.frame,
+		x:          k.x,
+		p:          k.p,
+		predictedX: k.predictedX,
+		predictedP: k.predictedP,
+		transition: k.transition,
+		restarted:  k.restarted,
+		rejected:   filtered.Rejected,
+	})
+	return nil
+}
+
+// Smooth returns the smoothed state of each fix handled.
+func (s *Smoother) Smooth() []*GnssFilteredData {
+	smoothed := make([]*GnssFilteredData, len(s.steps))
+
+	end := len(s.steps) - 1
+	for end >= 0 {
+		step := s.steps[end]
+		x, p := step.x, step.p
+		smoothed[end] = newGnssFilteredData(step.frame, x, p, step.d, step.rejected)
+
+		i := end - 1
+		for ; i >= 0 && !s.steps[i+1].restarted; i-- {
+			step, next := s.steps[i], s.steps[i+1]
+			inverse, ok := next.predictedP.inverse()
+			if !ok {
+				x, p = step.x, step.p
+			} else {
+				gain := step.p.mul(next.transition.transpose()).mul(inverse)
+
+				var difference vector
+				for j := range x {
+					difference[j] = x[j] - next.predictedX[j]
+				}
+				correction := gain.apply(difference)
+				for j := range x {
+					x[j] = step.x[j] + correction[j]
+				}
+				p = step.p.add(gain.mul(p.sub(next.predictedP)).mul(gain.transpose()))
+			}
+			smoothed[i] = newGnssFilteredData(step.frame, x, p, step.d, step.rejected)
+		}
+		end = i
+	}
+
+	return smoothed
+}
@@ -0,0 +1,85 @@
+package gnss
+
+import (
+	"database/sql"
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmoother(t *testing.T) {
+	tests := []struct {
+		name string
+		gap  bool
+	}{
+		{name: "single segment"},
+		{name: "segments split by a gap", gap: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			random := rand.New(rand.NewSource(1))
+			s := NewSmoother()
+			k := NewKalmanFilter()
+
+			var seconds []float64
+			var filtered []*GnssFilteredData
+			for i := 0; i < 400; i++ {
+				second := float64(i) / 10
+				if test.gap && i >= 200 {
+					second += 30
+				}
+				d := fix(second, random.NormFloat64()*3, random.NormFloat64()*3)
+				require.NoError(t, s.HandleGnssData(d))
+				require.NoError(t, s.HandleGnssData(d), "a fix handled twice is ignored")
+				filtered = append(filtered, k.Update(d))
+				seconds = append(seconds, second)
+			}
+
+			smoothed := s.Smooth()
+			require.Len(t, smoothed, len(filtered))
+			require.Equal(t, filtered[len(filtered)-1], smoothed[len(smoothed)-1], "the last state is the filtered one")
+
+			var filteredError, smoothedError float64
+			for i := range smoothed {
+				require.Equal(t, filtered[i].Time, smoothed[i].Time)
+				truth := truth(seconds[i])
+				filteredError += geo.Distance(truth, geo.NewCoordinate(filtered[i].Longitude, filtered[i].Latitude))
+				smoothedError += geo.Distance(truth, geo.NewCoordinate(smoothed[i].Longitude, smoothed[i].Latitude))
+				require.LessOrEqual(t, smoothed[i].HorizontalAccuracy, filtered[i].HorizontalAccuracy+1e-9)
+			}
+			require.Less(t, smoothedError, filteredError*0.8)
+
+			if test.gap {
+				// the segment end before the gap is not smoothed with the fixes after it
+				require.Equal(t, filtered[199], smoothed[199])
+			}
+		})
+	}
+}
+
+func TestWriteSmoothedTrack(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "smoothed.db"), nil, nil)
+	require.NoError(t, sqlite.Init(0))
+
+	track := []*GnssFilteredData{
+		{Time: start, Latitude: 45.5, Longitude: -73.4, Speed: 10},
+		{Time: start.Add(time.Second), Latitude: 45.6, Longitude: -73.5, Speed: 11},
+	}
+	require.NoError(t, WriteSmoothedTrack(sqlite, track))
+	require.NoError(t, WriteSmoothedTrack(sqlite, track[1:]), "the track is replaced")
+
+	var latitudes []float64
+	require.NoError(t, sqlite.Query(false, "SELECT latitude FROM gnss_smoothed ORDER BY time", func(rows *sql.Rows) error {
+		var latitude float64
+		err := rows.Scan(&latitude)
+		latitudes = append(latitudes, latitude)
+		return err
+	}, nil))
+	require.Equal(t, []float64{45.6}, latitudes)
+}
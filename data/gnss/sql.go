@@ -9,49 +9,64 @@ import (
 )
 
 const GnssCreateTable string = `
-  CREATE TABLE IF NOT EXISTS gnss (
-  	id INTEGER NOT NULL PRIMARY KEY,
-  	time TIMESTAMP NOT NULL,
-  	system_time TIMESTAMP NOT NULL,
-	fix TEXT NOT NULL,
-	Eph INTEGER NOT NULL,
-	Sep INTEGER NOT NULL,
-	latitude REAL NOT NULL,
-	longitude REAL NOT NULL,
-	altitude REAL NOT NULL,
-	heading REAL NOT NULL,
-	speed REAL NOT NULL,
-	gdop REAL NOT NULL,
-	hdop REAL NOT NULL,
-	pdop REAL NOT NULL,
-	tdop REAL NOT NULL,
-	vdop REAL NOT NULL,
-	xdop REAL NOT NULL,
-	ydop REAL NOT NULL,
-	seen INTEGER NOT NULL,
-	used INTEGER NOT NULL,
-	ttff INTEGER NOT NULL,
-	rf_jamming_state STRING NOT NULL,
-	rf_ant_status STRING NOT NULL,
-	rf_ant_power STRING NOT NULL,
-	rf_post_status INTEGER NOT NULL,
-	rf_noise_per_ms INTEGER NOT NULL,
-	rf_agc_cnt INTEGER NOT NULL,
-	rf_jam_ind INTEGER NOT NULL,
-	rf_ofsi INTEGER NOT NULL,
-	rf_magif INTEGER NOT NULL,
-	rf_ofsq INTEGER NOT NULL,
-	rf_magq INTEGER NOT NULL
-  );
-	create index if not exists gnss_time_idx on gnss(time);
+	CREATE TABLE IF NOT EXISTS gnss (
+		id INTEGER NOT NULL PRIMARY KEY,
+		system_time TIMESTAMP NOT NULL,
+		time TIMESTAMP NOT NULL,
+		fix TEXT NOT NULL,
+		ttff INTEGER NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		raw_latitude REAL NOT NULL,
+		raw_longitude REAL NOT NULL,
+		altitude REAL NOT NULL,
+		speed REAL NOT NULL,
+		heading REAL NOT NULL,
+		satellites_seen INTEGER NOT NULL,
+		satellites_used INTEGER NOT NULL,
+		eph INTEGER NOT NULL,
+		sep REAL NOT NULL,
+		horizontal_accuracy REAL NOT NULL,
+		vertical_accuracy REAL NOT NULL,
+		heading_accuracy REAL NOT NULL,
+		speed_accuracy REAL NOT NULL,
+		dop_h REAL NOT NULL,
+		dop_v REAL NOT NULL,
+		dop_x REAL NOT NULL,
+		dop_y REAL NOT NULL,
+		dop_t REAL NOT NULL,
+		dop_p REAL NOT NULL,
+		dop_g REAL NOT NULL,
+		rf_jamming_state TEXT NOT NULL,
+		rf_ant_status TEXT NOT NULL,
+		rf_ant_power TEXT NOT NULL,
+		rf_post_status INTEGER NOT NULL,
+		rf_noise_per_ms INTEGER NOT NULL,
+		rf_agc_cnt INTEGER NOT NULL,
+		rf_jam_ind INTEGER NOT NULL,
+		rf_ofs_i INTEGER NOT NULL,
+		rf_mag_i INTEGER NOT NULL,
+		rf_ofs_q INTEGER NOT NULL,
+		rf_mag_q INTEGER NOT NULL,
+		gga TEXT NOT NULL
+	);
+	create index if not exists gnss_system_time_idx on gnss(system_time);
 `
 
-const insertQuery string = `
-	INSERT INTO gnss VALUES(NULL,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);
-`
+const insertQuery string = `INSERT INTO gnss VALUES`
+
+const insertFields string = `(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?),`
 
+// purgeQuery keeps the fixes still referenced by the imu rows, the last fix
+// before a long fix loss being older than the rows following it.
 const purgeQuery string = `
-	DELETE FROM gnss WHERE time < ?;
+	DELETE FROM gnss WHERE system_time < ?
+		AND NOT EXISTS (SELECT 1 FROM imu_raw_samples WHERE imu_raw_samples.gnss_id = gnss.id)
+		AND NOT EXISTS (SELECT 1 FROM merged_samples WHERE merged_samples.gnss_id = gnss.id);
+`
+
+const lastIDQuery string = `
+	SELECT coalesce(max(id), 0) FROM gnss;
 `
 
 const lastPositionQuery string = `
@@ -61,47 +76,49 @@ const lastPositionQuery string = `
 	ORDER BY time DESC LIMIT 1;
 `
 
+// SqlWrapper logs a fix once, the imu rows referencing it by id. The ids are
+// allocated by the caller, following LastID, so the rows referencing a fix can
+// be logged before it is written.
 type SqlWrapper struct {
+	id   int64
 	data *neom9n.Data
+	raw  *neom9n.Data
 }
 
-func NewSqlWrapper(data *neom9n.Data) *SqlWrapper {
-	return &SqlWrapper{data: data}
-}
-
-var gnssPrepareStatement *sql.Stmt
-
-func (s *SqlWrapper) InitGnss(db *sql.DB) error {
-	stmt, err := db.Prepare(insertQuery)
-	if err != nil {
-		return fmt.Errorf("preparing statement for inserting gnss data: %w", err)
-	}
-	gnssPrepareStatement = stmt
-	return nil
+// NewSqlWrapper logs data with id, the raw position of which is raw's.
+func NewSqlWrapper(id int64, data *neom9n.Data, raw *neom9n.Data) *SqlWrapper {
+	return &SqlWrapper{id: id, data: data, raw: raw}
 }
 
-func (s *SqlWrapper) InsertQuery() (*sql.Stmt, []any) {
-	return gnssPrepareStatement, []any{
-		s.data.Timestamp.Format("2006-01-02 15:04:05.99999"),
+func (s *SqlWrapper) InsertQuery() (string, string, []any) {
+	return insertQuery, insertFields, []any{
+		s.id,
 		s.data.SystemTime.Format("2006-01-02 15:04:05.99999"),
+		s.data.Timestamp.Format("2006-01-02 15:04:05.99999"),
 		s.data.Fix,
-		s.data.Eph,
-		s.data.Sep,
+		s.data.Ttff,
 		s.data.Latitude,
 		s.data.Longitude,
+		s.raw.Latitude,
+		s.raw.Longitude,
 		s.data.Altitude,
-		s.data.Heading,
 		s.data.Speed,
-		s.data.Dop.GDop,
+		s.data.Heading,
+		s.data.Satellites.Seen,
+		s.data.Satellites.Used,
+		s.data.Eph,
+		s.data.Sep,
+		s.data.HorizontalAccuracy,
+		s.data.VerticalAccuracy,
+		s.data.HeadingAccuracy,
+		s.data.SpeedAccuracy,
 		s.data.Dop.HDop,
-		s.data.Dop.PDop,
-		s.data.Dop.TDop,
 		s.data.Dop.VDop,
 		s.data.Dop.XDop,
 		s.data.Dop.YDop,
-		s.data.Satellites.Seen,
-		s.data.Satellites.Used,
-		s.data.Ttff,
+		s.data.Dop.TDop,
+		s.data.Dop.PDop,
+		s.data.Dop.GDop,
 		s.data.RF.JammingState,
 		s.data.RF.AntStatus,
 		s.data.RF.AntPower,
@@ -113,6 +130,7 @@ func (s *SqlWrapper) InsertQuery() (*sql.Stmt, []any) {
 		s.data.RF.MagI,
 		s.data.RF.OfsQ,
 		s.data.RF.MagQ,
+		s.data.GGA,
 	}
 }
 
@@ -124,6 +142,18 @@ func PurgeQuery() string {
 	return purgeQuery
 }
 
+// LastID is the id of the last fix logged, 0 when none was.
+func LastID(sqlite *logger.Sqlite) (int64, error) {
+	var id int64
+	err := sqlite.Query(false, lastIDQuery, func(rows *sql.Rows) error {
+		return rows.Scan(&id)
+	}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("querying last gnss id: %w", err)
+	}
+	return id, nil
+}
+
 func GetLastPosition(sqlite *logger.Sqlite) (*neom9n.Position, error) {
 	fmt.Println("getting last position")
 
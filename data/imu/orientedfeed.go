@@ -40,34 +40,35 @@ type OrientedAccelerationHandler func(corrected *Acceleration, tiltAngles *TiltA
 type OrientedAccelerationFeed struct {
 	orientationCounter OrientationCounter
 	handlers           []OrientedAccelerationHandler
+
+	counter              int
+	lastOrientation      Orientation
+	lastKnownOrientation Orientation
+	first                bool
 }
 
 func NewOrientedAccelerationFeed(handlers ...OrientedAccelerationHandler) *OrientedAccelerationFeed {
 	return &OrientedAccelerationFeed{
-		orientationCounter: make(OrientationCounter),
-		handlers:           handlers,
+		orientationCounter:   make(OrientationCounter),
+		handlers:             handlers,
+		lastOrientation:      OrientationUnset,
+		lastKnownOrientation: OrientationUnset,
+		first:                true,
 	}
 }
 
-var g = 0
-var counter = 0
-var lastOrientation = OrientationUnset
-var lastKnownOrientation = OrientationUnset
-var first = true
-
 func (f *OrientedAccelerationFeed) HandleTiltCorrectedAcceleration(acceleration *Acceleration, tiltAngles *TiltAngles, temperature iim42652.Temperature) error {
 	//todo: stop lock for orientation when confident
-	if first {
-		first = false
+	if f.first {
+		f.first = false
 		fmt.Println("First orientation event:", acceleration.Time)
 
 	}
-	//g += 1
 	newOrientation := computeOrientation(acceleration)
-	//fmt.Println("Orientation:", newOrientation, "???", f.orientationCounter.Orientation(), counter)
-	if lastKnownOrientation != f.orientationCounter.Orientation() {
-		lastKnownOrientation = f.orientationCounter.Orientation()
-		fmt.Println("Orientation changed:", lastKnownOrientation, acceleration.Time, f.orientationCounter)
+	//fmt.Println("Orientation:", newOrientation, "???", f.orientationCounter.Orientation(), f.counter)
+	if f.lastKnownOrientation != f.orientationCounter.Orientation() {
+		f.lastKnownOrientation = f.orientationCounter.Orientation()
+		fmt.Println("Orientation changed:", f.lastKnownOrientation, acceleration.Time, f.orientationCounter)
 	}
 
 	if f.orientationCounter.Orientation() != OrientationUnset {
@@ -85,23 +86,23 @@ func (f *OrientedAccelerationFeed) HandleTiltCorrectedAcceleration(acceleration
 	}
 
 	if newOrientation == OrientationUnset {
-		lastOrientation = OrientationUnset
-		counter = 0
+		f.lastOrientation = OrientationUnset
+		f.counter = 0
 		return nil
 	}
 
-	if newOrientation != lastOrientation && lastOrientation != OrientationUnset {
-		lastOrientation = newOrientation
-		counter = 0
+	if newOrientation != f.lastOrientation && f.lastOrientation != OrientationUnset {
+		f.lastOrientation = newOrientation
+		f.counter = 0
 		return nil
 	}
 
-	counter++
-	if counter > 20 {
+	f.counter++
+	if f.counter > 20 {
 		f.orientationCounter.Increment(newOrientation)
 	}
 
-	lastOrientation = newOrientation
+	f.lastOrientation = newOrientation
 
 	return nil
 }
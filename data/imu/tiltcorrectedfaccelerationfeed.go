@@ -15,6 +15,12 @@ type TiltCorrectedAccelerationFeed struct {
 	zAngleCalibrated *data.AverageFloat64
 	calibrated       bool
 	handlers         []TiltCorrectedAccelerationHandler
+
+	continuousCount int
+	xAvg            *data.AverageFloat64
+	yAvg            *data.AverageFloat64
+	zAvg            *data.AverageFloat64
+	first           bool
 }
 
 type TiltCorrectedAccelerationHandler func(corrected *Acceleration, tiltAngles *TiltAngles, temperature iim42652.Temperature) error
@@ -25,46 +31,43 @@ func NewTiltCorrectedAccelerationFeed(handlers ...TiltCorrectedAccelerationHandl
 		yAngleCalibrated: data.NewAverageFloat64WithCount("angleY", 100),
 		zAngleCalibrated: data.NewAverageFloat64WithCount("angleZ", 100),
 		handlers:         handlers,
+		xAvg:             data.NewAverageFloat64WithCount("", 30),
+		yAvg:             data.NewAverageFloat64WithCount("", 30),
+		zAvg:             data.NewAverageFloat64WithCount("", 30),
+		first:            true,
 	}
 
 	return f
 }
 
-var continuousCount = 0
-var xAvg = *data.NewAverageFloat64WithCount("", 30)
-var yAvg = *data.NewAverageFloat64WithCount("", 30)
-var zAvg = *data.NewAverageFloat64WithCount("", 30)
-
-var afirst = true
-
 func (f *TiltCorrectedAccelerationFeed) calibrate(acceleration *Acceleration) bool {
 	magnitude := acceleration.Magnitude
 
-	if afirst {
-		afirst = false
+	if f.first {
+		f.first = false
 		fmt.Println("first tilt handling", acceleration.Time)
 	}
 
 	if magnitude > 0.96 && magnitude < 1.04 {
-		continuousCount++
+		f.continuousCount++
 		xAngle, yAngle, zAngle := computeTiltAngles(acceleration)
-		xAvg.Add(xAngle)
-		yAvg.Add(yAngle)
-		zAvg.Add(zAngle)
-		if continuousCount > 30 {
-			f.xAngleCalibrated.Add(xAvg.Average)
-			f.yAngleCalibrated.Add(yAvg.Average)
-			f.zAngleCalibrated.Add(zAvg.Average)
+		f.xAvg.Add(xAngle)
+		f.yAvg.Add(yAngle)
+		f.zAvg.Add(zAngle)
+		if f.continuousCount > 30 {
+			f.xAngleCalibrated.Add(f.xAvg.Average)
+			f.yAngleCalibrated.Add(f.yAvg.Average)
+			f.zAngleCalibrated.Add(f.zAvg.Average)
 			if !f.calibrated {
 				fmt.Println("calibrated", f.xAngleCalibrated, f.yAngleCalibrated, f.zAngleCalibrated, acceleration.Time)
 			}
 			f.calibrated = true
 		}
 	} else {
-		continuousCount = 0
-		xAvg.Reset()
-		yAvg.Reset()
-		zAvg.Reset()
+		f.continuousCount = 0
+		f.xAvg.Reset()
+		f.yAvg.Reset()
+		f.zAvg.Reset()
 	}
 
 	return f.calibrated
@@ -0,0 +1,258 @@
+package integrity
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+)
+
+const (
+	NameJamming          = "GNSS_JAMMING"
+	NameSpoofing         = "GNSS_SPOOFING_SUSPECTED"
+	NameAntennaFault     = "ANTENNA_FAULT"
+	category             = "GNSS_INTEGRITY"
+	baselineSmoothing    = 0.05
+	baselineMinSamples   = 30
+	uniformCnoMinSamples = 6
+)
+
+type EventHandler func(event data.Event) error
+
+type Option func(*Monitor)
+
+// WithJamIndThreshold sets the MON-RF jamming indicator, 0 to 255, from which
+// the receiver is jammed.
+func WithJamIndThreshold(threshold uint8) Option {
+	return func(m *Monitor) {
+		m.jamIndThreshold = threshold
+	}
+}
+
+// WithMaxImpliedSpeed sets the speed, in m/s, implied by two consecutive fixes
+// over which the position jump is suspicious.
+func WithMaxImpliedSpeed(speed float64) Option {
+	return func(m *Monitor) {
+		m.maxImpliedSpeed = speed
+	}
+}
+
+// WithMaxTimeJump sets by how much the gnss time can move differently from the
+// system time between two consecutive fixes.
+func WithMaxTimeJump(jump time.Duration) Option {
+	return func(m *Monitor) {
+		m.maxTimeJump = jump
+	}
+}
+
+// WithHoldoff sets how long the evidence has to be gone for a condition to
+// end, an event being emitted again when it comes back after that.
+func WithHoldoff(holdoff time.Duration) Option {
+	return func(m *Monitor) {
+		m.holdoff = holdoff
+	}
+}
+
+// Monitor watches the RF status of the receiver, and the consistency of the
+// consecutive fixes, emitting an Event with the evidence when jamming,
+// spoofing or an antenna fault starts:
+//   - GNSS_JAMMING on a critical jamming state, a jamming indicator over the
+//     threshold, or the noise rising while the AGC drops from their baseline
+//   - GNSS_SPOOFING_SUSPECTED on a position jump, a gnss time jump against the
+//     system time, or a C/N0 too uniform over the satellites to come from the
+//     sky
+//   - ANTENNA_FAULT on a shorted or open antenna
+//
+// A condition lasts until its evidence is gone for the holdoff, the fixes
+// meanwhile not emitting it again. The fixes are expected unfiltered, the
+// inconsistent ones being rejected by the gnss quality gate.
+type Monitor struct {
+	lock sync.Mutex
+
+	handlers        []EventHandler
+	jamIndThreshold uint8
+	maxImpliedSpeed float64
+	maxTimeJump     time.Duration
+	holdoff         time.Duration
+
+	previous        *neom9n.Data
+	baselineNoise   float64
+	baselineAgc     float64
+	baselineSamples int
+	active          map[string]time.Time // name of the active conditions, to the last evidence time
+}
+
+func NewMonitor(handlers []EventHandler, opts ...Option) *Monitor {
+	m := &Monitor{
+		handlers:        handlers,
+		jamIndThreshold: 200,
+		maxImpliedSpeed: 100,
+		maxTimeJump:     time.Second,
+		holdoff:         30 * time.Second,
+		active:          map[string]time.Time{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// HandleGnssQuality is the gnss.QualityHandler receiving all the fixes, the
+// rejected ones included.
+func (m *Monitor) HandleGnssQuality(d *neom9n.Data, _ *gnss.Quality) error {
+	return m.HandleGnssData(d)
+}
+
+func (m *Monitor) HandleGnssData(d *neom9n.Data) error {
+	var events []data.Event
+	m.lock.Lock()
+	evidences := map[string][]string{
+		NameJamming:      m.jammingEvidence(d),
+		NameSpoofing:     m.spoofingEvidence(d),
+		NameAntennaFault: antennaEvidence(d),
+	}
+	for _, name := range []string{NameJamming, NameSpoofing, NameAntennaFault} {
+		evidence := evidences[name]
+		lastEvidence, active := m.active[name]
+		switch {
+		case len(evidence) > 0:
+			m.active[name] = d.SystemTime
+			if !active {
+				events = append(events, NewEvent(name, evidence, d.SystemTime, d))
+			}
+		case active && d.SystemTime.Sub(lastEvidence) >= m.holdoff:
+			delete(m.active, name)
+		}
+	}
+	if d.Fix == "2D" || d.Fix == "3D" {
+		m.previous = d
+	}
+	m.lock.Unlock()
+
+	for _, event := range events {
+		for _, handler := range m.handlers {
+			err := handler(event)
+			if err != nil {
+				return fmt.Errorf("handling integrity event: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Monitor) jammingEvidence(d *neom9n.Data) []string {
+	if d.RF == nil {
+		return nil
+	}
+
+	var evidence []string
+	if d.RF.JammingState == "critical" {
+		evidence = append(evidence, "jamming state critical")
+	}
+	if d.RF.JamInd >= m.jamIndThreshold {
+		evidence = append(evidence, fmt.Sprintf("jamming indicator %d", d.RF.JamInd))
+	}
+
+	noise := float64(d.RF.NoisePerMS)
+	agc := float64(d.RF.AgcCnt)
+	if m.baselineSamples >= baselineMinSamples && noise > 1.5*m.baselineNoise && agc < 0.7*m.baselineAgc {
+		evidence = append(evidence, fmt.Sprintf("noise %.0f and agc %.0f from %.0f and %.0f", noise, agc, m.baselineNoise, m.baselineAgc))
+	}
+
+	// the baseline only learns from the fixes without jamming
+	if len(evidence) == 0 && d.RF.JammingState != "warning" {
+		if m.baselineSamples == 0 {
+			m.baselineNoise, m.baselineAgc = noise, agc
+		} else {
+			m.baselineNoise += baselineSmoothing * (noise - m.baselineNoise)
+			m.baselineAgc += baselineSmoothing * (agc - m.baselineAgc)
+		}
+		m.baselineSamples++
+	}
+	return evidence
+}
+
+func (m *Monitor) spoofingEvidence(d *neom9n.Data) []string {
+	var evidence []string
+	previous := m.previous
+	if previous != nil && (d.Fix == "2D" || d.Fix == "3D") {
+		elapsed := d.SystemTime.Sub(previous.SystemTime)
+		if elapsed > 0 {
+			distance := geo.Distance(geo.NewCoordinate(previous.Longitude, previous.Latitude), geo.NewCoordinate(d.Longitude, d.Latitude))
+			if speed := distance / elapsed.Seconds(); speed > m.maxImpliedSpeed {
+				evidence = append(evidence, fmt.Sprintf("position jumped %.0fm in %.1fs", distance, elapsed.Seconds()))
+			}
+		}
+
+		if !d.Timestamp.IsZero() && !previous.Timestamp.IsZero() {
+			jump := d.Timestamp.Sub(previous.Timestamp) - elapsed
+			if jump > m.maxTimeJump || jump < -m.maxTimeJump {
+				evidence = append(evidence, fmt.Sprintf("gnss time jumped %.1fs against the system time", jump.Seconds()))
+			}
+		}
+	}
+
+	if mean, deviation, count := cnoStatistics(d); count >= uniformCnoMinSamples && mean >= 40 && deviation < 1.5 {
+		evidence = append(evidence, fmt.Sprintf("uniform C/N0 %.1f±%.1f dBHz over %d satellites", mean, deviation, count))
+	}
+	return evidence
+}
+
+// cnoStatistics is the mean and standard deviation of the C/N0 of the tracked
+// satellites, the signals of the sky varying with the elevation of each.
+func cnoStatistics(d *neom9n.Data) (mean float64, deviation float64, count int) {
+	if d.RxmMeasx == nil {
+		return 0, 0, 0
+	}
+
+	var sum, squares float64
+	for _, sv := range d.RxmMeasx.SV {
+		if sv.CNo == 0 {
+			continue
+		}
+		sum += float64(sv.CNo)
+		squares += float64(sv.CNo) * float64(sv.CNo)
+		count++
+	}
+	if count == 0 {
+		return 0, 0, 0
+	}
+	mean = sum / float64(count)
+	return mean, math.Sqrt(math.Max(0, squares/float64(count)-mean*mean)), count
+}
+
+func antennaEvidence(d *neom9n.Data) []string {
+	if d.RF == nil {
+		return nil
+	}
+
+	switch d.RF.AntStatus {
+	case "short", "open":
+		return []string{fmt.Sprintf("antenna status %s, power %s", d.RF.AntStatus, d.RF.AntPower)}
+	}
+	return nil
+}
+
+type Event struct {
+	*data.BaseEvent
+	Evidence []string `json:"evidence"`
+}
+
+func NewEvent(name string, evidence []string, t time.Time, gnssData *neom9n.Data) *Event {
+	return &Event{
+		BaseEvent: data.NewBaseEvent(name, category, t, gnssData),
+		Evidence:  evidence,
+	}
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("GNSS Integrity Event %s: %s", e.Name, strings.Join(e.Evidence, ", "))
+}
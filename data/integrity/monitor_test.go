@@ -0,0 +1,173 @@
+package integrity
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/daedaleanai/ublox/ubx"
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	departure := time.Date(2023, 9, 9, 14, 0, 0, 0, time.UTC)
+	nominal := neom9n.RF{JammingState: "ok", AntStatus: "ok", AntPower: "on", NoisePerMS: 90, AgcCnt: 5000, JamInd: 10}
+
+	tests := []struct {
+		name     string
+		driving  time.Duration
+		at       map[time.Duration]func(d *neom9n.Data)
+		expected []string
+	}{
+		{
+			name:    "nominal",
+			driving: 61 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				60 * time.Second: func(d *neom9n.Data) {
+					d.RxmMeasx = &ubx.RxmMeasx{SV: []*ubx.RxmMeasxSVType{
+						{SvId: 1, CNo: 45}, {SvId: 2, CNo: 38}, {SvId: 3, CNo: 30}, {SvId: 4, CNo: 41}, {SvId: 5, CNo: 25}, {SvId: 6, CNo: 47},
+					}}
+				},
+			},
+		},
+		{
+			name:    "jamming state critical",
+			driving: 3 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				1 * time.Second: func(d *neom9n.Data) { d.RF.JammingState = "critical"; d.RF.JamInd = 230 },
+				2 * time.Second: func(d *neom9n.Data) { d.RF.JammingState = "critical" },
+			},
+			expected: []string{"GNSS Integrity Event GNSS_JAMMING: jamming state critical, jamming indicator 230"},
+		},
+		{
+			name:    "noise rising and agc dropping",
+			driving: 31 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				30 * time.Second: func(d *neom9n.Data) { d.RF.NoisePerMS = 200; d.RF.AgcCnt = 2000 },
+			},
+			expected: []string{"GNSS Integrity Event GNSS_JAMMING: noise 200 and agc 2000 from 90 and 5000"},
+		},
+		{
+			name:    "noise without a baseline",
+			driving: 11 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				10 * time.Second: func(d *neom9n.Data) { d.RF.NoisePerMS = 200; d.RF.AgcCnt = 2000 },
+			},
+		},
+		{
+			name:    "position jump",
+			driving: 3 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				2 * time.Second: func(d *neom9n.Data) { d.Longitude += 0.01 },
+			},
+			expected: []string{"GNSS Integrity Event GNSS_SPOOFING_SUSPECTED: position jumped 788m in 1.0s"},
+		},
+		{
+			name:    "time jump",
+			driving: 3 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				2 * time.Second: func(d *neom9n.Data) { d.Timestamp = d.Timestamp.Add(5 * time.Second) },
+			},
+			expected: []string{"GNSS Integrity Event GNSS_SPOOFING_SUSPECTED: gnss time jumped 5.0s against the system time"},
+		},
+		{
+			name:    "uniform C/N0",
+			driving: 1 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				0: func(d *neom9n.Data) {
+					d.RxmMeasx = &ubx.RxmMeasx{SV: []*ubx.RxmMeasxSVType{
+						{SvId: 1, CNo: 44}, {SvId: 2, CNo: 45}, {SvId: 3, CNo: 44}, {SvId: 4, CNo: 45}, {SvId: 5, CNo: 44}, {SvId: 6, CNo: 46}, {SvId: 7, CNo: 0},
+					}}
+				},
+			},
+			expected: []string{"GNSS Integrity Event GNSS_SPOOFING_SUSPECTED: uniform C/N0 44.7±0.7 dBHz over 6 satellites"},
+		},
+		{
+			name:    "antenna open",
+			driving: 2 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				0:               func(d *neom9n.Data) { d.RF.AntStatus = "open" },
+				1 * time.Second: func(d *neom9n.Data) { d.RF.AntStatus = "open" },
+			},
+			expected: []string{"GNSS Integrity Event ANTENNA_FAULT: antenna status open, power on"},
+		},
+		{
+			name:    "antenna fault back after the holdoff",
+			driving: 62 * time.Second,
+			at: map[time.Duration]func(d *neom9n.Data){
+				0:                func(d *neom9n.Data) { d.RF.AntStatus = "short" },
+				20 * time.Second: func(d *neom9n.Data) { d.RF.AntStatus = "short" },
+				61 * time.Second: func(d *neom9n.Data) { d.RF.AntStatus = "short" },
+			},
+			expected: []string{
+				"GNSS Integrity Event ANTENNA_FAULT: antenna status short, power on",
+				"GNSS Integrity Event ANTENNA_FAULT: antenna status short, power on",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []string
+			m := NewMonitor([]EventHandler{func(event data.Event) error {
+				events = append(events, event.String())
+				return nil
+			}})
+			// one fix a second, driving east at 10 m/s, changed by the test at
+			// the given times
+			for elapsed := time.Duration(0); elapsed < test.driving; elapsed += time.Second {
+				rf := nominal
+				d := &neom9n.Data{
+					SystemTime: departure.Add(elapsed),
+					Timestamp:  departure.Add(elapsed),
+					Fix:        "3D",
+					Latitude:   45.575,
+					Longitude:  -73.44 + elapsed.Seconds()*0.000128,
+					RF:         &rf,
+				}
+				if change, found := test.at[elapsed]; found {
+					change(d)
+				}
+				require.NoError(t, m.HandleGnssData(d))
+			}
+			require.Equal(t, test.expected, events)
+		})
+	}
+}
+
+func TestSqlStore(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "integrity.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	// the event is inside a privacy zone
+	store := NewSqlStore(sqlite, WithRedaction(func(d *neom9n.Data) *neom9n.Data {
+		redacted := *d
+		redacted.Latitude, redacted.Longitude = 0, 0
+		return &redacted
+	}))
+
+	d := &neom9n.Data{
+		SystemTime: time.Date(2023, 9, 9, 14, 10, 0, 0, time.UTC),
+		Fix:        "3D",
+		Latitude:   45.575,
+		Longitude:  -73.44,
+		RF:         &neom9n.RF{JammingState: "critical", AntStatus: "ok", AntPower: "on", NoisePerMS: 90, AgcCnt: 5000, JamInd: 230},
+	}
+	require.NoError(t, store.HandleEvent(NewEvent(NameJamming, []string{"jamming state critical", "jamming indicator 230"}, d.SystemTime, d)))
+	require.NoError(t, store.HandleEvent(data.NewBaseEvent("TRIP_START_EVENT", "TRIP", d.SystemTime, d)))
+
+	var rows []string
+	require.NoError(t, sqlite.Query(false, "SELECT name, evidence, rf_jamming_state, rf_jam_ind, latitude, longitude FROM integrity_events", func(r *sql.Rows) error {
+		var name, evidence, jammingState string
+		var jamInd int
+		var latitude, longitude float64
+		err := r.Scan(&name, &evidence, &jammingState, &jamInd, &latitude, &longitude)
+		rows = append(rows, fmt.Sprintf("%s %s %s %d %.3f %.3f", name, evidence, jammingState, jamInd, latitude, longitude))
+		return err
+	}, nil))
+	require.Equal(t, []string{"GNSS_JAMMING jamming state critical; jamming indicator 230 critical 230 0.000 0.000"}, rows)
+}
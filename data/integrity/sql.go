@@ -0,0 +1,111 @@
+package integrity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS integrity_events (
+		id INTEGER NOT NULL PRIMARY KEY,
+		time TIMESTAMP NOT NULL,
+		name TEXT NOT NULL,
+		evidence TEXT NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		rf_jamming_state TEXT NOT NULL,
+		rf_jam_ind INTEGER NOT NULL,
+		rf_agc_cnt INTEGER NOT NULL,
+		rf_noise_per_ms INTEGER NOT NULL,
+		rf_ant_status TEXT NOT NULL,
+		rf_ant_power TEXT NOT NULL
+	);
+	create index if not exists integrity_events_time_idx on integrity_events(time);
+`
+
+const insertQuery string = `
+	INSERT INTO integrity_events VALUES(NULL,?,?,?,?,?,?,?,?,?,?,?);
+`
+
+const purgeQuery string = `
+	DELETE FROM integrity_events WHERE time < ?;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+func PurgeQuery() string {
+	return purgeQuery
+}
+
+// SqlStore writes the integrity events as they happen, them being rare. The
+// evidence is joined with "; ".
+type SqlStore struct {
+	sqlite *logger.Sqlite
+	redact func(d *neom9n.Data) *neom9n.Data
+}
+
+type SqlStoreOption func(*SqlStore)
+
+// WithRedaction redacts the coordinates stored inside the privacy zones,
+// privacy.Redactor.RedactFix being the redact func.
+func WithRedaction(redact func(d *neom9n.Data) *neom9n.Data) SqlStoreOption {
+	return func(s *SqlStore) {
+		s.redact = redact
+	}
+}
+
+func NewSqlStore(sqlite *logger.Sqlite, opts ...SqlStoreOption) *SqlStore {
+	s := &SqlStore{sqlite: sqlite}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// HandleEvent stores the integrity events, ignoring the others.
+func (s *SqlStore) HandleEvent(event data.Event) error {
+	e, ok := event.(*Event)
+	if !ok {
+		return nil
+	}
+
+	var latitude, longitude float64
+	var jammingState, antStatus, antPower string
+	var jamInd uint8
+	var agcCnt, noisePerMS uint16
+	if gnssData := e.GnssData; gnssData != nil {
+		if s.redact != nil {
+			gnssData = s.redact(gnssData)
+		}
+		latitude, longitude = gnssData.Latitude, gnssData.Longitude
+		if rf := gnssData.RF; rf != nil {
+			jammingState, jamInd, agcCnt, noisePerMS, antStatus, antPower = rf.JammingState, rf.JamInd, rf.AgcCnt, rf.NoisePerMS, rf.AntStatus, rf.AntPower
+		}
+	}
+
+	err := s.sqlite.Exec(insertQuery,
+		e.Time.Format("2006-01-02 15:04:05.99999"),
+		e.Name,
+		strings.Join(e.Evidence, "; "),
+		latitude,
+		longitude,
+		jammingState,
+		jamInd,
+		agcCnt,
+		noisePerMS,
+		antStatus,
+		antPower,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting integrity event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package jsonfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/replay"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+)
+
+const latestLog = "latest.log"
+
+type Option func(*JsonImporterFeed)
+
+// JsonImporterFeed replays the files written by the logger.JsonFile loggers:
+// an imu folder of ImuDataWrapper and a gps folder of gnss.QualifiedData, both
+// made of rotated json array files plus the last record in latest.log.
+type JsonImporterFeed struct {
+	imuDir              string
+	gnssDir             string
+	imuRawFeedHandlers  []imu.RawFeedHandler
+	gssDataFeedHandlers []gnss.GnssDataHandler
+
+	startTime  time.Time
+	endTime    time.Time
+	controller *replay.Controller
+}
+
+func NewJsonImporterFeed(imuDir string, gnssDir string, imuRawFeedHandlers []imu.RawFeedHandler, gssDataFeedHandlers []gnss.GnssDataHandler, opts ...Option) *JsonImporterFeed {
+	f := &JsonImporterFeed{
+		imuDir:              imuDir,
+		gnssDir:             gnssDir,
+		imuRawFeedHandlers:  imuRawFeedHandlers,
+		gssDataFeedHandlers: gssDataFeedHandlers,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// WithTimeRange only replays the records between start and end, a zero time
+// leaving that side of the range unbounded.
+func WithTimeRange(start time.Time, end time.Time) Option {
+	return func(f *JsonImporterFeed) {
+		f.startTime = start
+		f.endTime = end
+	}
+}
+
+// WithController paces the replay, and lets it be paused, resumed and seeked.
+func WithController(controller *replay.Controller) Option {
+	return func(f *JsonImporterFeed) {
+		f.controller = controller
+	}
+}
+
+// Run replays the imu records in time order, each preceded by the gnss
+// records received up to its time. Unlike the sql feed, no axis map is
+// applied: the json files hold the acceleration already mapped at logging
+// time.
+func (f *JsonImporterFeed) Run() error {
+	fmt.Println("Starting json feed")
+
+	imuRecords, err := loadImuRecords(f.imuDir)
+	if err != nil {
+		return fmt.Errorf("loading imu records: %w", err)
+	}
+
+	gnssRecords, err := loadGnssRecords(f.gnssDir)
+	if err != nil {
+		return fmt.Errorf("loading gnss records: %w", err)
+	}
+	fmt.Printf("Loaded %d imu and %d gnss records\n", len(imuRecords), len(gnssRecords))
+
+	i := sort.Search(len(imuRecords), func(i int) bool { return !imuRecords[i].Time.Before(f.startTime) })
+	g := gnssIndex(gnssRecords, f.startTime)
+	count := 0
+	start := time.Now()
+	for ; i < len(imuRecords); i++ {
+		record := imuRecords[i]
+		if !f.endTime.IsZero() && record.Time.After(f.endTime) {
+			break
+		}
+
+		if f.controller != nil {
+			if seekTo, seeking := f.controller.Wait(record.Time); seeking {
+				fmt.Println("Seeking json feed to", seekTo)
+				i = sort.Search(len(imuRecords), func(i int) bool { return !imuRecords[i].Time.Before(seekTo) }) - 1
+				g = gnssIndex(gnssRecords, seekTo)
+				continue
+			}
+		}
+
+		for ; g < len(gnssRecords) && !gnssTime(gnssRecords[g]).After(record.Time); g++ {
+			for _, handler := range f.gssDataFeedHandlers {
+				err := handler(gnssRecords[g])
+				if err != nil {
+					return fmt.Errorf("failed to handle gnss data feed: %w", err)
+				}
+			}
+		}
+
+		count++
+		x, y, z := record.Accel.X, record.Accel.Y, record.Accel.Z
+		acceleration := imu.NewAcceleration(x, y, z, math.Sqrt(x*x+y*y+z*z), record.Time)
+		angularRate := &iim42652.AngularRate{}
+		if record.Gyro != nil {
+			angularRate = &iim42652.AngularRate{X: record.Gyro.X, Y: record.Gyro.Y, Z: record.Gyro.Z}
+		}
+		for _, handler := range f.imuRawFeedHandlers {
+			err := handler(acceleration, angularRate, iim42652.NewTemperature(record.Temp))
+			if err != nil {
+				return fmt.Errorf("failed to handle imu raw feed: %w", err)
+			}
+		}
+	}
+
+	fmt.Printf("Finished json feed, %d imu records in %s\n", count, time.Since(start))
+	return nil
+}
+
+// gnssTime is the time the record was received, on the same clock as the imu
+// records. Records logged before system_time existed fall back to the gnss
+// timestamp.
+func gnssTime(data *neom9n.Data) time.Time {
+	if data.SystemTime.IsZero() {
+		return data.Timestamp
+	}
+	return data.SystemTime
+}
+
+// gnssIndex is the index of the last gnss record received at or before t, so
+// the replay starting at t begins with a known position.
+func gnssIndex(records []*neom9n.Data, t time.Time) int {
+	i := sort.Search(len(records), func(i int) bool { return gnssTime(records[i]).After(t) })
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+func loadImuRecords(dir string) ([]*logger.ImuDataWrapper, error) {
+	var records []*logger.ImuDataWrapper
+	err := loadDir(dir, func(content []byte, isLatest bool) error {
+		if isLatest {
+			record := &logger.ImuDataWrapper{}
+			if err := json.Unmarshal(content, record); err != nil {
+				return err
+			}
+			if len(records) == 0 || record.Time.After(records[len(records)-1].Time) {
+				records = append(records, record)
+			}
+			return nil
+		}
+
+		var fileRecords []*logger.ImuDataWrapper
+		if err := json.Unmarshal(content, &fileRecords); err != nil {
+			return err
+		}
+		records = append(records, fileRecords...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// loadGnssRecords loads the gnss.QualifiedData written by the logger, the
+// fixes being replayed at their raw position when they were filtered.
+func loadGnssRecords(dir string) ([]*neom9n.Data, error) {
+	var records []*neom9n.Data
+	err := loadDir(dir, func(content []byte, isLatest bool) error {
+		if isLatest {
+			record := &gnss.QualifiedData{}
+			if err := json.Unmarshal(content, record); err != nil {
+				return err
+			}
+			if d := rawGnssData(record); d != nil && (len(records) == 0 || gnssTime(d).After(gnssTime(records[len(records)-1]))) {
+				records = append(records, d)
+			}
+			return nil
+		}
+
+		var fileRecords []*gnss.QualifiedData
+		if err := json.Unmarshal(content, &fileRecords); err != nil {
+			return err
+		}
+		for _, record := range fileRecords {
+			if d := rawGnssData(record); d != nil {
+				records = append(records, d)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return gnssTime(records[i]).Before(gnssTime(records[j])) })
+	return records, nil
+}
+
+func rawGnssData(record *gnss.QualifiedData) *neom9n.Data {
+	if record == nil {
+		return nil
+	}
+	if record.Data == nil || record.Raw == nil {
+		return record.Data
+	}
+	d := *record.Data
+	d.Latitude = record.Raw.Latitude
+	d.Longitude = record.Raw.Longitude
+	return &d
+}
+
+// loadDir calls load with the content of every json file of dir, in name
+// (so time) order, then with latest.log if present. An empty dir path loads
+// nothing.
+func loadDir(dir string, load func(content []byte, isLatest bool) error) error {
+	if dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading dir %q: %w", dir, err)
+	}
+
+	var names []string
+	hasLatest := false
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch {
+		case entry.Name() == latestLog:
+			hasLatest = true
+		case strings.HasSuffix(entry.Name(), ".json"):
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		content, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("reading file %q: %w", name, err)
+		}
+		if err := load(content, false); err != nil {
+			return fmt.Errorf("unmarshalling file %q: %w", name, err)
+		}
+	}
+
+	if hasLatest {
+		content, err := os.ReadFile(path.Join(dir, latestLog))
+		if err != nil {
+			return fmt.Errorf("reading file %q: %w", latestLog, err)
+		}
+		// latest.log can be caught mid write by the upload, it is only a
+		// best effort extra record
+		if err := load(content, true); err != nil {
+			fmt.Printf("skipping %s: %s\n", path.Join(dir, latestLog), err)
+		}
+	}
+
+	return nil
+}
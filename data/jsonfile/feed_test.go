@@ -0,0 +1,125 @@
+package jsonfile
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+	"github.com/stretchr/testify/require"
+)
+
+func writeJson(t *testing.T, filePath string, v any) {
+	t.Helper()
+	content, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, content, 0644))
+}
+
+func TestJsonImporterFeed_Run(t *testing.T) {
+	t0 := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	imuAt := func(ms int) *logger.ImuDataWrapper {
+		return &logger.ImuDataWrapper{Accel: logger.NewAccel(float64(ms), 0, 1), Time: t0.Add(time.Duration(ms) * time.Millisecond)}
+	}
+	gnssAt := func(ms int) *neom9n.Data {
+		return &neom9n.Data{Latitude: float64(ms), SystemTime: t0.Add(time.Duration(ms) * time.Millisecond)}
+	}
+
+	imuDir := t.TempDir()
+	gnssDir := t.TempDir()
+	writeJson(t, path.Join(imuDir, "2023-09-01T12:00:00.100Z.json"), []*logger.ImuDataWrapper{imuAt(100), imuAt(125)})
+	writeJson(t, path.Join(imuDir, "2023-09-01T12:00:00.000Z.json"), []*logger.ImuDataWrapper{imuAt(0), imuAt(25), imuAt(50)})
+	writeJson(t, path.Join(imuDir, latestLog), imuAt(150))
+	writeJson(t, path.Join(gnssDir, "2023-09-01T12:00:00.000Z.json"), []*neom9n.Data{gnssAt(10), gnssAt(110)})
+	writeJson(t, path.Join(gnssDir, latestLog), gnssAt(110))
+
+	tests := []struct {
+		name          string
+		start         time.Time
+		end           time.Time
+		expectedCalls []string
+	}{
+		{
+			name:          "all records",
+			expectedCalls: []string{"imu 0", "gnss 10", "imu 25", "imu 50", "imu 100", "gnss 110", "imu 125", "imu 150"},
+		},
+		{
+			name:          "time range",
+			start:         t0.Add(40 * time.Millisecond),
+			end:           t0.Add(125 * time.Millisecond),
+			expectedCalls: []string{"gnss 10", "imu 50", "imu 100", "gnss 110", "imu 125"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []string
+			feed := NewJsonImporterFeed(
+				imuDir,
+				gnssDir,
+				[]imu.RawFeedHandler{func(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, temperature iim42652.Temperature) error {
+					calls = append(calls, "imu "+strconv.FormatFloat(acceleration.X, 'f', -1, 64))
+					return nil
+				}},
+				[]gnss.GnssDataHandler{func(data *neom9n.Data) error {
+					calls = append(calls, "gnss "+strconv.FormatFloat(data.Latitude, 'f', -1, 64))
+					return nil
+				}},
+				WithTimeRange(test.start, test.end),
+			)
+
+			require.NoError(t, feed.Run())
+			require.Equal(t, test.expectedCalls, calls)
+		})
+	}
+}
+
+func TestJsonImporterFeed_QualifiedData(t *testing.T) {
+	t0 := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	imuDir := t.TempDir()
+	gnssDir := t.TempDir()
+	writeJson(t, path.Join(imuDir, latestLog), &logger.ImuDataWrapper{Accel: logger.NewAccel(0, 0, 1), Time: t0.Add(3 * time.Second)})
+
+	// written like the gnss json logger of the log command
+	jsonFile := logger.NewJsonFile(gnssDir, time.Hour)
+	require.NoError(t, jsonFile.Init(false))
+	jsonFile.IsLogging = true
+	for i, latitude := range []float64{45.1, 45.2, 45.3} {
+		raw := &neom9n.Data{Latitude: latitude, Longitude: -73.4, Fix: "3D", SystemTime: t0.Add(time.Duration(i) * time.Second)}
+		filtered := *raw
+		filtered.Latitude += 0.05
+		var qualified *gnss.QualifiedData
+		if i == 1 {
+			qualified = gnss.NewQualifiedData(raw, nil, nil, &gnss.Quality{Verdict: gnss.VerdictGood})
+		} else {
+			qualified = gnss.NewQualifiedData(&filtered, raw, &gnss.GnssFilteredData{Latitude: filtered.Latitude}, &gnss.Quality{Verdict: gnss.VerdictGood})
+		}
+		require.NoError(t, jsonFile.Log(raw.SystemTime, qualified))
+	}
+	jsonFile.StartStoring()
+	require.Eventually(t, func() bool {
+		files, err := os.ReadDir(gnssDir)
+		return err == nil && len(files) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	var calls []string
+	feed := NewJsonImporterFeed(
+		imuDir,
+		gnssDir,
+		nil,
+		[]gnss.GnssDataHandler{func(data *neom9n.Data) error {
+			calls = append(calls, strconv.FormatFloat(data.Latitude, 'f', -1, 64)+" "+data.Fix)
+			return nil
+		}},
+	)
+
+	require.NoError(t, feed.Run())
+	require.Equal(t, []string{"45.1 3D", "45.2 3D", "45.3 3D"}, calls)
+}
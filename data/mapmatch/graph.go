@@ -0,0 +1,221 @@
+package mapmatch
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+)
+
+// segment is the part of a way between 2 consecutive points, from node
+// `from` to node `to`.
+type segment struct {
+	way      *roads.Way
+	from     int
+	to       int
+	start    *roads.Point
+	end      *roads.Point
+	length   float64
+	forward  bool // can be driven from start to end
+	backward bool // can be driven from end to start
+}
+
+type edge struct {
+	to     int
+	length float64
+}
+
+// graph is the directed road graph, nodes being the way points shared
+// between ways. Segments are also indexed on a grid for the candidate
+// search.
+type graph struct {
+	nodeIDs  map[nodeKey]int
+	edges    [][]edge
+	segments map[cell][]*segment
+	cellSize float64 // meters
+}
+
+// nodeKey identifies a node by its OSM id, or its coordinates when the ways
+// do not carry node ids (ex: GeoJSON ways), ways meeting at the exact same
+// coordinates being connected.
+type nodeKey struct {
+	id  int64
+	lon int64
+	lat int64
+}
+
+type cell struct {
+	x int64
+	y int64
+}
+
+func keyOf(p *roads.Point) nodeKey {
+	if p.NodeID != 0 {
+		return nodeKey{id: p.NodeID}
+	}
+	return nodeKey{lon: int64(math.Round(p.Lon * 1e7)), lat: int64(math.Round(p.Lat * 1e7))}
+}
+
+func newGraph(ways map[int64]*roads.Way, cellSize float64) *graph {
+	g := &graph{
+		nodeIDs:  map[nodeKey]int{},
+		segments: map[cell][]*segment{},
+		cellSize: cellSize,
+	}
+
+	for _, way := range ways {
+		for i := 1; i < len(way.Points); i++ {
+			s := &segment{
+				way:      way,
+				from:     g.node(way.Points[i-1]),
+				to:       g.node(way.Points[i]),
+				start:    way.Points[i-1],
+				end:      way.Points[i],
+				forward:  true,
+				backward: !way.Oneway,
+			}
+			s.length = distance(s.start.Lon, s.start.Lat, s.end.Lon, s.end.Lat)
+
+			g.edges[s.from] = append(g.edges[s.from], edge{to: s.to, length: s.length})
+			if s.backward {
+				g.edges[s.to] = append(g.edges[s.to], edge{to: s.from, length: s.length})
+			}
+			g.index(s)
+		}
+	}
+
+	return g
+}
+
+func (g *graph) node(p *roads.Point) int {
+	key := keyOf(p)
+	id, found := g.nodeIDs[key]
+	if !found {
+		id = len(g.edges)
+		g.nodeIDs[key] = id
+		g.edges = append(g.edges, nil)
+	}
+	return id
+}
+
+// cellOf projects on a flat grid, cells being g.cellSize meters high and
+// about as wide at the latitude of the center of their row. Scaling with the
+// latitude of each point would shear the grid, the nearby segments of the
+// next rows landing in far apart columns at large longitudes.
+func (g *graph) cellOf(lon, lat float64) cell {
+	y := int64(math.Floor(lat * math.Pi / 180 * geo.EarthRadius / g.cellSize))
+	return cell{x: g.columnOf(lon, y), y: y}
+}
+
+func (g *graph) columnOf(lon float64, y int64) int64 {
+	rowLat := (float64(y) + 0.5) * g.cellSize / geo.EarthRadius * 180 / math.Pi
+	x := lon * math.Pi / 180 * geo.EarthRadius * math.Cos(rowLat*math.Pi/180)
+	return int64(math.Floor(x / g.cellSize))
+}
+
+// index adds s to all the cells of its bounding box, the columns being
+// computed for each row.
+func (g *graph) index(s *segment) {
+	minY, maxY := g.cellOf(s.start.Lon, s.start.Lat).y, g.cellOf(s.end.Lon, s.end.Lat).y
+	if minY > maxY {
+		minY, maxY = maxY, minY
+	}
+
+	for y := minY; y <= maxY; y++ {
+		minX, maxX := g.columnOf(s.start.Lon, y), g.columnOf(s.end.Lon, y)
+		if minX > maxX {
+			minX, maxX = maxX, minX
+		}
+		for x := minX; x <= maxX; x++ {
+			g.segments[cell{x: x, y: y}] = append(g.segments[cell{x: x, y: y}], s)
+		}
+	}
+}
+
+// near returns the segments which might be within radius of lon/lat.
+func (g *graph) near(lon, lat, radius float64) []*segment {
+	center := g.cellOf(lon, lat)
+	reach := int64(math.Ceil(radius/g.cellSize)) + 1
+
+	seen := map[*segment]bool{}
+	var segments []*segment
+	for y := center.y - reach; y <= center.y+reach; y++ {
+		column := g.columnOf(lon, y)
+		for x := column - reach; x <= column+reach; x++ {
+			for _, s := range g.segments[cell{x: x, y: y}] {
+				if !seen[s] {
+					seen[s] = true
+					segments = append(segments, s)
+				}
+			}
+		}
+	}
+	return segments
+}
+
+// shortestPaths returns the route distances from node `from` to the nodes
+// reachable within maxDistance meters.
+func (g *graph) shortestPaths(from int, maxDistance float64) map[int]float64 {
+	distances := map[int]float64{from: 0}
+	queue := &nodeQueue{{node: from}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(nodeDistance)
+		if current.distance > distances[current.node] {
+			continue
+		}
+
+		for _, e := range g.edges[current.node] {
+			d := current.distance + e.length
+			if d > maxDistance {
+				continue
+			}
+			if known, found := distances[e.to]; !found || d < known {
+				distances[e.to] = d
+				heap.Push(queue, nodeDistance{node: e.to, distance: d})
+			}
+		}
+	}
+	return distances
+}
+
+type nodeDistance struct {
+	node     int
+	distance float64
+}
+
+type nodeQueue []nodeDistance
+
+func (q nodeQueue) Len() int           { return len(q) }
+func (q nodeQueue) Less(i, j int) bool { return q[i].distance < q[j].distance }
+func (q nodeQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x any)        { *q = append(*q, x.(nodeDistance)) }
+
+func (q *nodeQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+func distance(lon1, lat1, lon2, lat2 float64) float64 {
+	return geo.Distance(&geo.Coordinate{Lon: lon1, Lat: lat1}, &geo.Coordinate{Lon: lon2, Lat: lat2})
+}
+
+// project returns the point of s closest to lon/lat and its distance from
+// the start of s, on a local flat approximation around lon/lat.
+func (s *segment) project(lon, lat float64) (pLon float64, pLat float64, offset float64) {
+	scale := math.Cos(lat * math.Pi / 180)
+	ax, ay := (s.start.Lon-lon)*scale, s.start.Lat-lat
+	bx, by := (s.end.Lon-lon)*scale, s.end.Lat-lat
+
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+
+	pLon = s.start.Lon + t*(s.end.Lon-s.start.Lon)
+	pLat = s.start.Lat + t*(s.end.Lat-s.start.Lat)
+	return pLon, pLat, t * s.length
+}
@@ -0,0 +1,59 @@
+package mapmatch
+
+import (
+	"math"
+	"testing"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_NearLargeLongitude(t *testing.T) {
+	tests := []struct {
+		name string
+		lon  float64
+		lat  float64
+	}{
+		{name: "san francisco", lon: -122.4194, lat: 37.7749},
+		{name: "sydney", lon: 151.2093, lat: -33.8688},
+		{name: "near the antimeridian", lon: -179.2, lat: 64.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// north-south roads every ~20m, with a node every ~20m, around
+			// the query point
+			step := 20.0 / geo.EarthRadius * 180 / math.Pi
+			ways := map[int64]*roads.Way{}
+			for i := -10; i <= 10; i++ {
+				way := &roads.Way{ID: int64(i + 100)}
+				for j := -10; j <= 10; j++ {
+					way.Points = append(way.Points, &roads.Point{
+						Lon:    test.lon + float64(i)*step/math.Cos(test.lat*math.Pi/180),
+						Lat:    test.lat + float64(j)*step,
+						WayID:  way.ID,
+						NodeID: int64(i*100 + j),
+					})
+				}
+				ways[way.ID] = way
+			}
+
+			radius := 50.0
+			g := newGraph(ways, radius)
+			near := map[*segment]bool{}
+			for _, s := range g.near(test.lon, test.lat, radius) {
+				near[s] = true
+			}
+
+			for _, segments := range g.segments {
+				for _, s := range segments {
+					pLon, pLat, _ := s.project(test.lon, test.lat)
+					if distance(test.lon, test.lat, pLon, pLat) <= radius {
+						require.True(t, near[s], "segment of way %d within %.0fm", s.way.ID, radius)
+					}
+				}
+			}
+		})
+	}
+}
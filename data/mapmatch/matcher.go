@@ -0,0 +1,323 @@
+package mapmatch
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+)
+
+// Fix is a gnss position to match.
+type Fix struct {
+	Lon  float64
+	Lat  float64
+	Time time.Time
+	// Accuracy is the horizontal accuracy in meters, 0 when unknown.
+	Accuracy float64
+}
+
+// Match is the position of a fix on the road network. WayID is 0 and Lon/Lat
+// the fix position when it could not be matched.
+type Match struct {
+	Fix        *Fix
+	Lon        float64
+	Lat        float64
+	WayID      int64
+	Confidence float64
+}
+
+type Option func(*Matcher)
+
+// WithWindow sets the number of fixes kept undecided, a fix being matched
+// once window newer fixes are known.
+func WithWindow(window int) Option {
+	return func(m *Matcher) {
+		m.window = window
+	}
+}
+
+// WithSearchRadius sets how far from a fix, in meters, the road candidates
+// are searched.
+func WithSearchRadius(radius float64) Option {
+	return func(m *Matcher) {
+		m.searchRadius = radius
+	}
+}
+
+// WithSigma sets the standard deviation of the gnss error, in meters, used
+// when the fix accuracy is better or unknown.
+func WithSigma(sigma float64) Option {
+	return func(m *Matcher) {
+		m.sigma = sigma
+	}
+}
+
+// WithBeta sets the scale, in meters, of the expected difference between
+// the route distance and the straight line distance of consecutive fixes.
+func WithBeta(beta float64) Option {
+	return func(m *Matcher) {
+		m.beta = beta
+	}
+}
+
+// Matcher is a Hidden Markov Model map matcher (Newson & Krumm, "Hidden
+// Markov Map Matching Through Noise and Sparseness", 2009). The hidden states
+// are the projections of the fixes on the nearby road segments, emitted with
+// a gaussian probability of their distance to the fix, and transitioning
+// with an exponential probability of the difference between the route
+// distance and the straight line distance separating the fixes. The most
+// likely path is decoded with Viterbi over a sliding window of fixes.
+type Matcher struct {
+	graph         *graph
+	window        int
+	searchRadius  float64
+	sigma         float64
+	beta          float64
+	maxCandidates int
+
+	steps []*step
+}
+
+type candidate struct {
+	segment  *segment
+	lon      float64
+	lat      float64
+	offset   float64 // from the start of the segment
+	distance float64 // to the fix
+	score    float64 // log probability of the best path ending here
+	previous int     // candidate of the previous step on that path, -1 at the start of a chain
+}
+
+type step struct {
+	fix        *Fix
+	candidates []*candidate
+}
+
+func NewMatcher(index *roads.Index, opts ...Option) *Matcher {
+	m := &Matcher{
+		window:        10,
+		searchRadius:  50,
+		sigma:         5,
+		beta:          5,
+		maxCandidates: 8,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.graph = newGraph(index.Ways(), math.Max(m.searchRadius, 50))
+	return m
+}
+
+// Add matches fix, returning the matches of the fixes decided by it, in fix
+// order. A fix far from any road, or that no route can reach from the
+// previous fixes, breaks the chain: the pending fixes are decided.
+func (m *Matcher) Add(fix *Fix) []*Match {
+	candidates := m.candidates(fix)
+	if len(candidates) == 0 {
+		return append(m.Flush(), &Match{Fix: fix, Lon: fix.Lon, Lat: fix.Lat})
+	}
+
+	var matches []*Match
+	if len(m.steps) > 0 && !m.transition(m.steps[len(m.steps)-1], fix, candidates) {
+		matches = m.Flush()
+	}
+	if len(m.steps) == 0 {
+		for _, c := range candidates {
+			c.score = m.emission(fix, c)
+			c.previous = -1
+		}
+	}
+
+	m.steps = append(m.steps, &step{fix: fix, candidates: candidates})
+	if len(m.steps) > m.window {
+		matches = append(matches, m.decide(len(m.steps)-m.window)...)
+	}
+	return matches
+}
+
+// Flush decides all the pending fixes.
+func (m *Matcher) Flush() []*Match {
+	return m.decide(len(m.steps))
+}
+
+func (m *Matcher) candidates(fix *Fix) []*candidate {
+	var candidates []*candidate
+	for _, s := range m.graph.near(fix.Lon, fix.Lat, m.searchRadius) {
+		lon, lat, offset := s.project(fix.Lon, fix.Lat)
+		d := distance(fix.Lon, fix.Lat, lon, lat)
+		if d <= m.searchRadius {
+			candidates = append(candidates, &candidate{segment: s, lon: lon, lat: lat, offset: offset, distance: d})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	if len(candidates) > m.maxCandidates {
+		candidates = candidates[:m.maxCandidates]
+	}
+	return candidates
+}
+
+func (m *Matcher) emission(fix *Fix, c *candidate) float64 {
+	sigma := math.Max(m.sigma, fix.Accuracy)
+	return -0.5*(c.distance/sigma)*(c.distance/sigma) - math.Log(sigma*math.Sqrt(2*math.Pi))
+}
+
+// transition scores the candidates of fix from the previous step, returning
+// false when none of them can be reached.
+func (m *Matcher) transition(previous *step, fix *Fix, candidates []*candidate) bool {
+	straight := distance(previous.fix.Lon, previous.fix.Lat, fix.Lon, fix.Lat)
+	maxRoute := 2*straight + 2*m.searchRadius
+
+	paths := map[int]map[int]float64{}
+	shortestPaths := func(node int) map[int]float64 {
+		if _, found := paths[node]; !found {
+			paths[node] = m.graph.shortestPaths(node, maxRoute)
+		}
+		return paths[node]
+	}
+
+	reachable := false
+	for _, c := range candidates {
+		c.score = math.Inf(-1)
+		c.previous = -1
+		emission := m.emission(fix, c)
+		for i, p := range previous.candidates {
+			route := m.routeDistance(p, c, shortestPaths)
+			if math.IsInf(route, 1) || math.IsInf(p.score, -1) {
+				continue
+			}
+			score := p.score + emission - math.Abs(route-straight)/m.beta - math.Log(m.beta)
+			if score > c.score {
+				c.score = score
+				c.previous = i
+				reachable = true
+			}
+		}
+	}
+
+	if reachable {
+		// keep the log probabilities around 0, they only matter relatively
+		maxScore := math.Inf(-1)
+		for _, c := range candidates {
+			maxScore = math.Max(maxScore, c.score)
+		}
+		for _, c := range candidates {
+			c.score -= maxScore
+		}
+	}
+	return reachable
+}
+
+// routeDistance is the driving distance from a to b, +Inf when b is not
+// reachable from a.
+func (m *Matcher) routeDistance(a, b *candidate, shortestPaths func(node int) map[int]float64) float64 {
+	best := math.Inf(1)
+	if a.segment == b.segment {
+		// going back by less than sigma is gnss noise of a stopped or slow
+		// vehicle, not a u-turn
+		if a.segment.forward && b.offset >= a.offset-m.sigma {
+			best = math.Abs(b.offset - a.offset)
+		}
+		if a.segment.backward && b.offset <= a.offset+m.sigma {
+			best = math.Min(best, math.Abs(a.offset-b.offset))
+		}
+	}
+
+	type via struct {
+		node int
+		cost float64
+	}
+	var exits, entries []via
+	if a.segment.forward {
+		exits = append(exits, via{node: a.segment.to, cost: a.segment.length - a.offset})
+	}
+	if a.segment.backward {
+		exits = append(exits, via{node: a.segment.from, cost: a.offset})
+	}
+	if b.segment.forward {
+		entries = append(entries, via{node: b.segment.from, cost: b.offset})
+	}
+	if b.segment.backward {
+		entries = append(entries, via{node: b.segment.to, cost: b.segment.length - b.offset})
+	}
+
+	for _, exit := range exits {
+		distances := shortestPaths(exit.node)
+		for _, entry := range entries {
+			if d, found := distances[entry.node]; found {
+				best = math.Min(best, exit.cost+d+entry.cost)
+			}
+		}
+	}
+	return best
+}
+
+// decide matches the n oldest pending fixes on the most likely path. The
+// confidence of a match is the share of the probability of the current
+// paths going through it.
+func (m *Matcher) decide(n int) []*Match {
+	if n <= 0 {
+		return nil
+	}
+
+	last := m.steps[len(m.steps)-1]
+	maxScore := math.Inf(-1)
+	best := 0
+	for i, c := range last.candidates {
+		if c.score > maxScore {
+			maxScore = c.score
+			best = i
+		}
+	}
+
+	// paths[j][k] is the candidate of step k on the path ending at the j-th
+	// candidate of the last step
+	paths := make([][]int, len(last.candidates))
+	weights := make([]float64, len(last.candidates))
+	total := 0.0
+	for j, c := range last.candidates {
+		if math.IsInf(c.score, -1) {
+			continue
+		}
+		weights[j] = math.Exp(c.score - maxScore)
+		total += weights[j]
+
+		paths[j] = make([]int, len(m.steps))
+		index := j
+		for k := len(m.steps) - 1; k >= 0; k-- {
+			paths[j][k] = index
+			if index >= 0 {
+				index = m.steps[k].candidates[index].previous
+			}
+		}
+	}
+
+	matches := make([]*Match, n)
+	for k := 0; k < n; k++ {
+		chosen := m.steps[k].candidates[paths[best][k]]
+		agreeing := 0.0
+		for j, path := range paths {
+			if path != nil && path[k] == paths[best][k] {
+				agreeing += weights[j]
+			}
+		}
+		matches[k] = &Match{
+			Fix:        m.steps[k].fix,
+			Lon:        chosen.lon,
+			Lat:        chosen.lat,
+			WayID:      chosen.segment.way.ID,
+			Confidence: agreeing / total,
+		}
+	}
+
+	m.steps = m.steps[n:]
+	if len(m.steps) > 0 {
+		for _, c := range m.steps[0].candidates {
+			c.previous = -1
+		}
+	}
+	return matches
+}
@@ -0,0 +1,55 @@
+package mapmatch
+
+import (
+	"testing"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+	"github.com/stretchr/testify/require"
+)
+
+// testNetwork is a road along latitude 45.5 and a parallel one 28m north,
+// only joined at their ends.
+func testNetwork() *roads.Index {
+	point := func(wayID int64, nodeID int64, lon, lat float64) *roads.Point {
+		return &roads.Point{Lon: lon, Lat: lat, WayID: wayID, NodeID: nodeID}
+	}
+
+	return roads.NewIndex([]*roads.Way{
+		{ID: 1, Points: []*roads.Point{point(1, 1, -73.600, 45.5), point(1, 2, -73.595, 45.5), point(1, 3, -73.590, 45.5)}},
+		{ID: 2, Points: []*roads.Point{point(2, 1, -73.600, 45.5), point(2, 4, -73.600, 45.50025), point(2, 5, -73.590, 45.50025), point(2, 3, -73.590, 45.5)}},
+	})
+}
+
+func TestMatcher_Add(t *testing.T) {
+	m := NewMatcher(testNetwork(), WithWindow(3))
+
+	lats := []float64{45.50010, 45.50008, 45.50018, 45.50009, 45.50011, 45.50010}
+	var matches []*Match
+	for i, lat := range lats {
+		matches = append(matches, m.Add(&Fix{Lon: -73.599 + float64(i)*0.0005, Lat: lat})...)
+		if i < 3 {
+			require.Len(t, matches, 0, "fixes are decided once the window is full")
+		}
+	}
+	matches = append(matches, m.Flush()...)
+
+	require.Len(t, matches, len(lats))
+	for i, match := range matches {
+		require.Equal(t, int64(1), match.WayID, "fix %d", i)
+		require.InDelta(t, 45.5, match.Lat, 1e-9)
+		require.Greater(t, match.Confidence, 0.5)
+	}
+}
+
+func TestMatcher_Unmatched(t *testing.T) {
+	m := NewMatcher(testNetwork())
+
+	matches := m.Add(&Fix{Lon: -73.597, Lat: 45.50010})
+	require.Len(t, matches, 0)
+
+	matches = m.Add(&Fix{Lon: -73.597, Lat: 45.51})
+	require.Len(t, matches, 2)
+	require.Equal(t, int64(1), matches[0].WayID)
+	require.Equal(t, int64(0), matches[1].WayID)
+	require.Equal(t, 45.51, matches[1].Lat)
+}
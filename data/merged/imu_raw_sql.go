@@ -1,66 +1,107 @@
 package merged
 
 import (
-	"encoding/json"
+	"time"
 
 	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/align"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
 	"github.com/streamingfast/imu-controller/device/iim42652"
 )
 
+// ImuRawCreateTable creates the imu_raw_samples table, referencing its gnss
+// fix in the gnss table, and the imu_raw view joining them in the shape of the
+// former imu_raw table.
 const ImuRawCreateTable string = `
-	CREATE TABLE IF NOT EXISTS imu_raw (
+	CREATE TABLE IF NOT EXISTS imu_raw_samples (
 		id INTEGER NOT NULL PRIMARY KEY,
 		imu_time TIMESTAMP NOT NULL,
+		imu_system_time TIMESTAMP NOT NULL,
 		imu_acc_x REAL NOT NULL,
 		imu_acc_y REAL NOT NULL,
 		imu_acc_z REAL NOT NULL,
 		imu_temperature REAL NOT NULL,
-		gnss_system_time TIMESTAMP NOT NULL,
-		gnss_time TIMESTAMP NOT NULL,
-		gnss_fix TEXT NOT NULL,
-		gnss_ttff INTEGER NOT NULL,
-		gnss_latitude REAL NOT NULL,
-		gnss_longitude REAL NOT NULL,
-		gnss_altitude REAL NOT NULL,
-		gnss_speed REAL NOT NULL,
-		gnss_heading REAL NOT NULL,
-		gnss_satellites_seen INTEGER NOT NULL,
-		gnss_satellites_used INTEGER NOT NULL,
-		gnss_eph INTEGER NOT NULL,
-		gnss_horizontal_accuracy REAL NOT NULL,
-		gnss_vertical_accuracy	REAL NOT NULL,
-		gnss_heading_accuracy REAL NOT NULL,
-		gnss_speed_accuracy REAL NOT NULL,
-		gnss_dop_h REAL NOT NULL,
-		gnss_dop_v REAL NOT NULL,
-		gnss_dop_x REAL NOT NULL,
-		gnss_dop_y REAL NOT NULL,
-		gnss_dop_t REAL NOT NULL,
-		gnss_dop_p REAL NOT NULL,
-		gnss_dop_g REAL NOT NULL,
-		gnss_rf_jamming_state TEXT NOT NULL,
-		gnss_rf_ant_status TEXT NOT NULL,
-		gnss_rf_ant_power TEXT NOT NULL,
-		gnss_rf_post_status INTEGER NOT NULL,
-		gnss_rf_noise_per_ms INTEGER NOT NULL,
-		gnss_rf_agc_cnt INTEGER NOT NULL,
-		gnss_rf_jam_ind INTEGER NOT NULL,
-		gnss_rf_ofs_i INTEGER NOT NULL,
-		gnss_rf_mag_i INTEGER NOT NULL,
-		gnss_rf_ofs_q INTEGER NOT NULL,
-		gnss_gga TEXT NOT NULL,
-		gnss_rxm_measx TEXT NOT NULL
+		gnss_id INTEGER NOT NULL,
+		position_latitude REAL NOT NULL,
+		position_longitude REAL NOT NULL,
+		position_accuracy REAL NOT NULL,
+		position_source TEXT NOT NULL,
+		interpolated_latitude REAL NOT NULL,
+		interpolated_longitude REAL NOT NULL,
+		interpolated_speed REAL NOT NULL,
+		interpolated_heading REAL NOT NULL,
+		interpolated INTEGER NOT NULL,
+		gnss_fix_age REAL NOT NULL
 	);
-	create index if not exists imu_raw_imu_time_idx on imu_raw(imu_time);
+	create index if not exists imu_raw_samples_imu_time_idx on imu_raw_samples(imu_time);
+	create index if not exists imu_raw_samples_gnss_id_idx on imu_raw_samples(gnss_id);
+
+	CREATE VIEW IF NOT EXISTS imu_raw AS
+	SELECT
+		s.id,
+		s.imu_time,
+		s.imu_system_time,
+		s.imu_acc_x,
+		s.imu_acc_y,
+		s.imu_acc_z,
+		s.imu_temperature,
+		g.system_time AS gnss_system_time,
+		g.time AS gnss_time,
+		g.fix AS gnss_fix,
+		g.ttff AS gnss_ttff,
+		g.latitude AS gnss_latitude,
+		g.longitude AS gnss_longitude,
+		g.raw_latitude AS gnss_raw_latitude,
+		g.raw_longitude AS gnss_raw_longitude,
+		g.altitude AS gnss_altitude,
+		g.speed AS gnss_speed,
+		g.heading AS gnss_heading,
+		g.satellites_seen AS gnss_satellites_seen,
+		g.satellites_used AS gnss_satellites_used,
+		g.eph AS gnss_eph,
+		g.horizontal_accuracy AS gnss_horizontal_accuracy,
+		g.vertical_accuracy AS gnss_vertical_accuracy,
+		g.heading_accuracy AS gnss_heading_accuracy,
+		g.speed_accuracy AS gnss_speed_accuracy,
+		g.dop_h AS gnss_dop_h,
+		g.dop_v AS gnss_dop_v,
+		g.dop_x AS gnss_dop_x,
+		g.dop_y AS gnss_dop_y,
+		g.dop_t AS gnss_dop_t,
+		g.dop_p AS gnss_dop_p,
+		g.dop_g AS gnss_dop_g,
+		g.rf_jamming_state AS gnss_rf_jamming_state,
+		g.rf_ant_status AS gnss_rf_ant_status,
+		g.rf_ant_power AS gnss_rf_ant_power,
+		g.rf_post_status AS gnss_rf_post_status,
+		g.rf_noise_per_ms AS gnss_rf_noise_per_ms,
+		g.rf_agc_cnt AS gnss_rf_agc_cnt,
+		g.rf_jam_ind AS gnss_rf_jam_ind,
+		g.rf_ofs_i AS gnss_rf_ofs_i,
+		g.rf_mag_i AS gnss_rf_mag_i,
+		g.rf_ofs_q AS gnss_rf_ofs_q,
+		g.gga AS gnss_gga,
+		s.position_latitude,
+		s.position_longitude,
+		s.position_accuracy,
+		s.position_source,
+		s.interpolated_latitude,
+		s.interpolated_longitude,
+		s.interpolated_speed,
+		s.interpolated_heading,
+		s.interpolated,
+		s.gnss_fix_age
+	FROM imu_raw_samples s
+	JOIN gnss g ON g.id = s.gnss_id;
 `
 
-const insertRawQuery string = `INSERT INTO imu_raw VALUES`
+const insertRawQuery string = `INSERT INTO imu_raw_samples VALUES`
 
-const insertRawFields string = `(NULL,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?),`
+const insertRawFields string = `(NULL,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?),`
 
 const imuRawPurgeQuery string = `
-	DELETE FROM imu_raw WHERE imu_time < ?;
+	DELETE FROM imu_raw_samples WHERE imu_time < ?;
 `
 
 func ImuRawCreateTableQuery() string {
@@ -72,68 +113,76 @@ func ImuRawPurgeQuery() string {
 }
 
 type ImuRawSqlWrapper struct {
-	acceleration *imu.Acceleration
-	temperature  iim42652.Temperature
-	gnssData     *neom9n.Data
+	acceleration  *imu.Acceleration
+	imuSystemTime time.Time
+	temperature   iim42652.Temperature
+	gnssID        int64
+	gnssData      *neom9n.Data
+	position      *deadreckoning.Position
+	aligned       *align.Aligned
 	//lastImageFilename string
 }
 
-func NewImuRawSqlWrapper(temperature iim42652.Temperature, acceleration *imu.Acceleration, gnssData *neom9n.Data /*lastImageFilename string*/) *ImuRawSqlWrapper {
+// NewImuRawSqlWrapper logs the imu data referencing the last gnss data, logged
+// with gnssID, and the position of the vehicle, which is dead reckoned when
+// the gnss data is too old. The acceleration time is the gnss corrected time
+// of the imu data, imuSystemTime its system time.
+func NewImuRawSqlWrapper(temperature iim42652.Temperature, acceleration *imu.Acceleration, imuSystemTime time.Time, gnssID int64, gnssData *neom9n.Data, position *deadreckoning.Position /*lastImageFilename string*/) *ImuRawSqlWrapper {
 	return &ImuRawSqlWrapper{
-		acceleration: acceleration,
-		temperature:  temperature,
-		gnssData:     gnssData,
+		acceleration:  acceleration,
+		imuSystemTime: imuSystemTime,
+		temperature:   temperature,
+		gnssID:        gnssID,
+		gnssData:      gnssData,
+		position:      position,
 		//lastImageFilename: lastImageFilename,
 	}
 }
 
+// SampleTime is the system time of the imu data, the gnss data being aligned
+// on it.
+func (w *ImuRawSqlWrapper) SampleTime() time.Time {
+	return w.imuSystemTime
+}
+
+func (w *ImuRawSqlWrapper) Align(aligned *align.Aligned) {
+	w.aligned = aligned
+}
+
 func (w *ImuRawSqlWrapper) InsertQuery() (string, string, []any) {
-	rxmMeasx, err := json.Marshal(w.gnssData.RxmMeasx)
-	if err != nil {
-		return "", "", nil
+	// not aligned, the gnss data is held, its age unknown without a fix
+	aligned := w.aligned
+	if aligned == nil {
+		aligned = &align.Aligned{
+			Latitude:  w.gnssData.Latitude,
+			Longitude: w.gnssData.Longitude,
+			Speed:     w.gnssData.Speed,
+			Heading:   w.gnssData.Heading,
+			FixAge:    -time.Second,
+		}
+		if !w.gnssData.SystemTime.IsZero() {
+			aligned.FixAge = w.imuSystemTime.Sub(w.gnssData.SystemTime)
+		}
 	}
 
 	return insertRawQuery, insertRawFields, []any{
 		w.acceleration.Time.Format("2006-01-02 15:04:05.99999"),
+		w.imuSystemTime.Format("2006-01-02 15:04:05.99999"),
 		w.acceleration.Y, //this is not a mistake
 		w.acceleration.Z, //this is not a mistake
 		w.acceleration.X, //this is not a mistake
 		*w.temperature,
-		w.gnssData.SystemTime.Format("2006-01-02 15:04:05.99999"),
-		w.gnssData.Timestamp.Format("2006-01-02 15:04:05.99999"),
-		w.gnssData.Fix,
-		w.gnssData.Ttff,
-		w.gnssData.Latitude,
-		w.gnssData.Longitude,
-		w.gnssData.Altitude,
-		w.gnssData.Speed,
-		w.gnssData.Heading,
-		w.gnssData.Satellites.Seen,
-		w.gnssData.Satellites.Used,
-		w.gnssData.Eph,
-		w.gnssData.HorizontalAccuracy,
-		w.gnssData.VerticalAccuracy,
-		w.gnssData.HeadingAccuracy,
-		w.gnssData.SpeedAccuracy,
-		w.gnssData.Dop.HDop,
-		w.gnssData.Dop.VDop,
-		w.gnssData.Dop.XDop,
-		w.gnssData.Dop.YDop,
-		w.gnssData.Dop.TDop,
-		w.gnssData.Dop.PDop,
-		w.gnssData.Dop.GDop,
-		w.gnssData.RF.JammingState,
-		w.gnssData.RF.AntStatus,
-		w.gnssData.RF.AntPower,
-		w.gnssData.RF.PostStatus,
-		w.gnssData.RF.NoisePerMS,
-		w.gnssData.RF.AgcCnt,
-		w.gnssData.RF.JamInd,
-		w.gnssData.RF.OfsI,
-		w.gnssData.RF.MagI,
-		w.gnssData.RF.OfsQ,
-		w.gnssData.GGA,
-		string(rxmMeasx),
+		w.gnssID,
+		w.position.Latitude,
+		w.position.Longitude,
+		w.position.Accuracy,
+		w.position.Source,
+		aligned.Latitude,
+		aligned.Longitude,
+		aligned.Speed,
+		aligned.Heading,
+		aligned.Interpolated,
+		aligned.FixAge.Seconds(),
 		//w.lastImageFilename,
 	}
 }
@@ -1,13 +1,15 @@
 package merged
 
 import (
-	"github.com/streamingfast/gnss-controller/device/neom9n"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
 	"github.com/streamingfast/imu-controller/device/iim42652"
 )
 
+// MergedCreateTable creates the merged_samples table, referencing its gnss fix
+// in the gnss table, and the merged view joining them in the shape of the
+// former merged table.
 const MergedCreateTable string = `
-	CREATE TABLE IF NOT EXISTS merged (
+	CREATE TABLE IF NOT EXISTS merged_samples (
 		id INTEGER NOT NULL PRIMARY KEY,
 		imu_time TIMESTAMP NOT NULL,
 		imu_magnitude REAL NOT NULL,
@@ -19,48 +21,66 @@ const MergedCreateTable string = `
 		imu_tilt_angle_z REAL NOT NULL,
 		imu_temperature REAL NOT NULL,
 		cam_orientation TEXT NOT NULL,
-		gnss_system_time TIMESTAMP NOT NULL,
-		gnss_time TIMESTAMP NOT NULL,
-		gnss_fix TEXT NOT NULL,
-		gnss_ttff INTEGER NOT NULL,
-		gnss_latitude REAL NOT NULL,
-		gnss_longitude REAL NOT NULL,
-		gnss_altitude REAL NOT NULL,
-		gnss_speed REAL NOT NULL,
-		gnss_heading REAL NOT NULL,
-		gnss_satellites_seen INTEGER NOT NULL,
-		gnss_satellites_used INTEGER NOT NULL,
-		gnss_eph INTEGER NOT NULL,
-		gnss_horizontal_accuracy REAL NOT NULL,
-		gnss_vertical_accuracy	REAL NOT NULL,
-		gnss_heading_accuracy REAL NOT NULL,
-		gnss_speed_accuracy REAL NOT NULL,
-		gnss_dop_h REAL NOT NULL,
-		gnss_dop_v REAL NOT NULL,
-		gnss_dop_x REAL NOT NULL,
-		gnss_dop_y REAL NOT NULL,
-		gnss_dop_t REAL NOT NULL,
-		gnss_dop_p REAL NOT NULL,
-		gnss_dop_g REAL NOT NULL,
-		gnss_rf_jamming_state TEXT NOT NULL,
-		gnss_rf_ant_status TEXT NOT NULL,
-		gnss_rf_ant_power TEXT NOT NULL,
-		gnss_rf_post_status INTEGER NOT NULL,
-		gnss_rf_noise_per_ms INTEGER NOT NULL,
-		gnss_rf_agc_cnt INTEGER NOT NULL,
-		gnss_rf_jam_ind INTEGER NOT NULL,
-		gnss_rf_ofs_i INTEGER NOT NULL,
-		gnss_rf_mag_i INTEGER NOT NULL,
-		gnss_rf_ofs_q INTEGER NOT NULL
+		gnss_id INTEGER NOT NULL
 	);
-	create index if not exists merged_imu_time_idx on merged(imu_time);
+	create index if not exists merged_samples_imu_time_idx on merged_samples(imu_time);
+	create index if not exists merged_samples_gnss_id_idx on merged_samples(gnss_id);
+
+	CREATE VIEW IF NOT EXISTS merged AS
+	SELECT
+		m.id,
+		m.imu_time,
+		m.imu_magnitude,
+		m.imu_acc_x,
+		m.imu_tilt_angle_x,
+		m.imu_acc_y,
+		m.imu_tilt_angle_y,
+		m.imu_acc_z,
+		m.imu_tilt_angle_z,
+		m.imu_temperature,
+		m.cam_orientation,
+		g.system_time AS gnss_system_time,
+		g.time AS gnss_time,
+		g.fix AS gnss_fix,
+		g.ttff AS gnss_ttff,
+		g.latitude AS gnss_latitude,
+		g.longitude AS gnss_longitude,
+		g.altitude AS gnss_altitude,
+		g.speed AS gnss_speed,
+		g.heading AS gnss_heading,
+		g.satellites_seen AS gnss_satellites_seen,
+		g.satellites_used AS gnss_satellites_used,
+		g.eph AS gnss_eph,
+		g.horizontal_accuracy AS gnss_horizontal_accuracy,
+		g.vertical_accuracy AS gnss_vertical_accuracy,
+		g.heading_accuracy AS gnss_heading_accuracy,
+		g.speed_accuracy AS gnss_speed_accuracy,
+		g.dop_h AS gnss_dop_h,
+		g.dop_v AS gnss_dop_v,
+		g.dop_x AS gnss_dop_x,
+		g.dop_y AS gnss_dop_y,
+		g.dop_t AS gnss_dop_t,
+		g.dop_p AS gnss_dop_p,
+		g.dop_g AS gnss_dop_g,
+		g.rf_jamming_state AS gnss_rf_jamming_state,
+		g.rf_ant_status AS gnss_rf_ant_status,
+		g.rf_ant_power AS gnss_rf_ant_power,
+		g.rf_post_status AS gnss_rf_post_status,
+		g.rf_noise_per_ms AS gnss_rf_noise_per_ms,
+		g.rf_agc_cnt AS gnss_rf_agc_cnt,
+		g.rf_jam_ind AS gnss_rf_jam_ind,
+		g.rf_ofs_i AS gnss_rf_ofs_i,
+		g.rf_mag_i AS gnss_rf_mag_i,
+		g.rf_ofs_q AS gnss_rf_ofs_q
+	FROM merged_samples m
+	JOIN gnss g ON g.id = m.gnss_id;
 `
 
-const insertMergedQuery string = `INSERT INTO merged VALUES `
-const insertMergedFields string = `(NULL,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?),`
+const insertMergedQuery string = `INSERT INTO merged_samples VALUES `
+const insertMergedFields string = `(NULL,?,?,?,?,?,?,?,?,?,?,?),`
 
 const purgeQuery string = `
-	DELETE FROM merged WHERE imu_time < ?;
+	DELETE FROM merged_samples WHERE imu_time < ?;
 `
 
 func CreateTableQuery() string {
@@ -72,20 +92,22 @@ func PurgeQuery() string {
 }
 
 type SqlWrapper struct {
-	gnssData     *neom9n.Data
+	gnssID       int64
 	acceleration *imu.Acceleration
 	tiltAngles   *imu.TiltAngles
 	temperature  iim42652.Temperature
 	orientation  imu.Orientation
 }
 
-func NewSqlWrapper(acceleration *imu.Acceleration, tiltAngles *imu.TiltAngles, gnssData *neom9n.Data, temperature iim42652.Temperature, orientation imu.Orientation) *SqlWrapper {
+// NewSqlWrapper logs the oriented imu data referencing the last gnss data,
+// logged with gnssID.
+func NewSqlWrapper(acceleration *imu.Acceleration, tiltAngles *imu.TiltAngles, gnssID int64, temperature iim42652.Temperature, orientation imu.Orientation) *SqlWrapper {
 	return &SqlWrapper{
 		acceleration: acceleration,
 		tiltAngles:   tiltAngles,
 		orientation:  orientation,
 		temperature:  temperature,
-		gnssData:     gnssData,
+		gnssID:       gnssID,
 	}
 }
 
@@ -101,38 +123,6 @@ func (w *SqlWrapper) InsertQuery() (string, string, []any) {
 		w.tiltAngles.Z,
 		*w.temperature,
 		w.orientation,
-		w.gnssData.SystemTime.Format("2006-01-02 15:04:05.99999"), //FIXME: remove the format only there for python a marde
-		w.gnssData.Timestamp.Format("2006-01-02 15:04:05.99999"),  //FIXME: remove the format only there for python a marde
-		w.gnssData.Fix,
-		w.gnssData.Ttff,
-		w.gnssData.Latitude,
-		w.gnssData.Longitude,
-		w.gnssData.Altitude,
-		w.gnssData.Speed,
-		w.gnssData.Heading,
-		w.gnssData.Satellites.Seen,
-		w.gnssData.Satellites.Used,
-		w.gnssData.Eph,
-		w.gnssData.HorizontalAccuracy,
-		w.gnssData.VerticalAccuracy,
-		w.gnssData.HeadingAccuracy,
-		w.gnssData.SpeedAccuracy,
-		w.gnssData.Dop.HDop,
-		w.gnssData.Dop.VDop,
-		w.gnssData.Dop.XDop,
-		w.gnssData.Dop.YDop,
-		w.gnssData.Dop.TDop,
-		w.gnssData.Dop.PDop,
-		w.gnssData.Dop.GDop,
-		w.gnssData.RF.JammingState,
-		w.gnssData.RF.AntStatus,
-		w.gnssData.RF.AntPower,
-		w.gnssData.RF.PostStatus,
-		w.gnssData.RF.NoisePerMS,
-		w.gnssData.RF.AgcCnt,
-		w.gnssData.RF.JamInd,
-		w.gnssData.RF.OfsI,
-		w.gnssData.RF.MagI,
-		w.gnssData.RF.OfsQ,
+		w.gnssID,
 	}
 }
@@ -0,0 +1,168 @@
+package merged
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+	"github.com/stretchr/testify/require"
+)
+
+func exec(t *testing.T, sqlite *logger.Sqlite, s logger.Sqlable) {
+	query, fields, params := s.InsertQuery()
+	require.NoError(t, sqlite.Exec(query+strings.TrimSuffix(fields, ","), params...))
+}
+
+func fix(systemTime time.Time, latitude float64) *neom9n.Data {
+	return &neom9n.Data{
+		SystemTime: systemTime,
+		Timestamp:  systemTime,
+		Fix:        "3D",
+		Latitude:   latitude,
+		Longitude:  -73.44,
+		Dop:        &neom9n.Dop{HDop: 0.9},
+		Satellites: &neom9n.Satellites{Seen: 20, Used: 12},
+		RF:         &neom9n.RF{JammingState: "ok"},
+	}
+}
+
+func TestViews(t *testing.T) {
+	sqlite := logger.NewSqlite(
+		path.Join(t.TempDir(), "merged.db"),
+		[]logger.CreateTableQueryFunc{gnss.CreateTableQuery, CreateTableQuery, ImuRawCreateTableQuery},
+		[]logger.PurgeQueryFunc{PurgeQuery, ImuRawPurgeQuery, gnss.PurgeQuery},
+	)
+	require.NoError(t, sqlite.Init(0))
+
+	// the second fix is the last one before a fix loss, referenced by imu data
+	// more recent than the ttl
+	now := time.Now().UTC()
+	old := fix(now.Add(-3*time.Hour), 45.1)
+	lastBeforeLoss := fix(now.Add(-2*time.Hour), 45.2)
+	raw := fix(now.Add(-2*time.Hour), 45.25)
+	recent := fix(now.Add(-time.Minute), 45.3)
+	exec(t, sqlite, gnss.NewSqlWrapper(1, old, old))
+	exec(t, sqlite, gnss.NewSqlWrapper(2, lastBeforeLoss, raw))
+	exec(t, sqlite, gnss.NewSqlWrapper(3, recent, recent))
+
+	for i, gnssID := range []int64{2, 2, 3} {
+		acceleration := imu.NewAcceleration(float64(i), 0, 1, 1, now.Add(time.Duration(i-30)*time.Second))
+		exec(t, sqlite, NewSqlWrapper(acceleration, &imu.TiltAngles{X: 1}, gnssID, iim42652.NewTemperature(20), imu.OrientationFront))
+		exec(t, sqlite, NewImuRawSqlWrapper(iim42652.NewTemperature(20), acceleration, acceleration.Time, gnssID, recent, deadreckoning.NewGnssPosition(recent)))
+	}
+
+	var rows []string
+	require.NoError(t, sqlite.Query(false, "SELECT imu_acc_z, gnss_latitude, gnss_raw_latitude, gnss_satellites_used, gnss_rf_jamming_state FROM imu_raw ORDER BY id", func(r *sql.Rows) error {
+		var x, latitude, rawLatitude float64
+		var used int
+		var jammingState string
+		err := r.Scan(&x, &latitude, &rawLatitude, &used, &jammingState)
+		rows = append(rows, fmt.Sprintf("%.0f %.2f %.2f %d %s", x, latitude, rawLatitude, used, jammingState))
+		return err
+	}, nil))
+	require.Equal(t, []string{"0 45.20 45.25 12 ok", "1 45.20 45.25 12 ok", "2 45.30 45.30 12 ok"}, rows)
+
+	data, err := sqlite.FetchRawMergedData(now.Add(-time.Hour).Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"), true, true)
+	require.NoError(t, err)
+	require.Len(t, data, 3)
+	require.Equal(t, 45.2, data[0].GnssData.Latitude)
+	require.Equal(t, 0.9, data[0].GnssData.Dop.HDop)
+	require.Equal(t, 1.0, data[0].Gyro.X)
+	require.Equal(t, 2.0, data[2].Acceleration.X)
+	require.Equal(t, 45.3, data[2].GnssData.Latitude)
+
+	require.NoError(t, sqlite.Purge(time.Hour))
+
+	var ids []int64
+	require.NoError(t, sqlite.Query(false, "SELECT id FROM gnss ORDER BY id", func(r *sql.Rows) error {
+		var id int64
+		err := r.Scan(&id)
+		ids = append(ids, id)
+		return err
+	}, nil))
+	require.Equal(t, []int64{2, 3}, ids, "the old fix still referenced is kept")
+}
+
+// legacySchema is the wide imu tables of the databases logged before the gnss
+// table, trimmed to a few of their columns.
+const legacySchema = `
+	CREATE TABLE merged (
+		id INTEGER NOT NULL PRIMARY KEY,
+		imu_time TIMESTAMP NOT NULL,
+		imu_acc_x REAL NOT NULL,
+		gnss_latitude REAL NOT NULL
+	);
+	create index merged_imu_time_idx on merged(imu_time);
+	CREATE TABLE imu_raw (
+		id INTEGER NOT NULL PRIMARY KEY,
+		imu_time TIMESTAMP NOT NULL,
+		imu_acc_x REAL NOT NULL,
+		gnss_latitude REAL NOT NULL
+	);
+	create index imu_raw_imu_time_idx on imu_raw(imu_time);
+	INSERT INTO merged VALUES (NULL, '2023-09-01 12:00:00', 0.5, 45.1);
+	INSERT INTO imu_raw VALUES (NULL, '2023-09-01 12:00:00', 0.5, 45.1);
+`
+
+func TestViews_LegacyTables(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "merged.db")
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec(legacySchema)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	sqlite := logger.NewSqlite(dbPath, []logger.CreateTableQueryFunc{gnss.CreateTableQuery, CreateTableQuery, ImuRawCreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+
+	objects := func() []string {
+		var objects []string
+		require.NoError(t, sqlite.Query(false, "SELECT type, name FROM sqlite_master WHERE name IN ('merged', 'imu_raw', 'merged_v1', 'imu_raw_v1') ORDER BY name", func(r *sql.Rows) error {
+			var kind, name string
+			err := r.Scan(&kind, &name)
+			objects = append(objects, kind+" "+name)
+			return err
+		}, nil))
+		return objects
+	}
+	require.Equal(t, []string{"view imu_raw", "table imu_raw_v1", "view merged", "table merged_v1"}, objects())
+
+	now := time.Now().UTC()
+	d := fix(now, 45.3)
+	exec(t, sqlite, gnss.NewSqlWrapper(1, d, d))
+	acceleration := imu.NewAcceleration(1, 0, 1, 1, now)
+	exec(t, sqlite, NewSqlWrapper(acceleration, &imu.TiltAngles{X: 1}, 1, iim42652.NewTemperature(20), imu.OrientationFront))
+	exec(t, sqlite, NewImuRawSqlWrapper(iim42652.NewTemperature(20), acceleration, acceleration.Time, 1, d, deadreckoning.NewGnssPosition(d)))
+
+	// the legacy rows are kept aside, the views only reading the new ones
+	for table, expected := range map[string][]float64{"merged": {45.3}, "imu_raw": {45.3}, "merged_v1": {45.1}, "imu_raw_v1": {45.1}} {
+		var latitudes []float64
+		require.NoError(t, sqlite.Query(false, "SELECT gnss_latitude FROM "+table, func(r *sql.Rows) error {
+			var latitude float64
+			err := r.Scan(&latitude)
+			latitudes = append(latitudes, latitude)
+			return err
+		}, nil))
+		require.Equal(t, expected, latitudes, table)
+	}
+
+	// the legacy tables are purged with the ttl, and dropped once empty
+	require.NoError(t, sqlite.Exec("INSERT INTO imu_raw_v1 VALUES (NULL, ?, 0.5, 45.2)", now.Format("2006-01-02 15:04:05")))
+	require.NoError(t, sqlite.Purge(time.Hour))
+	require.Equal(t, []string{"view imu_raw", "table imu_raw_v1", "view merged"}, objects())
+
+	var count int
+	require.NoError(t, sqlite.SingleRowQuery("SELECT count(*) FROM imu_raw_v1", func(r *sql.Rows) error {
+		return r.Scan(&count)
+	}))
+	require.Equal(t, 1, count)
+}
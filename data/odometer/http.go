@@ -0,0 +1,31 @@
+package odometer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type distances struct {
+	TripDistance     float64 `json:"trip_distance"`
+	LifetimeDistance float64 `json:"lifetime_distance"`
+}
+
+// GetOdometer writes the trip and lifetime distances, in meters.
+func (o *Odometer) GetOdometer(w http.ResponseWriter, _ *http.Request) {
+	trip, lifetime := o.Distances()
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(&distances{TripDistance: trip, LifetimeDistance: lifetime})
+	if err != nil {
+		fmt.Fprintf(w, "error: %s", err)
+	}
+}
+
+func (o *Odometer) PostResetTrip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	o.ResetTrip()
+	o.GetOdometer(w, r)
+}
@@ -0,0 +1,249 @@
+package odometer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+)
+
+const (
+	SourceGnss          = "gnss"
+	SourceDeadReckoning = "dead_reckoning"
+)
+
+type EventHandler func(event data.Event) error
+
+// Store persists the odometer across restarts.
+type Store interface {
+	Load() (trip float64, lifetime float64, err error)
+	Save(trip float64, lifetime float64, t time.Time) error
+}
+
+type Option func(*Odometer)
+
+// WithMaxHorizontalAccuracy ignores the fixes less accurate than accuracy
+// meters.
+func WithMaxHorizontalAccuracy(accuracy float64) Option {
+	return func(o *Odometer) {
+		o.maxHorizontalAccuracy = accuracy
+	}
+}
+
+// WithMinSpeed ignores the moves of the fixes slower than speed m/s, the
+// position noise of a stopped vehicle adding up otherwise.
+func WithMinSpeed(speed float64) Option {
+	return func(o *Odometer) {
+		o.minSpeed = speed
+	}
+}
+
+// WithMaxGap sets how long without a good fix before the distance is dead
+// reckoned from the imu.
+func WithMaxGap(gap time.Duration) Option {
+	return func(o *Odometer) {
+		o.maxGap = gap
+	}
+}
+
+// WithMaxDeadReckoning sets how long after the last good fix the distance
+// is dead reckoned, the integrated acceleration drifting too much after.
+func WithMaxDeadReckoning(duration time.Duration) Option {
+	return func(o *Odometer) {
+		o.maxDeadReckoning = duration
+	}
+}
+
+func WithStore(store Store, persistInterval time.Duration) Option {
+	return func(o *Odometer) {
+		o.store = store
+		o.persistInterval = persistInterval
+	}
+}
+
+// Odometer integrates the distance between the good gnss fixes. When the
+// fixes are lost, the distance keeps growing with the one dead reckoned by a
+// deadreckoning.Estimator, its acceleration bias learnt from the good fixes,
+// and is adjusted to at least the straight line distance once a good fix is
+// back.
+type Odometer struct {
+	lock sync.Mutex
+
+	maxHorizontalAccuracy float64
+	minSpeed              float64
+	maxGap                time.Duration
+	maxDeadReckoning      time.Duration
+	store                 Store
+	persistInterval       time.Duration
+	handlers              []EventHandler
+
+	trip     float64
+	lifetime float64
+	source   string
+
+	estimator     *deadreckoning.Estimator
+	lastFix       *neom9n.Data
+	bridged       float64 // part of the distance dead reckoned since lastFix already counted
+	lastPersisted time.Time
+}
+
+func NewOdometer(handlers []EventHandler, opts ...Option) (*Odometer, error) {
+	o := &Odometer{
+		maxHorizontalAccuracy: 10,
+		minSpeed:              0.5,
+		maxGap:                3 * time.Second,
+		maxDeadReckoning:      time.Minute,
+		handlers:              handlers,
+		source:                SourceGnss,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.estimator = deadreckoning.NewEstimator(
+		deadreckoning.WithMaxDuration(o.maxDeadReckoning),
+		deadreckoning.WithMaxHorizontalAccuracy(o.maxHorizontalAccuracy),
+	)
+
+	if o.store != nil {
+		trip, lifetime, err := o.store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("loading odometer: %w", err)
+		}
+		o.trip = trip
+		o.lifetime = lifetime
+	}
+
+	return o, nil
+}
+
+// Distances returns the trip and lifetime distances in meters.
+func (o *Odometer) Distances() (trip float64, lifetime float64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.trip, o.lifetime
+}
+
+// ResetTrip starts a new trip at 0 meters.
+func (o *Odometer) ResetTrip() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.trip = 0
+	o.lastPersisted = time.Time{}
+}
+
+func (o *Odometer) isGood(d *neom9n.Data) bool {
+	if d.Fix != "2D" && d.Fix != "3D" {
+		return false
+	}
+	return d.HorizontalAccuracy <= o.maxHorizontalAccuracy
+}
+
+func (o *Odometer) add(distance float64) {
+	o.trip += distance
+	o.lifetime += distance
+}
+
+func (o *Odometer) HandleGnssData(d *neom9n.Data) error {
+	o.lock.Lock()
+	err := o.estimator.HandleGnssData(d)
+	if err != nil {
+		o.lock.Unlock()
+		return fmt.Errorf("dead reckoning: %w", err)
+	}
+	event := o.handleGnssData(d)
+	err = o.persist(d.SystemTime)
+	o.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("persisting odometer: %w", err)
+	}
+
+	for _, handler := range o.handlers {
+		err := handler(event)
+		if err != nil {
+			return fmt.Errorf("handling odometer event: %w", err)
+		}
+	}
+	return nil
+}
+
+func (o *Odometer) handleGnssData(d *neom9n.Data) *Event {
+	if !o.isGood(d) {
+		return NewEvent(o.trip, o.lifetime, o.source, d.SystemTime, d)
+	}
+
+	if o.lastFix != nil {
+		distance := geo.Distance(geo.NewCoordinate(o.lastFix.Longitude, o.lastFix.Latitude), geo.NewCoordinate(d.Longitude, d.Latitude))
+		switch {
+		case o.bridged > 0:
+			// the road distance is at least the straight line one
+			if distance > o.bridged {
+				o.add(distance - o.bridged)
+			}
+		case d.Speed >= o.minSpeed:
+			o.add(distance)
+		}
+	}
+
+	o.lastFix = d
+	o.bridged = 0
+	o.source = SourceGnss
+
+	return NewEvent(o.trip, o.lifetime, o.source, d.SystemTime, d)
+}
+
+func (o *Odometer) HandleRawImuFeed(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, temperature iim42652.Temperature) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	err := o.estimator.HandleRawImuFeed(acceleration, angularRate, temperature)
+	if err != nil {
+		return fmt.Errorf("dead reckoning: %w", err)
+	}
+	if o.lastFix == nil {
+		return nil
+	}
+
+	sinceFix := acceleration.Time.Sub(o.lastFix.SystemTime)
+	if sinceFix > o.maxGap && sinceFix <= o.maxDeadReckoning {
+		travelled := o.estimator.Travelled()
+		o.add(travelled - o.bridged)
+		o.bridged = travelled
+		o.source = SourceDeadReckoning
+	}
+	return nil
+}
+
+func (o *Odometer) persist(t time.Time) error {
+	if o.store == nil || t.Sub(o.lastPersisted) < o.persistInterval {
+		return nil
+	}
+	o.lastPersisted = t
+	return o.store.Save(o.trip, o.lifetime, t)
+}
+
+type Event struct {
+	*data.BaseEvent
+	TripDistance     float64 `json:"trip_distance"`
+	LifetimeDistance float64 `json:"lifetime_distance"`
+	Source           string  `json:"source"`
+}
+
+func NewEvent(trip float64, lifetime float64, source string, t time.Time, gnssData *neom9n.Data) *Event {
+	return &Event{
+		BaseEvent:        data.NewBaseEvent("ODOMETER_EVENT", "ODOMETER", t, gnssData),
+		TripDistance:     trip,
+		LifetimeDistance: lifetime,
+		Source:           source,
+	}
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("Odometer Event trip %.0fm lifetime %.0fm (%s)", e.TripDistance, e.LifetimeDistance, e.Source)
+}
@@ -0,0 +1,181 @@
+package odometer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+var origin = geo.NewCoordinate(-73.4391, 45.5752)
+
+// fix is a gnss fix `meters` east of origin at `seconds`.
+func fix(seconds float64, meters float64, speed float64, fixType string, accuracy float64) *neom9n.Data {
+	c := geo.DestinationPoint(origin, 90, meters)
+	return &neom9n.Data{
+		SystemTime:         start.Add(time.Duration(seconds * float64(time.Second))),
+		Fix:                fixType,
+		Longitude:          c.Lon,
+		Latitude:           c.Lat,
+		Speed:              speed,
+		HorizontalAccuracy: accuracy,
+	}
+}
+
+func TestOdometer_Gnss(t *testing.T) {
+	tests := []struct {
+		name         string
+		fixes        []*neom9n.Data
+		expectedTrip float64
+	}{
+		{
+			name:         "moving",
+			fixes:        []*neom9n.Data{fix(0, 0, 10, "3D", 2), fix(1, 10, 10, "3D", 2), fix(2, 20, 10, "2D", 2)},
+			expectedTrip: 20,
+		},
+		{
+			name:         "no fix and inaccurate fixes skipped",
+			fixes:        []*neom9n.Data{fix(0, 0, 10, "3D", 2), fix(1, 500, 10, "none", 2), fix(2, 20, 10, "3D", 50), fix(3, 30, 10, "3D", 2)},
+			expectedTrip: 30,
+		},
+		{
+			name:         "stopped jitter",
+			fixes:        []*neom9n.Data{fix(0, 0, 0, "3D", 2), fix(1, 2, 0.1, "3D", 2), fix(2, -1, 0.2, "3D", 2), fix(3, 11, 10, "3D", 2)},
+			expectedTrip: 12,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []data.Event
+			o, err := NewOdometer([]EventHandler{func(event data.Event) error {
+				events = append(events, event)
+				return nil
+			}})
+			require.NoError(t, err)
+
+			for _, f := range test.fixes {
+				require.NoError(t, o.HandleGnssData(f))
+			}
+
+			trip, lifetime := o.Distances()
+			require.InDelta(t, test.expectedTrip, trip, 0.01)
+			require.InDelta(t, test.expectedTrip, lifetime, 0.01)
+			require.Len(t, events, len(test.fixes))
+			require.InDelta(t, test.expectedTrip, events[len(events)-1].(*Event).TripDistance, 0.01)
+		})
+	}
+}
+
+func TestOdometer_DeadReckoning(t *testing.T) {
+	tests := []struct {
+		name         string
+		tilt         float64 // g, of the mount on the imu X axis
+		acceleration float64 // g
+		nextFix      *neom9n.Data
+		expectedGap  float64
+		expectedTrip float64
+	}{
+		{
+			name:         "constant speed, longer road than straight line",
+			nextFix:      fix(10, 80, 10, "3D", 2),
+			expectedGap:  100,
+			expectedTrip: 100,
+		},
+		{
+			name:         "constant speed, adjusted to straight line",
+			nextFix:      fix(10, 130, 10, "3D", 2),
+			expectedGap:  100,
+			expectedTrip: 130,
+		},
+		{
+			name:         "braking to a stop",
+			acceleration: -0.102, // 1 m/s²
+			nextFix:      fix(10, 40, 0, "3D", 2),
+			expectedGap:  50,
+			expectedTrip: 50,
+		},
+		{
+			name:         "tilted mount, bias learnt from the good fixes",
+			tilt:         0.035, // 2°
+			nextFix:      fix(10, 80, 10, "3D", 2),
+			expectedGap:  100,
+			expectedTrip: 100,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := NewOdometer(nil)
+			require.NoError(t, err)
+
+			// driving at 10 m/s with good fixes before the gap
+			for i := -50; i < 0; i++ {
+				if i%10 == 0 {
+					require.NoError(t, o.HandleGnssData(fix(float64(i)/10, float64(i), 10, "3D", 2)))
+				}
+				at := start.Add(time.Duration(i) * 100 * time.Millisecond)
+				require.NoError(t, o.HandleRawImuFeed(imu.NewAcceleration(test.tilt, 0, 1, 1, at), nil, nil))
+			}
+			require.NoError(t, o.HandleGnssData(fix(0, 0, 10, "3D", 2)))
+			o.ResetTrip()
+
+			for i := 0; i <= 100; i++ {
+				at := start.Add(time.Duration(i) * 100 * time.Millisecond)
+				require.NoError(t, o.HandleRawImuFeed(imu.NewAcceleration(test.tilt+test.acceleration, 0, 1, 1, at), nil, nil))
+				if i%10 == 5 {
+					require.NoError(t, o.HandleGnssData(fix(float64(i)/10, 0, 0, "none", 0)))
+				}
+			}
+
+			trip, _ := o.Distances()
+			require.InDelta(t, test.expectedGap, trip, 1)
+			require.Equal(t, SourceDeadReckoning, o.source)
+
+			require.NoError(t, o.HandleGnssData(test.nextFix))
+			trip, _ = o.Distances()
+			require.InDelta(t, test.expectedTrip, trip, 1)
+			require.Equal(t, SourceGnss, o.source)
+		})
+	}
+}
+
+type memoryStore struct {
+	trip     float64
+	lifetime float64
+	saves    int
+}
+
+func (s *memoryStore) Load() (float64, float64, error) {
+	return s.trip, s.lifetime, nil
+}
+
+func (s *memoryStore) Save(trip float64, lifetime float64, _ time.Time) error {
+	s.trip = trip
+	s.lifetime = lifetime
+	s.saves++
+	return nil
+}
+
+func TestOdometer_Store(t *testing.T) {
+	store := &memoryStore{trip: 100, lifetime: 5000}
+	o, err := NewOdometer(nil, WithStore(store, 10*time.Second))
+	require.NoError(t, err)
+
+	for i := 0; i <= 20; i++ {
+		require.NoError(t, o.HandleGnssData(fix(float64(i), float64(i*10), 10, "3D", 2)))
+	}
+	require.Equal(t, 3, store.saves)
+	require.InDelta(t, 300, store.trip, 0.01)
+	require.InDelta(t, 5200, store.lifetime, 0.01)
+
+	o.ResetTrip()
+	require.NoError(t, o.HandleGnssData(fix(21, 210, 10, "3D", 2)))
+	require.InDelta(t, 10, store.trip, 0.01)
+	require.InDelta(t, 5210, store.lifetime, 0.01)
+}
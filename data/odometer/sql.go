@@ -0,0 +1,75 @@
+package odometer
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+// The odometer table is not purged: it holds the trip and lifetime distances
+// rows, updated in place.
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS odometer (
+		name TEXT NOT NULL PRIMARY KEY,
+		distance REAL NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+`
+
+const upsertQuery string = `
+	INSERT INTO odometer VALUES(?,?,?)
+	ON CONFLICT(name) DO UPDATE SET distance = excluded.distance, updated_at = excluded.updated_at;
+`
+
+const selectQuery string = `
+	SELECT name, distance FROM odometer;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+type SqlStore struct {
+	sqlite *logger.Sqlite
+}
+
+func NewSqlStore(sqlite *logger.Sqlite) *SqlStore {
+	return &SqlStore{sqlite: sqlite}
+}
+
+func (s *SqlStore) Load() (trip float64, lifetime float64, err error) {
+	err = s.sqlite.Query(false, selectQuery, func(rows *sql.Rows) error {
+		var name string
+		var distance float64
+		err := rows.Scan(&name, &distance)
+		if err != nil {
+			return fmt.Errorf("scanning odometer: %w", err)
+		}
+		switch name {
+		case "trip":
+			trip = distance
+		case "lifetime":
+			lifetime = distance
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("querying odometer: %w", err)
+	}
+	return trip, lifetime, nil
+}
+
+func (s *SqlStore) Save(trip float64, lifetime float64, t time.Time) error {
+	updatedAt := t.Format("2006-01-02 15:04:05.99999")
+	err := s.sqlite.Exec(upsertQuery, "trip", trip, updatedAt)
+	if err != nil {
+		return fmt.Errorf("saving trip distance: %w", err)
+	}
+	err = s.sqlite.Exec(upsertQuery, "lifetime", lifetime, updatedAt)
+	if err != nil {
+		return fmt.Errorf("saving lifetime distance: %w", err)
+	}
+	return nil
+}
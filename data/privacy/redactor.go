@@ -0,0 +1,223 @@
+package privacy
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+const (
+	// ModeOmit drops the gnss json logs and zeroes the coordinates stored.
+	ModeOmit = "omit"
+	// ModeFuzz snaps the coordinates to the center of a coarse grid cell.
+	ModeFuzz = "fuzz"
+
+	ActionStart = "start"
+	ActionEnd   = "end"
+)
+
+// Redaction is an audit record of the redaction starting or ending.
+type Redaction struct {
+	Time   time.Time
+	ZoneID string
+	Action string
+	Mode   string
+	// Fixes is the number of fixes redacted, on end.
+	Fixes int
+}
+
+// Store keeps the audit of the redactions.
+type Store interface {
+	SaveRedaction(r *Redaction) error
+}
+
+type Option func(*Redactor)
+
+// WithMode sets the redaction mode, ModeOmit or ModeFuzz.
+func WithMode(mode string) Option {
+	return func(r *Redactor) {
+		r.mode = mode
+	}
+}
+
+// WithExitDistance sets the distance, in meters, travelled after leaving a
+// zone during which the redaction goes on, so the zone cannot be told from
+// where the data starts.
+func WithExitDistance(distance float64) Option {
+	return func(r *Redactor) {
+		r.exitDistance = distance
+	}
+}
+
+// WithFuzzGrid sets the size, in meters, of the grid the coordinates are
+// snapped to in ModeFuzz.
+func WithFuzzGrid(size float64) Option {
+	return func(r *Redactor) {
+		r.fuzzGrid = size
+	}
+}
+
+func WithStore(store Store) Option {
+	return func(r *Redactor) {
+		r.store = store
+	}
+}
+
+// Redactor decides, from the gnss fixes, when the logged data is inside a
+// privacy zone, or has not yet left it by the exit distance, and redacts the
+// coordinates of the gnss data then. The fixes without a position keep the
+// current decision.
+type Redactor struct {
+	lock sync.Mutex
+
+	zones        []*Zone
+	mode         string
+	exitDistance float64
+	fuzzGrid     float64
+	store        Store
+
+	redacting bool
+	zone      *Zone
+	fixes     int
+	exited    bool
+	travelled float64
+	last      *geo.Coordinate
+}
+
+func NewRedactor(zones []*Zone, opts ...Option) (*Redactor, error) {
+	r := &Redactor{
+		zones:        zones,
+		mode:         ModeOmit,
+		exitDistance: 200,
+		fuzzGrid:     1000,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode != ModeOmit && r.mode != ModeFuzz {
+		return nil, fmt.Errorf("unknown privacy mode %q, expecting %q or %q", r.mode, ModeOmit, ModeFuzz)
+	}
+	return r, nil
+}
+
+func (r *Redactor) Mode() string {
+	return r.mode
+}
+
+func (r *Redactor) HandleGnssData(d *neom9n.Data) error {
+	if d.Fix != "2D" && d.Fix != "3D" {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c := geo.NewCoordinate(d.Longitude, d.Latitude)
+	zone := r.zoneOf(c)
+
+	switch {
+	case zone != nil:
+		if !r.redacting {
+			r.redacting = true
+			r.fixes = 0
+			err := r.save(d.SystemTime, zone, ActionStart)
+			if err != nil {
+				return err
+			}
+		}
+		r.zone = zone
+		r.exited = false
+		r.travelled = 0
+	case r.redacting && !r.exited:
+		r.exited = true
+		r.travelled = geo.Distance(r.last, c)
+	case r.redacting:
+		r.travelled += geo.Distance(r.last, c)
+	}
+	r.last = c
+
+	if r.redacting && r.exited && r.travelled >= r.exitDistance {
+		r.redacting = false
+		return r.save(d.SystemTime, r.zone, ActionEnd)
+	}
+	if r.redacting {
+		r.fixes++
+	}
+	return nil
+}
+
+func (r *Redactor) zoneOf(c *geo.Coordinate) *Zone {
+	for _, z := range r.zones {
+		if z.Contains(c) {
+			return z
+		}
+	}
+	return nil
+}
+
+func (r *Redactor) save(t time.Time, zone *Zone, action string) error {
+	if r.store == nil {
+		return nil
+	}
+
+	err := r.store.SaveRedaction(&Redaction{Time: t, ZoneID: zone.ID, Action: action, Mode: r.mode, Fixes: r.fixes})
+	if err != nil {
+		return fmt.Errorf("saving redaction: %w", err)
+	}
+	return nil
+}
+
+// Redacting tells if the data is currently redacted.
+func (r *Redactor) Redacting() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.redacting
+}
+
+// Redact returns a copy of d with its coordinates zeroed, or fuzzed, and its
+// GGA sentence dropped. It is nil when d is nil.
+func (r *Redactor) Redact(d *neom9n.Data) *neom9n.Data {
+	if d == nil {
+		return nil
+	}
+
+	redacted := *d
+	redacted.Latitude, redacted.Longitude = r.RedactCoordinates(d.Latitude, d.Longitude)
+	redacted.Altitude = 0
+	redacted.GGA = ""
+	return &redacted
+}
+
+// RedactFix is the copy of d to store, redacted when d is inside a zone or the
+// data is currently redacted, d itself otherwise. Deciding from d too, the
+// consumers handling the fixes before the redactor don't store the first ones
+// inside a zone. A nil Redactor redacts nothing.
+func (r *Redactor) RedactFix(d *neom9n.Data) *neom9n.Data {
+	if r == nil || d == nil {
+		return d
+	}
+	if r.Redacting() || r.zoneOf(geo.NewCoordinate(d.Longitude, d.Latitude)) != nil {
+		return r.Redact(d)
+	}
+	return d
+}
+
+// RedactCoordinates zeroes, or fuzzes, a latitude and longitude.
+func (r *Redactor) RedactCoordinates(latitude float64, longitude float64) (float64, float64) {
+	if r.mode != ModeFuzz {
+		return 0, 0
+	}
+
+	latitudeStep := geo.RadiansToDegrees(r.fuzzGrid / geo.EarthRadius)
+	latitude = (math.Floor(latitude/latitudeStep) + 0.5) * latitudeStep
+
+	longitudeStep := latitudeStep / math.Max(math.Cos(geo.DegreesToRadians(latitude)), 0.01)
+	longitude = (math.Floor(longitude/longitudeStep) + 0.5) * longitudeStep
+	return latitude, longitude
+}
@@ -0,0 +1,214 @@
+package privacy
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	redactions []*Redaction
+}
+
+func (s *memoryStore) SaveRedaction(r *Redaction) error {
+	s.redactions = append(s.redactions, r)
+	return nil
+}
+
+func TestLoadZones(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "zones.geojson")
+	content := `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "id": "home",
+      "properties": {"radius": 300},
+      "geometry": {"type": "Point", "coordinates": [-73.44, 45.575]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"id": 2},
+      "geometry": {"type": "Polygon", "coordinates": [[[-73.40, 45.50], [-73.39, 45.50], [-73.39, 45.51], [-73.40, 45.51], [-73.40, 45.50]]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {},
+      "geometry": {"type": "LineString", "coordinates": [[-73.4, 45.5], [-73.3, 45.5]]}
+    }
+  ]
+}`
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	zones, err := LoadZones(filePath)
+	require.NoError(t, err)
+	require.Len(t, zones, 2)
+
+	require.Equal(t, "home", zones[0].ID)
+	require.Equal(t, 300.0, zones[0].Radius)
+	require.True(t, zones[0].Contains(geo.NewCoordinate(-73.438, 45.575)))
+	require.False(t, zones[0].Contains(geo.NewCoordinate(-73.436, 45.575)))
+
+	require.Equal(t, "2", zones[1].ID)
+	require.True(t, zones[1].Contains(geo.NewCoordinate(-73.395, 45.505)))
+	require.False(t, zones[1].Contains(geo.NewCoordinate(-73.385, 45.505)))
+}
+
+func TestLoadZones_PointWithoutRadius(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "zones.geojson")
+	content := `{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [-73.44, 45.575]}}]}`
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	_, err := LoadZones(filePath)
+	require.Error(t, err)
+}
+
+func TestRedactor(t *testing.T) {
+	home := &Zone{ID: "home", Center: geo.NewCoordinate(-73.44, 45.575), Radius: 300}
+	arriving := time.Date(2023, 9, 6, 18, 20, 0, 0, time.UTC)
+	signalLost := arriving.Add(10 * time.Second)
+	signalBack := arriving.Add(11 * time.Second)
+
+	tests := []struct {
+		name               string
+		fixes              []*neom9n.Data
+		expectedRedacting  []bool
+		expectedRedactions []string
+		expectedFixes      []int
+	}{
+		{
+			name: "enter and leave by the exit distance",
+			fixes: []*neom9n.Data{
+				{SystemTime: arriving, Fix: "3D", Latitude: 45.575, Longitude: -73.445},
+				{SystemTime: arriving.Add(1 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.44},
+				{SystemTime: arriving.Add(2 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.438},
+				{SystemTime: arriving.Add(3 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.436},
+				{SystemTime: arriving.Add(4 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.434},
+			},
+			expectedRedacting:  []bool{false, true, true, true, false},
+			expectedRedactions: []string{"home start", "home end"},
+			expectedFixes:      []int{0, 3},
+		},
+		{
+			name: "no fix keeps redacting",
+			fixes: []*neom9n.Data{
+				{SystemTime: arriving, Fix: "3D", Latitude: 45.575, Longitude: -73.44},
+				{SystemTime: signalLost, Fix: "none"},
+				{SystemTime: signalBack, Fix: "3D", Latitude: 45.575, Longitude: -73.438},
+			},
+			expectedRedacting:  []bool{true, true, true},
+			expectedRedactions: []string{"home start"},
+			expectedFixes:      []int{0},
+		},
+		{
+			name: "back inside before the exit distance",
+			fixes: []*neom9n.Data{
+				{SystemTime: arriving, Fix: "3D", Latitude: 45.575, Longitude: -73.44},
+				{SystemTime: arriving.Add(1 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.438},
+				{SystemTime: arriving.Add(2 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.436},
+				{SystemTime: arriving.Add(3 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.438},
+				{SystemTime: arriving.Add(4 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.436},
+			},
+			expectedRedacting:  []bool{true, true, true, true, true},
+			expectedRedactions: []string{"home start"},
+			expectedFixes:      []int{0},
+		},
+		{
+			name: "never inside",
+			fixes: []*neom9n.Data{
+				{SystemTime: arriving, Fix: "3D", Latitude: 45.575, Longitude: -73.45},
+				{SystemTime: arriving.Add(1 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.448},
+			},
+			expectedRedacting: []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{}
+			r, err := NewRedactor([]*Zone{home}, WithStore(store))
+			require.NoError(t, err)
+
+			var redacting []bool
+			for _, d := range tt.fixes {
+				require.NoError(t, r.HandleGnssData(d))
+				redacting = append(redacting, r.Redacting())
+			}
+			require.Equal(t, tt.expectedRedacting, redacting)
+
+			var redactions []string
+			var fixes []int
+			for _, redaction := range store.redactions {
+				require.Equal(t, ModeOmit, redaction.Mode)
+				redactions = append(redactions, redaction.ZoneID+" "+redaction.Action)
+				fixes = append(fixes, redaction.Fixes)
+			}
+			require.Equal(t, tt.expectedRedactions, redactions)
+			require.Equal(t, tt.expectedFixes, fixes)
+		})
+	}
+}
+
+func TestRedactor_UnknownMode(t *testing.T) {
+	_, err := NewRedactor(nil, WithMode("blur"))
+	require.Error(t, err)
+}
+
+func TestRedactor_Redact(t *testing.T) {
+	omit, err := NewRedactor(nil)
+	require.NoError(t, err)
+
+	d := &neom9n.Data{
+		SystemTime: time.Date(2023, 9, 6, 18, 25, 0, 0, time.UTC),
+		Fix:        "3D",
+		Latitude:   45.575,
+		Longitude:  -73.44,
+		Altitude:   30,
+		GGA:        "$GNGGA,182500.00,4534.50000,N,07326.40000,W,1,12,0.8,30.0,M,-32.0,M,,*4F",
+	}
+	redacted := omit.Redact(d)
+	require.Equal(t, 0.0, redacted.Latitude)
+	require.Equal(t, 0.0, redacted.Longitude)
+	require.Equal(t, 0.0, redacted.Altitude)
+	require.Empty(t, redacted.GGA)
+	require.Equal(t, d.SystemTime, redacted.SystemTime)
+	require.Equal(t, -73.44, d.Longitude, "the original data is left untouched")
+	require.Nil(t, omit.Redact(nil))
+
+	fuzz, err := NewRedactor(nil, WithMode(ModeFuzz), WithFuzzGrid(1000))
+	require.NoError(t, err)
+
+	// two fixes in the same grid cell
+	first := fuzz.Redact(&neom9n.Data{Fix: "3D", Latitude: 45.575, Longitude: -73.4401, GGA: d.GGA})
+	second := fuzz.Redact(&neom9n.Data{Fix: "3D", Latitude: 45.575, Longitude: -73.4402, GGA: d.GGA})
+	require.Equal(t, first.Latitude, second.Latitude)
+	require.Equal(t, first.Longitude, second.Longitude)
+	require.Less(t, geo.Distance(geo.NewCoordinate(-73.4401, 45.575), geo.NewCoordinate(first.Longitude, first.Latitude)), 1000.0)
+	require.Empty(t, first.GGA)
+}
+
+func TestRedactor_RedactFix(t *testing.T) {
+	home := &Zone{ID: "home", Center: geo.NewCoordinate(-73.44, 45.575), Radius: 300}
+	r, err := NewRedactor([]*Zone{home})
+	require.NoError(t, err)
+
+	atHome := &neom9n.Data{Fix: "3D", Latitude: 45.575, Longitude: -73.44}
+	leaving := &neom9n.Data{Fix: "3D", Latitude: 45.575, Longitude: -73.435}
+	faraway := &neom9n.Data{Fix: "3D", Latitude: 45.575, Longitude: -73.40}
+
+	// decided from the fix itself, before the redactor handles it
+	require.Equal(t, 0.0, r.RedactFix(atHome).Latitude)
+	require.Same(t, faraway, r.RedactFix(faraway))
+
+	// then from the state, the exit distance not being travelled yet
+	require.NoError(t, r.HandleGnssData(atHome))
+	require.Equal(t, 0.0, r.RedactFix(leaving).Latitude)
+
+	var none *Redactor
+	require.Same(t, faraway, none.RedactFix(faraway))
+}
@@ -0,0 +1,57 @@
+package privacy
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS privacy_redactions (
+		id INTEGER NOT NULL PRIMARY KEY,
+		time TIMESTAMP NOT NULL,
+		zone_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		mode TEXT NOT NULL,
+		fixes INTEGER NOT NULL
+	);
+	create index if not exists privacy_redactions_time_idx on privacy_redactions(time);
+`
+
+const insertQuery string = `
+	INSERT INTO privacy_redactions VALUES(NULL,?,?,?,?,?);
+`
+
+const purgeQuery string = `
+	DELETE FROM privacy_redactions WHERE time < ?;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+func PurgeQuery() string {
+	return purgeQuery
+}
+
+type SqlStore struct {
+	sqlite *logger.Sqlite
+}
+
+func NewSqlStore(sqlite *logger.Sqlite) *SqlStore {
+	return &SqlStore{sqlite: sqlite}
+}
+
+func (s *SqlStore) SaveRedaction(r *Redaction) error {
+	err := s.sqlite.Exec(insertQuery,
+		r.Time.Format("2006-01-02 15:04:05.99999"),
+		r.ZoneID,
+		r.Action,
+		r.Mode,
+		r.Fixes,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting redaction: %w", err)
+	}
+	return nil
+}
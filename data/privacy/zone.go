@@ -0,0 +1,83 @@
+package privacy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+// Zone is a private area, a circle of Radius meters around Center or a
+// polygon.
+type Zone struct {
+	ID      string
+	Center  *geo.Coordinate
+	Radius  float64
+	Polygon *geo.Polygon
+}
+
+func (z *Zone) Contains(c *geo.Coordinate) bool {
+	if z.Polygon != nil {
+		return z.Polygon.Contains(c)
+	}
+	return geo.Distance(z.Center, c) <= z.Radius
+}
+
+// LoadZones reads the zones of a GeoJSON FeatureCollection: a Point feature
+// with a "radius" property, in meters, is a circle, a Polygon feature a
+// polygon. The zone id is the feature id or its "id" property, defaulting to
+// the feature index.
+func LoadZones(filePath string) ([]*Zone, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", filePath, err)
+	}
+
+	collection, err := geojson.UnmarshalFeatureCollection(content)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling feature collection: %w", err)
+	}
+
+	var zones []*Zone
+	for i, feature := range collection.Features {
+		if feature.Geometry == nil {
+			continue
+		}
+
+		zone := &Zone{ID: featureID(feature, i)}
+		switch {
+		case feature.Geometry.IsPoint():
+			radius, err := feature.PropertyFloat64("radius")
+			if err != nil || radius <= 0 {
+				return nil, fmt.Errorf("zone %s: point without a radius property", zone.ID)
+			}
+			zone.Center = geo.NewCoordinate(feature.Geometry.Point[0], feature.Geometry.Point[1])
+			zone.Radius = radius
+		case feature.Geometry.IsPolygon():
+			zone.Polygon = geo.NewPolygonFromGeoJson(feature.Geometry.Polygon)
+		default:
+			continue
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+func featureID(feature *geojson.Feature, index int) string {
+	id := feature.ID
+	if id == nil {
+		id = feature.Properties["id"]
+	}
+
+	switch v := id.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return strconv.Itoa(index)
+	}
+}
@@ -0,0 +1,167 @@
+package replay
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Status struct {
+	Paused      bool
+	Speed       float64
+	CurrentTime time.Time
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// Controller paces a replay on the recorded time of the data. It is shared
+// between the importer feed, which calls Wait before handling each record,
+// and whoever drives the replay (ex: the connect ReplayServer).
+type Controller struct {
+	lock    sync.Mutex
+	changed chan struct{}
+
+	speed     float64
+	paused    bool
+	seekTo    *time.Time
+	current   time.Time
+	startTime time.Time
+	endTime   time.Time
+
+	anchorWallTime time.Time
+	anchorDataTime time.Time
+}
+
+// NewController creates a controller replaying at speed times the recorded
+// pace, 0 meaning as fast as possible. startTime and endTime are the replayed
+// window, zero when unbounded.
+func NewController(startTime time.Time, endTime time.Time, speed float64, paused bool) *Controller {
+	return &Controller{
+		changed:   make(chan struct{}),
+		speed:     speed,
+		paused:    paused,
+		startTime: startTime,
+		endTime:   endTime,
+	}
+}
+
+func (c *Controller) Pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.paused = true
+	c.notify()
+}
+
+func (c *Controller) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.paused = false
+	c.notify()
+}
+
+func (c *Controller) Seek(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.startTime.IsZero() && t.Before(c.startTime) {
+		return fmt.Errorf("seek time %s is before replay start time %s", t, c.startTime)
+	}
+	if !c.endTime.IsZero() && t.After(c.endTime) {
+		return fmt.Errorf("seek time %s is after replay end time %s", t, c.endTime)
+	}
+
+	c.seekTo = &t
+	c.notify()
+	return nil
+}
+
+func (c *Controller) SetSpeed(speed float64) error {
+	if speed < 0 {
+		return fmt.Errorf("invalid speed %f, must be positive or 0 for as fast as possible", speed)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.speed = speed
+	c.notify()
+	return nil
+}
+
+func (c *Controller) Status() *Status {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return &Status{
+		Paused:      c.paused,
+		Speed:       c.speed,
+		CurrentTime: c.current,
+		StartTime:   c.startTime,
+		EndTime:     c.endTime,
+	}
+}
+
+// Wait blocks until the record recorded at t is due, honoring pause and speed.
+// When a seek was requested, it returns immediately with the seek time and
+// seeking set to true: the caller must drop t and restart reading from seekTo.
+func (c *Controller) Wait(t time.Time) (seekTo time.Time, seeking bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for {
+		if c.seekTo != nil {
+			seekTo = *c.seekTo
+			c.seekTo = nil
+			c.current = seekTo
+			c.anchorWallTime = time.Time{}
+			return seekTo, true
+		}
+
+		changed := c.changed
+		if c.paused {
+			c.anchorWallTime = time.Time{}
+			c.lock.Unlock()
+			<-changed
+			c.lock.Lock()
+			continue
+		}
+
+		if c.speed == 0 {
+			break
+		}
+
+		if c.anchorWallTime.IsZero() {
+			c.anchorWallTime = time.Now()
+			c.anchorDataTime = t
+			break
+		}
+
+		due := c.anchorWallTime.Add(time.Duration(float64(t.Sub(c.anchorDataTime)) / c.speed))
+		wait := time.Until(due)
+		if wait <= 0 {
+			break
+		}
+
+		c.lock.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		}
+		c.lock.Lock()
+	}
+
+	c.current = t
+	return time.Time{}, false
+}
+
+// notify wakes up a waiting Wait call, the lock must be held. The pace is
+// re-anchored since the speed or the position might have changed.
+func (c *Controller) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.anchorWallTime = time.Time{}
+}
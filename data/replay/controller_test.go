@@ -0,0 +1,55 @@
+package replay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_Pacing(t *testing.T) {
+	t0 := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	c := NewController(time.Time{}, time.Time{}, 10, false)
+
+	start := time.Now()
+	_, seeking := c.Wait(t0)
+	require.False(t, seeking)
+	_, seeking = c.Wait(t0.Add(500 * time.Millisecond))
+	require.False(t, seeking)
+
+	// 500ms of recorded time at 10x takes 50ms
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Equal(t, t0.Add(500*time.Millisecond), c.Status().CurrentTime)
+}
+
+func TestController_PauseAndSeek(t *testing.T) {
+	t0 := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	c := NewController(t0, t0.Add(time.Hour), 0, true)
+
+	type waited struct {
+		seekTo  time.Time
+		seeking bool
+	}
+	done := make(chan waited)
+	go func() {
+		seekTo, seeking := c.Wait(t0)
+		done <- waited{seekTo: seekTo, seeking: seeking}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	require.Error(t, c.Seek(t0.Add(2*time.Hour)))
+	require.NoError(t, c.Seek(t0.Add(10*time.Minute)))
+	w := <-done
+	require.True(t, w.seeking)
+	require.Equal(t, t0.Add(10*time.Minute), w.seekTo)
+
+	c.Resume()
+	_, seeking := c.Wait(t0.Add(10 * time.Minute))
+	require.False(t, seeking)
+	require.False(t, c.Status().Paused)
+}
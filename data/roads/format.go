@@ -0,0 +1,227 @@
+package roads
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// The road network file is a compact binary encoding of the ways:
+//
+//	magic "HMRD", version byte
+//	uvarint class count, then each class as uvarint length + bytes
+//	uvarint way count, then each way:
+//	  varint way id, uvarint class index, flags byte (bit 0: one way)
+//	  uvarint speed limit in 0.1 km/h, 0 when unknown (since version 2)
+//	  uvarint point count, then each point as varint deltas from the
+//	  previous point of the way: node id, lon and lat in 1e-7 degrees
+//
+// Coordinates at 1e-7 degrees are the OSM precision (~1cm).
+
+const formatMagic = "HMRD"
+const formatVersion = 2
+const coordinatePrecision = 1e7
+const maxSpeedPrecision = 10
+
+const flagOneway = 1 << 0
+
+// Load reads a road network file written by WriteFile, or a GeoJSON file of
+// ways.
+func Load(filePath string) ([]*Way, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(len(formatMagic))
+	if err != nil || string(magic) != formatMagic {
+		return LoadGeoJson(filePath)
+	}
+
+	ways, err := ReadWays(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", filePath, err)
+	}
+	return ways, nil
+}
+
+func WriteFile(filePath string, ways []*Way) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if err := WriteWays(writer, ways); err != nil {
+		return fmt.Errorf("writing %q: %w", filePath, err)
+	}
+
+	return writer.Flush()
+}
+
+func WriteWays(w io.Writer, ways []*Way) error {
+	var b []byte
+	b = append(b, formatMagic...)
+	b = append(b, formatVersion)
+
+	classIndexes := map[string]uint64{}
+	var classes []string
+	for _, way := range ways {
+		if _, found := classIndexes[way.Class]; !found {
+			classIndexes[way.Class] = uint64(len(classes))
+			classes = append(classes, way.Class)
+		}
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(classes)))
+	for _, class := range classes {
+		b = binary.AppendUvarint(b, uint64(len(class)))
+		b = append(b, class...)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(ways)))
+	for _, way := range ways {
+		b = binary.AppendVarint(b, way.ID)
+		b = binary.AppendUvarint(b, classIndexes[way.Class])
+		var flags byte
+		if way.Oneway {
+			flags |= flagOneway
+		}
+		b = append(b, flags)
+		b = binary.AppendUvarint(b, uint64(math.Round(way.MaxSpeed*maxSpeedPrecision)))
+
+		b = binary.AppendUvarint(b, uint64(len(way.Points)))
+		var lastNodeID, lastLon, lastLat int64
+		for _, p := range way.Points {
+			lon := int64(math.Round(p.Lon * coordinatePrecision))
+			lat := int64(math.Round(p.Lat * coordinatePrecision))
+			b = binary.AppendVarint(b, p.NodeID-lastNodeID)
+			b = binary.AppendVarint(b, lon-lastLon)
+			b = binary.AppendVarint(b, lat-lastLat)
+			lastNodeID, lastLon, lastLat = p.NodeID, lon, lat
+		}
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+func ReadWays(r io.Reader) ([]*Way, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	if !bytes.HasPrefix(content, []byte(formatMagic)) {
+		return nil, fmt.Errorf("not a road network file")
+	}
+	d := &decoder{b: content[len(formatMagic):]}
+
+	version := d.byte()
+	if d.err == nil && (version < 1 || version > formatVersion) {
+		return nil, fmt.Errorf("unsupported road network file version %d", version)
+	}
+
+	classCount := d.uvarint()
+	var classes []string
+	for i := uint64(0); i < classCount && d.err == nil; i++ {
+		classes = append(classes, string(d.bytes(d.uvarint())))
+	}
+
+	wayCount := d.uvarint()
+	var ways []*Way
+	for i := uint64(0); i < wayCount && d.err == nil; i++ {
+		way := &Way{ID: d.varint()}
+		classIndex := d.uvarint()
+		if d.err == nil && classIndex >= uint64(len(classes)) {
+			return nil, fmt.Errorf("way %d class index %d out of range", way.ID, classIndex)
+		}
+		if d.err == nil {
+			way.Class = classes[classIndex]
+		}
+		way.Oneway = d.byte()&flagOneway != 0
+		if version >= 2 {
+			way.MaxSpeed = float64(d.uvarint()) / maxSpeedPrecision
+		}
+
+		pointCount := d.uvarint()
+		var nodeID, lon, lat int64
+		for j := uint64(0); j < pointCount && d.err == nil; j++ {
+			nodeID += d.varint()
+			lon += d.varint()
+			lat += d.varint()
+			way.Points = append(way.Points, &Point{
+				Lon:    float64(lon) / coordinatePrecision,
+				Lat:    float64(lat) / coordinatePrecision,
+				WayID:  way.ID,
+				NodeID: nodeID,
+			})
+		}
+		ways = append(ways, way)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return ways, nil
+}
+
+// decoder keeps the first error, later reads returning zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("truncated road network file")
+	}
+	d.b = nil
+}
+
+func (d *decoder) byte() byte {
+	if len(d.b) < 1 {
+		d.fail()
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) bytes(n uint64) []byte {
+	if uint64(len(d.b)) < n {
+		d.fail()
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
@@ -0,0 +1,94 @@
+package roads
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// LoadGeoJson reads the ways of a GeoJSON FeatureCollection of LineString
+// features, as exported from OSM (ex: osmtogeojson or overpass turbo). The
+// way id is the feature id ("way/123" or 123) or its "id" property, the class
+// its "highway" property, the one way flag its "oneway" property and the speed
+// limit its "maxspeed" property.
+func LoadGeoJson(filePath string) ([]*Way, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", filePath, err)
+	}
+
+	collection, err := geojson.UnmarshalFeatureCollection(content)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling feature collection: %w", err)
+	}
+
+	var ways []*Way
+	for i, feature := range collection.Features {
+		if feature.Geometry == nil || !feature.Geometry.IsLineString() {
+			continue
+		}
+
+		id, err := featureWayID(feature)
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+
+		way := &Way{
+			ID:       id,
+			Class:    feature.PropertyMustString("highway", ""),
+			Oneway:   isOneway(feature.Properties["oneway"]),
+			MaxSpeed: maxSpeed(feature.Properties["maxspeed"]),
+		}
+		for _, coordinates := range feature.Geometry.LineString {
+			way.Points = append(way.Points, &Point{Lon: coordinates[0], Lat: coordinates[1], WayID: id})
+		}
+		ways = append(ways, way)
+	}
+
+	return ways, nil
+}
+
+func featureWayID(feature *geojson.Feature) (int64, error) {
+	id := feature.ID
+	if id == nil {
+		id = feature.Properties["id"]
+	}
+
+	switch v := id.(type) {
+	case float64:
+		return int64(v), nil
+	case string:
+		parsed, err := strconv.ParseInt(strings.TrimPrefix(v, "way/"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid way id %q: %w", v, err)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("missing way id")
+	}
+}
+
+func isOneway(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "yes" || v == "true" || v == "1"
+	default:
+		return false
+	}
+}
+
+func maxSpeed(value any) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		return ParseMaxSpeed(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,92 @@
+package roads
+
+import (
+	"math"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+// DefaultCellSize is the grid cell size in meters, about the usual map
+// matching search radius so a query only visits a handful of cells.
+const DefaultCellSize = 250.0
+
+type cell struct {
+	x int64
+	y int64
+}
+
+// Index is an in-memory Store indexing the way points on a regular lon/lat
+// grid.
+type Index struct {
+	ways     map[int64]*Way
+	cells    map[cell][]*Point
+	cellSize float64 // degrees of latitude
+}
+
+func NewIndex(ways []*Way) *Index {
+	idx := &Index{
+		ways:     map[int64]*Way{},
+		cells:    map[cell][]*Point{},
+		cellSize: DefaultCellSize / geo.EarthRadius * 180 / math.Pi,
+	}
+
+	for _, way := range ways {
+		idx.ways[way.ID] = way
+		for _, p := range way.Points {
+			c := idx.cellOf(p.Lon, p.Lat)
+			idx.cells[c] = append(idx.cells[c], p)
+		}
+	}
+
+	return idx
+}
+
+func (i *Index) Way(id int64) *Way {
+	return i.ways[id]
+}
+
+func (i *Index) Ways() map[int64]*Way {
+	return i.ways
+}
+
+// cellOf keeps cells square on the ground by scaling the longitude with the
+// latitude of the center of the cell row. Scaling with the latitude of each
+// point would shear the grid, the nearby points of the next rows landing in
+// far apart columns at large longitudes.
+func (i *Index) cellOf(lon, lat float64) cell {
+	y := int64(math.Floor(lat / i.cellSize))
+	return cell{
+		x: i.columnOf(lon, y),
+		y: y,
+	}
+}
+
+func (i *Index) columnOf(lon float64, y int64) int64 {
+	rowLat := (float64(y) + 0.5) * i.cellSize
+	return int64(math.Floor(lon * lonScale(rowLat) / i.cellSize))
+}
+
+func lonScale(lat float64) float64 {
+	return math.Cos(lat * math.Pi / 180)
+}
+
+func (i *Index) Near(lon float64, lat float64, maxDistance float64) ([]*Point, error) {
+	reach := int64(math.Ceil(maxDistance/DefaultCellSize)) + 1
+	center := i.cellOf(lon, lat)
+
+	var points []*Point
+	for y := center.y - reach; y <= center.y+reach; y++ {
+		// the columns of each row are scaled with its own latitude
+		column := i.columnOf(lon, y)
+		for x := column - reach; x <= column+reach; x++ {
+			for _, p := range i.cells[cell{x: x, y: y}] {
+				if distance(lon, lat, p.Lon, p.Lat) <= maxDistance {
+					points = append(points, p)
+				}
+			}
+		}
+	}
+
+	sortByDistance(lon, lat, points)
+	return points, nil
+}
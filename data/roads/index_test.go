@@ -0,0 +1,120 @@
+package roads
+
+import (
+	"math"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/stretchr/testify/require"
+)
+
+const waysGeoJson = `{
+  "type": "FeatureCollection",
+  "features": [
+    {"type": "Feature", "id": "way/1", "properties": {"highway": "residential"}, "geometry": {"type": "LineString", "coordinates": [[-73.4400, 45.5750], [-73.4390, 45.5750], [-73.4380, 45.5750]]}},
+    {"type": "Feature", "id": 2, "properties": {"highway": "primary", "oneway": "yes"}, "geometry": {"type": "LineString", "coordinates": [[-73.4390, 45.5760], [-73.4390, 45.5800]]}},
+    {"type": "Feature", "id": "node/3", "properties": {}, "geometry": {"type": "Point", "coordinates": [-73.4390, 45.5750]}}
+  ]
+}`
+
+func TestIndex_Near(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "ways.geojson")
+	require.NoError(t, os.WriteFile(filePath, []byte(waysGeoJson), 0644))
+
+	ways, err := LoadGeoJson(filePath)
+	require.NoError(t, err)
+	require.Len(t, ways, 2)
+	require.Equal(t, int64(1), ways[0].ID)
+	require.Equal(t, "residential", ways[0].Class)
+	require.False(t, ways[0].Oneway)
+	require.True(t, ways[1].Oneway)
+
+	idx := NewIndex(ways)
+
+	tests := []struct {
+		name        string
+		maxDistance float64
+		expected    []*Point
+	}{
+		{
+			name:        "closest first",
+			maxDistance: 80,
+			expected: []*Point{
+				{Lon: -73.4390, Lat: 45.5750, WayID: 1},
+				{Lon: -73.4400, Lat: 45.5750, WayID: 1},
+			},
+		},
+		{
+			name:        "farther cells",
+			maxDistance: 600,
+			expected: []*Point{
+				{Lon: -73.4390, Lat: 45.5750, WayID: 1},
+				{Lon: -73.4400, Lat: 45.5750, WayID: 1},
+				{Lon: -73.4380, Lat: 45.5750, WayID: 1},
+				{Lon: -73.4390, Lat: 45.5760, WayID: 2},
+				{Lon: -73.4390, Lat: 45.5800, WayID: 2},
+			},
+		},
+		{
+			name:        "nothing near",
+			maxDistance: 10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := idx.Near(-73.4391, 45.5752, test.maxDistance)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, points)
+		})
+	}
+}
+
+func TestIndex_NearLargeLongitude(t *testing.T) {
+	tests := []struct {
+		name string
+		lon  float64
+		lat  float64
+	}{
+		{name: "san francisco", lon: -122.4194, lat: 37.7749},
+		{name: "sydney", lon: 151.2093, lat: -33.8688},
+		{name: "tokyo", lon: 139.6917, lat: 35.6895},
+		{name: "near the antimeridian", lon: -179.2, lat: 64.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// a way every ~50m of latitude, with a point every ~50m of longitude,
+			// around the query point
+			step := 50.0 / geo.EarthRadius * 180 / math.Pi
+			var ways []*Way
+			var points []*Point
+			for i := -16; i <= 16; i++ {
+				way := &Way{ID: int64(i + 100)}
+				for j := -16; j <= 16; j++ {
+					p := &Point{Lon: test.lon + float64(j)*step/math.Cos(test.lat*math.Pi/180), Lat: test.lat + float64(i)*step, WayID: way.ID}
+					way.Points = append(way.Points, p)
+					points = append(points, p)
+				}
+				ways = append(ways, way)
+			}
+			idx := NewIndex(ways)
+
+			for _, maxDistance := range []float64{100, 270, 500} {
+				var expected []*Point
+				for _, p := range points {
+					if distance(test.lon, test.lat, p.Lon, p.Lat) <= maxDistance {
+						expected = append(expected, p)
+					}
+				}
+				sortByDistance(test.lon, test.lat, expected)
+
+				near, err := idx.Near(test.lon, test.lat, maxDistance)
+				require.NoError(t, err)
+				require.Equal(t, len(expected), len(near), "within %.0fm", maxDistance)
+			}
+		})
+	}
+}
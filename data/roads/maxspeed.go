@@ -0,0 +1,33 @@
+package roads
+
+import (
+	"strconv"
+	"strings"
+)
+
+const kilometersPerMile = 1.609344
+
+// ParseMaxSpeed reads an OSM maxspeed tag value to km/h: "50", "30 mph" or
+// "50;70" (the first is kept). It is 0, unknown, for "none", "walk" and the
+// implicit limits of a zone (ex: "DE:urban"), the road class default limit
+// applying then.
+func ParseMaxSpeed(value string) float64 {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexAny(value, ";|"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	factor := 1.0
+	if strings.HasSuffix(value, "mph") {
+		factor = kilometersPerMile
+		value = strings.TrimSpace(strings.TrimSuffix(value, "mph"))
+	} else {
+		value = strings.TrimSpace(strings.TrimSuffix(value, "km/h"))
+	}
+
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return speed * factor
+}
@@ -0,0 +1,115 @@
+package roads
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore queries the way points of the geo.points collection, a 2dsphere
+// indexed collection of {coordinates: [lon, lat], wayID} documents.
+type MongoStore struct {
+	pointCollection *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, uri string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", uri, err)
+	}
+
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("pinging %s: %w", uri, err)
+	}
+
+	return &MongoStore{
+		pointCollection: client.Database("geo").Collection("points"),
+	}, nil
+}
+
+type mongoPoint struct {
+	Coordinates []float64 `bson:"coordinates"`
+	WayID       int64     `bson:"wayID"`
+}
+
+func (s *MongoStore) Near(lon float64, lat float64, maxDistance float64) ([]*Point, error) {
+	query := bson.M{
+		"coordinates": bson.M{
+			"$near": bson.M{
+				"$geometry": bson.M{
+					"type":        "Point",
+					"coordinates": []float64{lon, lat},
+				},
+				"$minDistance": 0,
+				"$maxDistance": maxDistance,
+			},
+		},
+	}
+
+	ctx := context.Background()
+	cursor, err := s.pointCollection.Find(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("finding points: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var points []*Point
+	for cursor.Next(ctx) {
+		p := &mongoPoint{}
+		err := cursor.Decode(p)
+		if err != nil {
+			return nil, fmt.Errorf("decoding point: %w", err)
+		}
+		if len(p.Coordinates) != 2 {
+			return nil, fmt.Errorf("invalid point coordinates %v", p.Coordinates)
+		}
+		points = append(points, &Point{Lon: p.Coordinates[0], Lat: p.Coordinates[1], WayID: p.WayID})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("iterating points: %w", err)
+	}
+
+	return points, nil
+}
+
+// Ways loads all the ways of the collection, their points being in insertion
+// order.
+func (s *MongoStore) Ways(ctx context.Context) ([]*Way, error) {
+	cursor, err := s.pointCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("finding points: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	ways := map[int64]*Way{}
+	var ordered []*Way
+	for cursor.Next(ctx) {
+		p := &mongoPoint{}
+		err := cursor.Decode(p)
+		if err != nil {
+			return nil, fmt.Errorf("decoding point: %w", err)
+		}
+		if len(p.Coordinates) != 2 {
+			return nil, fmt.Errorf("invalid point coordinates %v", p.Coordinates)
+		}
+
+		way, found := ways[p.WayID]
+		if !found {
+			way = &Way{ID: p.WayID}
+			ways[p.WayID] = way
+			ordered = append(ordered, way)
+		}
+		way.Points = append(way.Points, &Point{Lon: p.Coordinates[0], Lat: p.Coordinates[1], WayID: p.WayID})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("iterating points: %w", err)
+	}
+
+	return ordered, nil
+}
@@ -0,0 +1,144 @@
+package roads
+
+import (
+	"fmt"
+	"strings"
+)
+
+// drivableClasses are the highway tag values of the ways a car can drive on.
+var drivableClasses = map[string]bool{
+	"motorway":       true,
+	"motorway_link":  true,
+	"trunk":          true,
+	"trunk_link":     true,
+	"primary":        true,
+	"primary_link":   true,
+	"secondary":      true,
+	"secondary_link": true,
+	"tertiary":       true,
+	"tertiary_link":  true,
+	"unclassified":   true,
+	"residential":    true,
+	"living_street":  true,
+	"service":        true,
+	"road":           true,
+}
+
+type BoundingBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// ParseBoundingBox parses "minLon,minLat,maxLon,maxLat", an empty value
+// returning a nil box which contains everything.
+func ParseBoundingBox(value string) (*BoundingBox, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var b BoundingBox
+	_, err := fmt.Sscanf(strings.ReplaceAll(value, ",", " "), "%g %g %g %g", &b.MinLon, &b.MinLat, &b.MaxLon, &b.MaxLat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bounding box %q, expecting minLon,minLat,maxLon,maxLat: %w", value, err)
+	}
+	if b.MinLon > b.MaxLon || b.MinLat > b.MaxLat {
+		return nil, fmt.Errorf("invalid bounding box %q, min is greater than max", value)
+	}
+
+	return &b, nil
+}
+
+func (b *BoundingBox) Contains(lon, lat float64) bool {
+	return b == nil || (lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat)
+}
+
+type osmWay struct {
+	id   int64
+	tags map[string]string
+	refs []int64
+}
+
+type osmNodeHandler func(id int64, lon float64, lat float64)
+type osmWayHandler func(way *osmWay)
+
+// osmReader reads the nodes and ways of an OSM file, either handler being nil
+// when not needed.
+type osmReader func(filePath string, onNode osmNodeHandler, onWay osmWayHandler) error
+
+// ImportOsm reads the drivable ways of an OSM XML (.osm) or PBF (.osm.pbf)
+// file having at least a node in bbox. The file is read twice: first the
+// drivable ways, then the coordinates of their nodes, so only the nodes of
+// these ways are kept in memory.
+func ImportOsm(filePath string, bbox *BoundingBox) ([]*Way, error) {
+	read := readOsmXml
+	if strings.HasSuffix(filePath, ".pbf") {
+		read = readOsmPbf
+	}
+
+	var osmWays []*osmWay
+	nodes := map[int64]*Point{}
+	err := read(filePath, nil, func(way *osmWay) {
+		if !drivableClasses[way.tags["highway"]] || way.tags["area"] == "yes" || len(way.refs) < 2 {
+			return
+		}
+		osmWays = append(osmWays, way)
+		for _, ref := range way.refs {
+			nodes[ref] = nil
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading ways: %w", err)
+	}
+
+	err = read(filePath, func(id int64, lon float64, lat float64) {
+		if _, found := nodes[id]; found {
+			nodes[id] = &Point{Lon: lon, Lat: lat, NodeID: id}
+		}
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading nodes: %w", err)
+	}
+
+	var ways []*Way
+	for _, osmWay := range osmWays {
+		way, inBoundingBox := toWay(osmWay, nodes, bbox)
+		if inBoundingBox {
+			ways = append(ways, way)
+		}
+	}
+
+	return ways, nil
+}
+
+func toWay(osmWay *osmWay, nodes map[int64]*Point, bbox *BoundingBox) (*Way, bool) {
+	refs := osmWay.refs
+	oneway := osmWay.tags["oneway"]
+	if oneway == "-1" {
+		refs = make([]int64, len(osmWay.refs))
+		for i, ref := range osmWay.refs {
+			refs[len(refs)-1-i] = ref
+		}
+	}
+
+	way := &Way{
+		ID:       osmWay.id,
+		Class:    osmWay.tags["highway"],
+		Oneway:   isOneway(oneway) || oneway == "-1" || osmWay.tags["junction"] == "roundabout" || (oneway == "" && osmWay.tags["highway"] == "motorway"),
+		MaxSpeed: ParseMaxSpeed(osmWay.tags["maxspeed"]),
+	}
+
+	inBoundingBox := false
+	for _, ref := range refs {
+		node := nodes[ref]
+		if node == nil {
+			// node missing from the extract, the way was cut at its border
+			continue
+		}
+		inBoundingBox = inBoundingBox || bbox.Contains(node.Lon, node.Lat)
+		way.Points = append(way.Points, &Point{Lon: node.Lon, Lat: node.Lat, WayID: way.ID, NodeID: node.NodeID})
+	}
+
+	return way, inBoundingBox && len(way.Points) >= 2
+}
@@ -0,0 +1,226 @@
+package roads
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const osmXml = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6">
+  <node id="1" lat="45.5750" lon="-73.4400"/>
+  <node id="2" lat="45.5750" lon="-73.4390"/>
+  <node id="3" lat="45.5750" lon="-73.4380"/>
+  <node id="4" lat="45.6000" lon="-73.4390"/>
+  <node id="5" lat="46.0000" lon="-73.0000"/>
+  <node id="6" lat="46.0010" lon="-73.0000"/>
+  <way id="10">
+    <nd ref="1"/><nd ref="2"/><nd ref="3"/>
+    <tag k="highway" v="residential"/>
+  </way>
+  <way id="11">
+    <nd ref="2"/><nd ref="4"/>
+    <tag k="highway" v="primary"/>
+    <tag k="oneway" v="-1"/>
+    <tag k="maxspeed" v="50"/>
+  </way>
+  <way id="12">
+    <nd ref="1"/><nd ref="3"/>
+    <tag k="highway" v="footway"/>
+  </way>
+  <way id="13">
+    <nd ref="5"/><nd ref="6"/>
+    <tag k="highway" v="motorway"/>
+  </way>
+</osm>`
+
+var expectedWays = []*Way{
+	{ID: 10, Class: "residential", Points: []*Point{
+		{Lon: -73.4400, Lat: 45.5750, WayID: 10, NodeID: 1},
+		{Lon: -73.4390, Lat: 45.5750, WayID: 10, NodeID: 2},
+		{Lon: -73.4380, Lat: 45.5750, WayID: 10, NodeID: 3},
+	}},
+	{ID: 11, Class: "primary", Oneway: true, MaxSpeed: 50, Points: []*Point{
+		{Lon: -73.4390, Lat: 45.6000, WayID: 11, NodeID: 4},
+		{Lon: -73.4390, Lat: 45.5750, WayID: 11, NodeID: 2},
+	}},
+}
+
+var testBoundingBox = &BoundingBox{MinLon: -73.5, MinLat: 45.5, MaxLon: -73.4, MaxLat: 45.58}
+
+func TestImportOsm_Xml(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "extract.osm")
+	require.NoError(t, os.WriteFile(filePath, []byte(osmXml), 0644))
+
+	ways, err := ImportOsm(filePath, testBoundingBox)
+	require.NoError(t, err)
+	require.Equal(t, expectedWays, roundCoordinates(ways))
+
+	ways, err = ImportOsm(filePath, nil)
+	require.NoError(t, err)
+	require.Len(t, ways, 3)
+	require.True(t, ways[2].Oneway, "motorways are one way by default")
+}
+
+func TestImportOsm_Pbf(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "extract.osm.pbf")
+	require.NoError(t, os.WriteFile(filePath, testPbf(t), 0644))
+
+	ways, err := ImportOsm(filePath, testBoundingBox)
+	require.NoError(t, err)
+	require.Equal(t, expectedWays, roundCoordinates(ways))
+}
+
+func TestWriteWays(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteWays(buffer, expectedWays))
+
+	ways, err := ReadWays(bytes.NewReader(buffer.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, expectedWays, roundCoordinates(ways))
+
+	_, err = ReadWays(bytes.NewReader(buffer.Bytes()[:buffer.Len()-3]))
+	require.Error(t, err)
+}
+
+func TestReadWays_Version1(t *testing.T) {
+	b := append([]byte(formatMagic), 1)
+	b = binary.AppendUvarint(b, 1)
+	b = binary.AppendUvarint(b, uint64(len("primary")))
+	b = append(b, "primary"...)
+	b = binary.AppendUvarint(b, 1)
+	b = binary.AppendVarint(b, 7)
+	b = binary.AppendUvarint(b, 0)
+	b = append(b, flagOneway)
+	b = binary.AppendUvarint(b, 0)
+
+	ways, err := ReadWays(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, []*Way{{ID: 7, Class: "primary", Oneway: true}}, ways)
+}
+
+func TestParseMaxSpeed(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+	}{
+		{value: "50", expected: 50},
+		{value: "50 km/h", expected: 50},
+		{value: "30 mph", expected: 48.28032},
+		{value: "30mph", expected: 48.28032},
+		{value: "50;70", expected: 50},
+		{value: "none", expected: 0},
+		{value: "DE:urban", expected: 0},
+		{value: "", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			require.InDelta(t, tt.expected, ParseMaxSpeed(tt.value), 1e-9)
+		})
+	}
+}
+
+// roundCoordinates drops the float noise of the 1e-7 and 1e-9 fixed point
+// coordinates.
+func roundCoordinates(ways []*Way) []*Way {
+	for _, way := range ways {
+		for _, p := range way.Points {
+			p.Lon = math.Round(p.Lon*1e7) / 1e7
+			p.Lat = math.Round(p.Lat*1e7) / 1e7
+		}
+	}
+	return ways
+}
+
+// testPbf encodes the osmXml extract as PBF: the nodes as DenseNodes and the
+// ways in a second zlib compressed block.
+func testPbf(t *testing.T) []byte {
+	t.Helper()
+
+	stringValues := []string{"", "highway", "residential", "primary", "oneway", "-1", "footway", "motorway", "maxspeed", "50"}
+	stringTable := []byte{}
+	for _, s := range stringValues {
+		stringTable = protowire.AppendTag(stringTable, 1, protowire.BytesType)
+		stringTable = protowire.AppendString(stringTable, s)
+	}
+
+	packedDeltas := func(values []int64) []byte {
+		var b []byte
+		var last int64
+		for _, v := range values {
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(v-last))
+			last = v
+		}
+		return b
+	}
+	packed := func(values ...uint64) []byte {
+		var b []byte
+		for _, v := range values {
+			b = protowire.AppendVarint(b, v)
+		}
+		return b
+	}
+	appendBytes := func(b []byte, num protowire.Number, v []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v)
+	}
+
+	// granularity 100 nano degrees: 1e7 units per degree
+	var dense []byte
+	dense = appendBytes(dense, 1, packedDeltas([]int64{1, 2, 3, 4, 5, 6}))
+	dense = appendBytes(dense, 8, packedDeltas([]int64{455750000, 455750000, 455750000, 456000000, 460000000, 460010000}))
+	dense = appendBytes(dense, 9, packedDeltas([]int64{-734400000, -734390000, -734380000, -734390000, -730000000, -730000000}))
+	nodesBlock := appendBytes(appendBytes(nil, 1, stringTable), 2, appendBytes(nil, 2, dense))
+
+	way := func(id uint64, refs []int64, keysValues ...uint64) []byte {
+		var keys, values []uint64
+		for i := 0; i < len(keysValues); i += 2 {
+			keys = append(keys, keysValues[i])
+			values = append(values, keysValues[i+1])
+		}
+		b := protowire.AppendTag(nil, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, id)
+		b = appendBytes(b, 2, packed(keys...))
+		b = appendBytes(b, 3, packed(values...))
+		return appendBytes(b, 8, packedDeltas(refs))
+	}
+	var group []byte
+	group = appendBytes(group, 3, way(10, []int64{1, 2, 3}, 1, 2))
+	group = appendBytes(group, 3, way(11, []int64{2, 4}, 1, 3, 4, 5, 8, 9))
+	group = appendBytes(group, 3, way(12, []int64{1, 3}, 1, 6))
+	group = appendBytes(group, 3, way(13, []int64{5, 6}, 1, 7))
+	waysBlock := appendBytes(appendBytes(nil, 1, stringTable), 2, group)
+
+	var file []byte
+	appendBlob := func(blobType string, blob []byte) {
+		header := protowire.AppendTag(nil, 1, protowire.BytesType)
+		header = protowire.AppendString(header, blobType)
+		header = protowire.AppendTag(header, 3, protowire.VarintType)
+		header = protowire.AppendVarint(header, uint64(len(blob)))
+		file = binary.BigEndian.AppendUint32(file, uint32(len(header)))
+		file = append(file, header...)
+		file = append(file, blob...)
+	}
+
+	appendBlob("OSMHeader", appendBytes(nil, 1, nil))
+	appendBlob("OSMData", appendBytes(nil, 1, nodesBlock))
+
+	compressed := &bytes.Buffer{}
+	w := zlib.NewWriter(compressed)
+	_, err := w.Write(waysBlock)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	blob := protowire.AppendTag(nil, 2, protowire.VarintType)
+	blob = protowire.AppendVarint(blob, uint64(len(waysBlock)))
+	appendBlob("OSMData", appendBytes(blob, 3, compressed.Bytes()))
+
+	return file
+}
@@ -0,0 +1,339 @@
+package roads
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The OSM PBF format (https://wiki.openstreetmap.org/wiki/PBF_Format) is a
+// sequence of length prefixed BlobHeader/Blob pairs, each OSMData blob holding
+// a zlib compressed PrimitiveBlock. Only the fields needed for the road
+// network are decoded, straight from the wire format.
+
+const maxBlobHeaderSize = 64 * 1024
+const maxBlobSize = 32 * 1024 * 1024
+
+type pbfField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+// varints returns the values of a repeated varint field, packed or not.
+func (f *pbfField) varints() ([]uint64, error) {
+	if f.typ == protowire.VarintType {
+		return []uint64{f.varint}, nil
+	}
+
+	var values []uint64
+	b := f.bytes
+	for len(b) > 0 {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+// deltas decodes a packed delta coded sint64 field.
+func (f *pbfField) deltas() ([]int64, error) {
+	values, err := f.varints()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := make([]int64, len(values))
+	var last int64
+	for i, v := range values {
+		last += protowire.DecodeZigZag(v)
+		decoded[i] = last
+	}
+	return decoded, nil
+}
+
+func decodeFields(b []byte, handle func(f *pbfField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := &pbfField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := handle(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readOsmPbf(filePath string, onNode osmNodeHandler, onWay osmWayHandler) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		var headerSize uint32
+		err := binary.Read(reader, binary.BigEndian, &headerSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading blob header size: %w", err)
+		}
+		if headerSize > maxBlobHeaderSize {
+			return fmt.Errorf("blob header size %d exceeds %d", headerSize, maxBlobHeaderSize)
+		}
+
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return fmt.Errorf("reading blob header: %w", err)
+		}
+
+		var blobType string
+		var blobSize uint64
+		err = decodeFields(header, func(f *pbfField) error {
+			switch f.num {
+			case 1:
+				blobType = string(f.bytes)
+			case 3:
+				blobSize = f.varint
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("decoding blob header: %w", err)
+		}
+		if blobSize > maxBlobSize {
+			return fmt.Errorf("blob size %d exceeds %d", blobSize, maxBlobSize)
+		}
+
+		blob := make([]byte, blobSize)
+		if _, err := io.ReadFull(reader, blob); err != nil {
+			return fmt.Errorf("reading blob: %w", err)
+		}
+
+		if blobType != "OSMData" {
+			continue
+		}
+
+		block, err := decodeBlob(blob)
+		if err != nil {
+			return fmt.Errorf("decoding blob: %w", err)
+		}
+
+		err = decodePrimitiveBlock(block, onNode, onWay)
+		if err != nil {
+			return fmt.Errorf("decoding primitive block: %w", err)
+		}
+	}
+}
+
+func decodeBlob(blob []byte) ([]byte, error) {
+	var raw, zlibData []byte
+	var rawSize uint64
+	err := decodeFields(blob, func(f *pbfField) error {
+		switch f.num {
+		case 1:
+			raw = f.bytes
+		case 2:
+			rawSize = f.varint
+		case 3:
+			zlibData = f.bytes
+		case 4, 5, 6, 7:
+			return fmt.Errorf("unsupported blob compression (field %d), only zlib is supported", f.num)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if raw != nil {
+		return raw, nil
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(zlibData))
+	if err != nil {
+		return nil, fmt.Errorf("opening zlib data: %w", err)
+	}
+	defer r.Close()
+
+	data := make([]byte, 0, rawSize)
+	buffer := bytes.NewBuffer(data)
+	if _, err := io.Copy(buffer, r); err != nil {
+		return nil, fmt.Errorf("inflating zlib data: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+type primitiveBlock struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+func (b *primitiveBlock) coordinates(lon, lat int64) (float64, float64) {
+	return 1e-9 * float64(b.lonOffset+b.granularity*lon), 1e-9 * float64(b.latOffset+b.granularity*lat)
+}
+
+func decodePrimitiveBlock(data []byte, onNode osmNodeHandler, onWay osmWayHandler) error {
+	block := &primitiveBlock{granularity: 100}
+	var groups [][]byte
+	err := decodeFields(data, func(f *pbfField) error {
+		switch f.num {
+		case 1:
+			return decodeFields(f.bytes, func(s *pbfField) error {
+				if s.num == 1 {
+					block.strings = append(block.strings, string(s.bytes))
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, f.bytes)
+		case 17:
+			block.granularity = int64(f.varint)
+		case 19:
+			block.latOffset = int64(f.varint)
+		case 20:
+			block.lonOffset = int64(f.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// groups are decoded last, the granularity and offsets can follow them
+	for _, group := range groups {
+		err := decodeFields(group, func(f *pbfField) error {
+			switch {
+			case f.num == 1 && onNode != nil:
+				return block.decodeNode(f.bytes, onNode)
+			case f.num == 2 && onNode != nil:
+				return block.decodeDenseNodes(f.bytes, onNode)
+			case f.num == 3 && onWay != nil:
+				return block.decodeWay(f.bytes, onWay)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("decoding primitive group: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *primitiveBlock) decodeNode(data []byte, onNode osmNodeHandler) error {
+	var id, lat, lon int64
+	err := decodeFields(data, func(f *pbfField) error {
+		switch f.num {
+		case 1:
+			id = protowire.DecodeZigZag(f.varint)
+		case 8:
+			lat = protowire.DecodeZigZag(f.varint)
+		case 9:
+			lon = protowire.DecodeZigZag(f.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("decoding node: %w", err)
+	}
+
+	nodeLon, nodeLat := b.coordinates(lon, lat)
+	onNode(id, nodeLon, nodeLat)
+	return nil
+}
+
+func (b *primitiveBlock) decodeDenseNodes(data []byte, onNode osmNodeHandler) error {
+	var ids, lats, lons []int64
+	err := decodeFields(data, func(f *pbfField) error {
+		var err error
+		switch f.num {
+		case 1:
+			ids, err = f.deltas()
+		case 8:
+			lats, err = f.deltas()
+		case 9:
+			lons, err = f.deltas()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("decoding dense nodes: %w", err)
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return fmt.Errorf("dense nodes with %d ids, %d lats and %d lons", len(ids), len(lats), len(lons))
+	}
+
+	for i, id := range ids {
+		lon, lat := b.coordinates(lons[i], lats[i])
+		onNode(id, lon, lat)
+	}
+	return nil
+}
+
+func (b *primitiveBlock) decodeWay(data []byte, onWay osmWayHandler) error {
+	way := &osmWay{tags: map[string]string{}}
+	var keys, values []uint64
+	err := decodeFields(data, func(f *pbfField) error {
+		var err error
+		switch f.num {
+		case 1:
+			way.id = int64(f.varint)
+		case 2:
+			keys, err = f.varints()
+		case 3:
+			values, err = f.varints()
+		case 8:
+			way.refs, err = f.deltas()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("decoding way: %w", err)
+	}
+	if len(keys) != len(values) {
+		return fmt.Errorf("way %d with %d tag keys and %d values", way.id, len(keys), len(values))
+	}
+
+	for i, key := range keys {
+		if key >= uint64(len(b.strings)) || values[i] >= uint64(len(b.strings)) {
+			return fmt.Errorf("way %d tag out of the string table", way.id)
+		}
+		way.tags[b.strings[key]] = b.strings[values[i]]
+	}
+
+	onWay(way)
+	return nil
+}
@@ -0,0 +1,71 @@
+package roads
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+type xmlNode struct {
+	ID  int64   `xml:"id,attr"`
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+type xmlWay struct {
+	ID   int64 `xml:"id,attr"`
+	Refs []struct {
+		Ref int64 `xml:"ref,attr"`
+	} `xml:"nd"`
+	Tags []struct {
+		Key   string `xml:"k,attr"`
+		Value string `xml:"v,attr"`
+	} `xml:"tag"`
+}
+
+func readOsmXml(filePath string, onNode osmNodeHandler, onWay osmWayHandler) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decoding xml: %w", err)
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case element.Name.Local == "node" && onNode != nil:
+			node := &xmlNode{}
+			if err := decoder.DecodeElement(node, &element); err != nil {
+				return fmt.Errorf("decoding node: %w", err)
+			}
+			onNode(node.ID, node.Lon, node.Lat)
+		case element.Name.Local == "way" && onWay != nil:
+			w := &xmlWay{}
+			if err := decoder.DecodeElement(w, &element); err != nil {
+				return fmt.Errorf("decoding way: %w", err)
+			}
+			way := &osmWay{id: w.ID, tags: map[string]string{}}
+			for _, tag := range w.Tags {
+				way.tags[tag.Key] = tag.Value
+			}
+			for _, ref := range w.Refs {
+				way.refs = append(way.refs, ref.Ref)
+			}
+			onWay(way)
+		}
+	}
+}
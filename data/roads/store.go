@@ -0,0 +1,42 @@
+package roads
+
+import (
+	"sort"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+)
+
+// Point is a node of a way. NodeID is the OSM node id, shared by the ways
+// crossing at that node, 0 when unknown.
+type Point struct {
+	Lon    float64
+	Lat    float64
+	WayID  int64
+	NodeID int64
+}
+
+type Way struct {
+	ID     int64
+	Class  string
+	Oneway bool
+	// MaxSpeed is the posted speed limit in km/h, 0 when unknown.
+	MaxSpeed float64
+	Points   []*Point
+}
+
+// Store answers the spatial queries of map matching.
+type Store interface {
+	// Near returns the way points within maxDistance meters of lon/lat,
+	// closest first.
+	Near(lon float64, lat float64, maxDistance float64) ([]*Point, error)
+}
+
+func distance(lon1, lat1, lon2, lat2 float64) float64 {
+	return geo.Distance(&geo.Coordinate{Lon: lon1, Lat: lat1}, &geo.Coordinate{Lon: lon2, Lat: lat2})
+}
+
+func sortByDistance(lon, lat float64, points []*Point) {
+	sort.Slice(points, func(i, j int) bool {
+		return distance(lon, lat, points[i].Lon, points[i].Lat) < distance(lon, lat, points[j].Lon, points[j].Lat)
+	})
+}
@@ -0,0 +1,97 @@
+package speeding
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS speeding_events (
+		id INTEGER NOT NULL PRIMARY KEY,
+		time TIMESTAMP NOT NULL,
+		name TEXT NOT NULL,
+		way_id INTEGER NOT NULL,
+		road_class TEXT NOT NULL,
+		speed_limit REAL NOT NULL,
+		speed REAL NOT NULL,
+		max_overage REAL NOT NULL,
+		duration REAL NOT NULL,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL
+	);
+	create index if not exists speeding_events_time_idx on speeding_events(time);
+`
+
+const insertQuery string = `
+	INSERT INTO speeding_events VALUES(NULL,?,?,?,?,?,?,?,?,?,?);
+`
+
+const purgeQuery string = `
+	DELETE FROM speeding_events WHERE time < ?;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+func PurgeQuery() string {
+	return purgeQuery
+}
+
+// SqlStore writes the speeding events as they happen, them being rare.
+type SqlStore struct {
+	sqlite *logger.Sqlite
+	redact func(d *neom9n.Data) *neom9n.Data
+}
+
+type SqlStoreOption func(*SqlStore)
+
+// WithRedaction redacts the coordinates stored inside the privacy zones,
+// privacy.Redactor.RedactFix being the redact func.
+func WithRedaction(redact func(d *neom9n.Data) *neom9n.Data) SqlStoreOption {
+	return func(s *SqlStore) {
+		s.redact = redact
+	}
+}
+
+func NewSqlStore(sqlite *logger.Sqlite, opts ...SqlStoreOption) *SqlStore {
+	s := &SqlStore{sqlite: sqlite}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// HandleEvent stores the speeding events, ignoring the others.
+func (s *SqlStore) HandleEvent(event data.Event) error {
+	e, ok := event.(*Event)
+	if !ok {
+		return nil
+	}
+
+	gnssData := e.GnssData
+	if s.redact != nil {
+		gnssData = s.redact(gnssData)
+	}
+	err := s.sqlite.Exec(insertQuery,
+		e.Time.Format("2006-01-02 15:04:05.99999"),
+		e.Name,
+		e.WayID,
+		e.RoadClass,
+		e.SpeedLimit,
+		e.Speed,
+		e.MaxOverage,
+		e.Duration,
+		gnssData.Latitude,
+		gnssData.Longitude,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting speeding event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package speeding
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+)
+
+// DefaultSpeedLimits are the speed limits, in km/h, of the road classes
+// (OSM highway tag) applying when a way has no maxspeed.
+var DefaultSpeedLimits = map[string]float64{
+	"motorway":       100,
+	"motorway_link":  70,
+	"trunk":          90,
+	"trunk_link":     60,
+	"primary":        70,
+	"primary_link":   50,
+	"secondary":      60,
+	"secondary_link": 50,
+	"tertiary":       50,
+	"tertiary_link":  40,
+	"unclassified":   50,
+	"residential":    40,
+	"living_street":  20,
+	"service":        20,
+	"road":           50,
+}
+
+// ParseSpeedLimits parses "class=km/h,class=km/h" road class speed limits,
+// overriding DefaultSpeedLimits.
+func ParseSpeedLimits(value string) (map[string]float64, error) {
+	limits := map[string]float64{}
+	for class, limit := range DefaultSpeedLimits {
+		limits[class] = limit
+	}
+	if value == "" {
+		return limits, nil
+	}
+
+	for _, classLimit := range strings.Split(value, ",") {
+		class, limit, found := strings.Cut(strings.TrimSpace(classLimit), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid speed limit %q, expecting class=km/h", classLimit)
+		}
+		speed, err := strconv.ParseFloat(limit, 64)
+		if err != nil || speed <= 0 {
+			return nil, fmt.Errorf("invalid speed limit %q of class %q", limit, class)
+		}
+		limits[class] = speed
+	}
+	return limits, nil
+}
+
+type EventHandler func(event data.Event) error
+
+type Option func(*Tracker)
+
+// WithSpeedLimits sets the speed limits, in km/h, of the road classes
+// applying when a way has no maxspeed. The ways of the other classes are not
+// tracked.
+func WithSpeedLimits(limits map[string]float64) Option {
+	return func(t *Tracker) {
+		t.speedLimits = limits
+	}
+}
+
+// WithTolerance sets by how many km/h the speed limit has to be exceeded to
+// be speeding.
+func WithTolerance(tolerance float64) Option {
+	return func(t *Tracker) {
+		t.tolerance = tolerance
+	}
+}
+
+// WithMatchDistance sets the distance, in meters, within which a fix is on a
+// road.
+func WithMatchDistance(distance float64) Option {
+	return func(t *Tracker) {
+		t.matchDistance = distance
+	}
+}
+
+// WithMaxHorizontalAccuracy ignores the fixes less accurate than accuracy
+// meters.
+func WithMaxHorizontalAccuracy(accuracy float64) Option {
+	return func(t *Tracker) {
+		t.maxHorizontalAccuracy = accuracy
+	}
+}
+
+// searchDistance is how far from a fix the way points are looked up, the
+// segments of the ways found being then measured. The ways are indexed with
+// points interpolated every searchDistance so a fix in the middle of a long
+// segment finds it.
+const searchDistance = 200
+
+// headingTolerance is the maximum difference, in degrees, between the fix
+// heading and the direction of a segment it is matched on.
+const headingTolerance = 45
+
+// minHeadingSpeed is the speed, in m/s, under which the heading of a fix is
+// too noisy to tell the direction of travel.
+const minHeadingSpeed = 2
+
+// Tracker compares the gnss speed with the speed limit of the road it is
+// matched on: the way maxspeed, or the speed limit of its class. It emits a
+// StartEvent when the speed goes over the limit by more than the tolerance,
+// and an EndEvent, with the maximum overage and the duration, when it goes
+// back under or the road is no longer known.
+type Tracker struct {
+	lock sync.Mutex
+
+	index                 *roads.Index
+	candidates            *roads.Index
+	handlers              []EventHandler
+	speedLimits           map[string]float64
+	tolerance             float64
+	matchDistance         float64
+	maxHorizontalAccuracy float64
+
+	// current is the start of the ongoing speeding, its MaxOverage updated
+	// as it goes.
+	current *Event
+}
+
+func NewTracker(index *roads.Index, handlers []EventHandler, opts ...Option) *Tracker {
+	t := &Tracker{
+		index:                 index,
+		candidates:            candidateIndex(index.Ways()),
+		handlers:              handlers,
+		speedLimits:           DefaultSpeedLimits,
+		tolerance:             5,
+		matchDistance:         25,
+		maxHorizontalAccuracy: 25,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *Tracker) HandleGnssData(d *neom9n.Data) error {
+	if (d.Fix != "2D" && d.Fix != "3D") || d.HorizontalAccuracy > t.maxHorizontalAccuracy {
+		return nil
+	}
+
+	way, err := t.match(d)
+	if err != nil {
+		return fmt.Errorf("matching road: %w", err)
+	}
+
+	var limit float64
+	if way != nil {
+		limit = way.MaxSpeed
+		if limit == 0 {
+			limit = t.speedLimits[way.Class]
+		}
+	}
+
+	speed := d.Speed * 3.6
+	var events []data.Event
+	t.lock.Lock()
+	switch {
+	case limit > 0 && speed-limit > t.tolerance:
+		if t.current == nil {
+			start := NewStartEvent(way, limit, speed, d.SystemTime, d)
+			start.MaxOverage = speed - limit
+			events = append(events, start)
+			current := *start
+			t.current = &current
+		}
+		t.current.MaxOverage = math.Max(t.current.MaxOverage, speed-limit)
+	case t.current != nil:
+		events = append(events, NewEndEvent(t.current, d.SystemTime, d))
+		t.current = nil
+	}
+	t.lock.Unlock()
+
+	for _, event := range events {
+		for _, handler := range t.handlers {
+			err := handler(event)
+			if err != nil {
+				return fmt.Errorf("handling speeding event: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// match returns the way of the closest segment within the match distance of
+// the fix, going in the direction of the fix heading when moving. It is nil
+// when no road is close enough.
+func (t *Tracker) match(d *neom9n.Data) (*roads.Way, error) {
+	points, err := t.candidates.Near(d.Longitude, d.Latitude, searchDistance)
+	if err != nil {
+		return nil, fmt.Errorf("finding near points: %w", err)
+	}
+
+	fix := geo.NewCoordinate(d.Longitude, d.Latitude)
+	checked := map[int64]bool{}
+	var closest *roads.Way
+	closestDistance := t.matchDistance
+	for _, p := range points {
+		if checked[p.WayID] {
+			continue
+		}
+		checked[p.WayID] = true
+
+		way := t.index.Way(p.WayID)
+		if way == nil {
+			continue
+		}
+		for i := 1; i < len(way.Points); i++ {
+			start := geo.NewCoordinate(way.Points[i-1].Lon, way.Points[i-1].Lat)
+			end := geo.NewCoordinate(way.Points[i].Lon, way.Points[i].Lat)
+			if d.Speed >= minHeadingSpeed && !aligned(start.HeadingTo(end), d.Heading, way.Oneway) {
+				continue
+			}
+
+			distance := segmentDistance(fix, start, end)
+			if distance <= closestDistance {
+				closest = way
+				closestDistance = distance
+			}
+		}
+	}
+	return closest, nil
+}
+
+// candidateIndex indexes the ways with points interpolated along their
+// segments, at most searchDistance apart.
+func candidateIndex(ways map[int64]*roads.Way) *roads.Index {
+	var dense []*roads.Way
+	for _, way := range ways {
+		var points []*roads.Point
+		if len(way.Points) > 0 {
+			points = append(points, way.Points[0])
+		}
+		for i := 1; i < len(way.Points); i++ {
+			from, to := way.Points[i-1], way.Points[i]
+			steps := math.Ceil(geo.Distance(geo.NewCoordinate(from.Lon, from.Lat), geo.NewCoordinate(to.Lon, to.Lat)) / searchDistance)
+			for step := 1.0; step < steps; step++ {
+				ratio := step / steps
+				points = append(points, &roads.Point{
+					Lon:   from.Lon + (to.Lon-from.Lon)*ratio,
+					Lat:   from.Lat + (to.Lat-from.Lat)*ratio,
+					WayID: way.ID,
+				})
+			}
+			points = append(points, to)
+		}
+		dense = append(dense, &roads.Way{ID: way.ID, Points: points})
+	}
+	return roads.NewIndex(dense)
+}
+
+// aligned tells if heading follows the segment direction, or is against it on
+// a two way road.
+func aligned(segmentHeading float64, heading float64, oneway bool) bool {
+	delta := math.Abs(math.Mod(heading-segmentHeading+540, 360) - 180)
+	return delta <= headingTolerance || (!oneway && delta >= 180-headingTolerance)
+}
+
+func segmentDistance(c, start, end *geo.Coordinate) float64 {
+	length := geo.Distance(start, end)
+	if length == 0 {
+		return geo.Distance(c, start)
+	}
+
+	along := geo.AlongTrackDistance(c, start, end)
+	switch {
+	case along <= 0:
+		return geo.Distance(c, start)
+	case along >= length:
+		return geo.Distance(c, end)
+	default:
+		return math.Abs(geo.CrossTrackDistance(c, start, end))
+	}
+}
+
+type Event struct {
+	*data.BaseEvent
+	WayID      int64   `json:"way_id"`
+	RoadClass  string  `json:"road_class"`
+	SpeedLimit float64 `json:"speed_limit"` // km/h
+	Speed      float64 `json:"speed"`       // km/h, when starting
+	MaxOverage float64 `json:"max_overage"` // km/h over the speed limit
+	Duration   float64 `json:"duration"`    // seconds, on end
+}
+
+func NewStartEvent(way *roads.Way, limit float64, speed float64, t time.Time, gnssData *neom9n.Data) *Event {
+	return &Event{
+		BaseEvent:  data.NewBaseEvent("SPEEDING_START", "SPEEDING", t, gnssData),
+		WayID:      way.ID,
+		RoadClass:  way.Class,
+		SpeedLimit: limit,
+		Speed:      speed,
+	}
+}
+
+func NewEndEvent(start *Event, t time.Time, gnssData *neom9n.Data) *Event {
+	return &Event{
+		BaseEvent:  data.NewBaseEvent("SPEEDING_END", "SPEEDING", t, gnssData),
+		WayID:      start.WayID,
+		RoadClass:  start.RoadClass,
+		SpeedLimit: start.SpeedLimit,
+		Speed:      start.Speed,
+		MaxOverage: start.MaxOverage,
+		Duration:   t.Sub(start.Time).Seconds(),
+	}
+}
+
+func (e *Event) String() string {
+	if e.Name == "SPEEDING_END" {
+		return fmt.Sprintf("Speeding End Event %.0f km/h over %.0f km/h for %.0fs", e.MaxOverage, e.SpeedLimit, e.Duration)
+	}
+	return fmt.Sprintf("Speeding Start Event %.0f km/h in %.0f km/h", e.Speed, e.SpeedLimit)
+}
@@ -0,0 +1,129 @@
+package speeding
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/roads"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	// a two way residential street going east and a one way primary road,
+	// limited to 50 km/h, going north across it
+	var residential []*roads.Point
+	for lon := -73.45; lon <= -73.4299; lon += 0.005 {
+		residential = append(residential, &roads.Point{Lon: lon, Lat: 45.575, WayID: 1})
+	}
+	ways := []*roads.Way{
+		{ID: 1, Class: "residential", Points: residential},
+		{ID: 2, Class: "primary", Oneway: true, MaxSpeed: 50, Points: []*roads.Point{
+			{Lon: -73.44, Lat: 45.57, WayID: 2},
+			{Lon: -73.44, Lat: 45.58, WayID: 2},
+		}},
+	}
+	departure := time.Date(2023, 9, 7, 9, 5, 0, 0, time.UTC)
+	offTheRoad := departure.Add(5 * time.Second)
+
+	tests := []struct {
+		name     string
+		fixes    []*neom9n.Data
+		expected []string
+	}{
+		{
+			name: "class speed limit",
+			fixes: []*neom9n.Data{
+				{SystemTime: departure, Fix: "3D", Latitude: 45.575, Longitude: -73.448, Speed: 30 / 3.6, Heading: 90, HorizontalAccuracy: 2},
+				{SystemTime: departure.Add(1 * time.Second), Fix: "3D", Latitude: 45.5751, Longitude: -73.447, Speed: 50 / 3.6, Heading: 90, HorizontalAccuracy: 2},
+				{SystemTime: departure.Add(2 * time.Second), Fix: "3D", Latitude: 45.5749, Longitude: -73.446, Speed: 60 / 3.6, Heading: 90, HorizontalAccuracy: 2},
+				{SystemTime: departure.Add(3 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.445, Speed: 42 / 3.6, Heading: 270, HorizontalAccuracy: 2},
+				{SystemTime: departure.Add(4 * time.Second), Fix: "3D", Latitude: 45.575, Longitude: -73.444, Speed: 30 / 3.6, Heading: 90, HorizontalAccuracy: 2},
+			},
+			expected: []string{"Speeding Start Event 50 km/h in 40 km/h", "Speeding End Event 20 km/h over 40 km/h for 2s"},
+		},
+		{
+			name: "way maxspeed, leaving the road",
+			fixes: []*neom9n.Data{
+				{SystemTime: departure, Fix: "3D", Latitude: 45.578, Longitude: -73.44, Speed: 60 / 3.6, Heading: 0, HorizontalAccuracy: 2},
+				{SystemTime: offTheRoad, Fix: "3D", Latitude: 45.59, Longitude: -73.40, Speed: 60 / 3.6, Heading: 0, HorizontalAccuracy: 2},
+			},
+			expected: []string{"Speeding Start Event 60 km/h in 50 km/h", "Speeding End Event 10 km/h over 50 km/h for 5s"},
+		},
+		{
+			name: "against a one way",
+			fixes: []*neom9n.Data{
+				{SystemTime: departure, Fix: "3D", Latitude: 45.578, Longitude: -73.44, Speed: 80 / 3.6, Heading: 180, HorizontalAccuracy: 2},
+			},
+		},
+		{
+			name: "inaccurate fixes are ignored",
+			fixes: []*neom9n.Data{
+				{SystemTime: departure, Fix: "3D", Latitude: 45.575, Longitude: -73.448, Speed: 20, Heading: 90, HorizontalAccuracy: 40},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []string
+			tracker := NewTracker(roads.NewIndex(ways), []EventHandler{func(event data.Event) error {
+				events = append(events, event.String())
+				return nil
+			}})
+			for _, d := range test.fixes {
+				require.NoError(t, tracker.HandleGnssData(d))
+			}
+			require.Equal(t, test.expected, events)
+		})
+	}
+}
+
+func TestParseSpeedLimits(t *testing.T) {
+	limits, err := ParseSpeedLimits("residential=30, motorway=120")
+	require.NoError(t, err)
+	require.Equal(t, 30.0, limits["residential"])
+	require.Equal(t, 120.0, limits["motorway"])
+	require.Equal(t, DefaultSpeedLimits["primary"], limits["primary"])
+	require.Equal(t, 40.0, DefaultSpeedLimits["residential"], "the defaults are left untouched")
+
+	_, err = ParseSpeedLimits("residential")
+	require.Error(t, err)
+	_, err = ParseSpeedLimits("residential=fast")
+	require.Error(t, err)
+}
+
+func TestSqlStore(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "speeding.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	// the event is inside a privacy zone
+	store := NewSqlStore(sqlite, WithRedaction(func(d *neom9n.Data) *neom9n.Data {
+		redacted := *d
+		redacted.Latitude, redacted.Longitude = 0, 0
+		return &redacted
+	}))
+
+	way := &roads.Way{ID: 2, Class: "primary"}
+	d := &neom9n.Data{SystemTime: time.Date(2023, 9, 7, 9, 12, 0, 0, time.UTC), Fix: "3D", Latitude: 45.578, Longitude: -73.44, Speed: 60 / 3.6, HorizontalAccuracy: 2}
+	startEvent := NewStartEvent(way, 50, 60, d.SystemTime, d)
+	startEvent.MaxOverage = 12
+	require.NoError(t, store.HandleEvent(NewEndEvent(startEvent, d.SystemTime.Add(8*time.Second), d)))
+	require.NoError(t, store.HandleEvent(data.NewBaseEvent("TRIP_START_EVENT", "TRIP", d.SystemTime, d)))
+
+	var rows []string
+	require.NoError(t, sqlite.Query(false, "SELECT name, way_id, speed_limit, max_overage, duration, latitude, longitude FROM speeding_events", func(r *sql.Rows) error {
+		var name string
+		var wayID int64
+		var limit, overage, duration, latitude, longitude float64
+		err := r.Scan(&name, &wayID, &limit, &overage, &duration, &latitude, &longitude)
+		rows = append(rows, fmt.Sprintf("%s %d %.0f %.0f %.0f %.3f %.3f", name, wayID, limit, overage, duration, latitude, longitude))
+		return err
+	}, nil))
+	require.Equal(t, []string{"SPEEDING_END 2 50 12 8 0.000 0.000"}, rows)
+	require.Equal(t, 45.578, d.Latitude, "the event is left untouched")
+}
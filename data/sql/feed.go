@@ -1,8 +1,8 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"math"
 	"time"
@@ -10,162 +10,357 @@ import (
 	"github.com/streamingfast/gnss-controller/device/neom9n"
 	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
-	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/streamingfast/hivemapper-data-logger/data/replay"
 	"github.com/streamingfast/imu-controller/device/iim42652"
+	_ "modernc.org/sqlite"
 )
 
-var LIMIT = 200
+// LIMIT is the number of rows read per page. Reading pages ahead of the
+// handlers is bounded to 2 pages.
+var LIMIT = 1000
+
+const timeLayout = "2006-01-02 15:04:05.99999"
+
+type Option func(*SqlImporterFeed)
 
 type SqlImporterFeed struct {
-	sqlite              *logger.Sqlite
+	dbPath              string
 	imuRawFeedHandlers  []imu.RawFeedHandler
 	gssDataFeedHandlers []gnss.GnssDataHandler
+
+	startTime  time.Time
+	endTime    time.Time
+	controller *replay.Controller
+	rawGnss    bool
+	satellites bool
 }
 
-func NewSqlImporterFeed(sqlite *logger.Sqlite, imuRawFeedHandlers []imu.RawFeedHandler, gssDataFeedHandlers []gnss.GnssDataHandler) *SqlImporterFeed {
-	return &SqlImporterFeed{
-		sqlite:              sqlite,
+func NewSqlImporterFeed(dbPath string, imuRawFeedHandlers []imu.RawFeedHandler, gssDataFeedHandlers []gnss.GnssDataHandler, opts ...Option) *SqlImporterFeed {
+	s := &SqlImporterFeed{
+		dbPath:              dbPath,
 		imuRawFeedHandlers:  imuRawFeedHandlers,
 		gssDataFeedHandlers: gssDataFeedHandlers,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithTimeRange only replays the rows with an imu_time between start and end,
+// a zero time leaving that side of the range unbounded.
+func WithTimeRange(start time.Time, end time.Time) Option {
+	return func(s *SqlImporterFeed) {
+		s.startTime = start
+		s.endTime = end
+	}
+}
+
+// WithController paces the replay, and lets it be paused, resumed and seeked.
+func WithController(controller *replay.Controller) Option {
+	return func(s *SqlImporterFeed) {
+		s.controller = controller
+	}
+}
+
+// WithRawGnss replays the raw gnss positions, stored along the filtered ones,
+// to evaluate the filtering again.
+func WithRawGnss() Option {
+	return func(s *SqlImporterFeed) {
+		s.rawGnss = true
+	}
+}
+
+type row struct {
+	time           time.Time
+	gnssSystemTime string // as stored, the key of the satellites
+	acceleration   *iim42652.Acceleration
+	temperature    iim42652.Temperature
+	gnssData       *neom9n.Data
+	err            error
+}
+
+// cursor is the (imu_time, id) key of the last row read, imu_time being kept
+// as stored so the keyset comparison is done on the exact same value.
+type cursor struct {
+	imuTime string
+	id      int64
 }
 
 func (s *SqlImporterFeed) Run(axisMap *iim42652.AxisMap) error {
 	fmt.Println("Starting sql feed")
 
-	numOfRows := 0
-	err := s.sqlite.SingleRowQuery("select count(*) from imu_raw;", func(rows *sql.Rows) error {
-		err := rows.Scan(&numOfRows)
-		if err != nil {
-			return fmt.Errorf("scanning last position: %s", err.Error())
-		}
-		return nil
-	}, nil)
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", s.dbPath))
+	if err != nil {
+		return fmt.Errorf("opening database %q: %w", s.dbPath, err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
 
-	fmt.Printf("found rows %d\n", numOfRows)
+	// the files logged before the gnss_satellites table are replayed without
+	// the RXM-MEASX measurements
+	err = db.QueryRow("select count(*) > 0 from sqlite_master where type = 'table' and name = 'gnss_satellites'").Scan(&s.satellites)
 	if err != nil {
-		return fmt.Errorf("failed to fetch number of rows in table merged: %w", err)
+		return fmt.Errorf("looking up the gnss_satellites table: %w", err)
+	}
+
+	to := s.endTime
+	if to.IsZero() {
+		to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
 	}
 
-	numOfIterations := int(math.Floor(float64(numOfRows/LIMIT)) + 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	from := &cursor{imuTime: s.startTime.UTC().Format(timeLayout)}
+	rows, stop := s.read(ctx, db, from, to.UTC().Format(timeLayout))
 
 	lastGnssSystemTime := time.Time{}
-	for i := 0; i < numOfIterations; i++ {
-		offset := LIMIT * i
-		var rxmMeasx *string
-		err := s.sqlite.Query(false, query(offset), func(rows *sql.Rows) error {
-			id := 0
-			t := time.Time{}
-			temperature := iim42652.NewTemperature(0.0)
-			acceleration := &iim42652.Acceleration{}
-			gnssData := &neom9n.Data{
-				SystemTime: time.Time{},
-				Timestamp:  time.Time{},
-				Dop:        &neom9n.Dop{},
-				Satellites: &neom9n.Satellites{},
-				RF:         &neom9n.RF{},
-			}
-			err := rows.Scan(
-				&id,
-				&t,
-				&acceleration.X,
-				&acceleration.Y,
-				&acceleration.Z,
-				&temperature,
-				&gnssData.SystemTime,
-				&gnssData.Timestamp,
-				&gnssData.Fix,
-				&gnssData.Ttff,
-				&gnssData.Latitude,
-				&gnssData.Longitude,
-				&gnssData.Altitude,
-				&gnssData.Speed,
-				&gnssData.Heading,
-				&gnssData.Satellites.Seen,
-				&gnssData.Satellites.Used,
-				&gnssData.Eph,
-				&gnssData.HorizontalAccuracy,
-				&gnssData.VerticalAccuracy,
-				&gnssData.HeadingAccuracy,
-				&gnssData.SpeedAccuracy,
-				&gnssData.Dop.HDop,
-				&gnssData.Dop.VDop,
-				&gnssData.Dop.XDop,
-				&gnssData.Dop.YDop,
-				&gnssData.Dop.TDop,
-				&gnssData.Dop.PDop,
-				&gnssData.Dop.GDop,
-				&gnssData.RF.JammingState,
-				&gnssData.RF.AntStatus,
-				&gnssData.RF.AntPower,
-				&gnssData.RF.PostStatus,
-				&gnssData.RF.NoisePerMS,
-				&gnssData.RF.AgcCnt,
-				&gnssData.RF.JamInd,
-				&gnssData.RF.OfsI,
-				&gnssData.RF.MagI,
-				&gnssData.RF.OfsQ,
-				&gnssData.GGA,
-				&rxmMeasx,
-			)
-			if err != nil {
-				return fmt.Errorf("scanning last position: %s", err.Error())
+	count := 0
+	start := time.Now()
+	for {
+		r, ok := <-rows
+		if !ok {
+			break
+		}
+		if r.err != nil {
+			return fmt.Errorf("reading imu_raw: %w", r.err)
+		}
+
+		if s.controller != nil {
+			if seekTo, seeking := s.controller.Wait(r.time); seeking {
+				fmt.Println("Seeking sql feed to", seekTo)
+				stop()
+				rows, stop = s.read(ctx, db, &cursor{imuTime: seekTo.UTC().Format(timeLayout)}, to.UTC().Format(timeLayout))
+				lastGnssSystemTime = time.Time{}
+				continue
 			}
+		}
 
-			err = json.Unmarshal([]byte(*rxmMeasx), &gnssData.RxmMeasx)
+		count++
+		ar := &iim42652.AngularRate{}
+		for _, handler := range s.imuRawFeedHandlers {
+			x := axisMap.X(r.acceleration)
+			y := axisMap.Y(r.acceleration)
+			z := axisMap.Z(r.acceleration)
+			m := math.Sqrt(x*x + y*y + z*z)
+			a := imu.NewAcceleration(x, y, z, m, r.time)
+			err := handler(a, ar, r.temperature)
 			if err != nil {
-				return fmt.Errorf("failed to unmarshal rxmMeasx: %w", err)
+				return fmt.Errorf("failed to handle imu raw feed: %w", err)
 			}
+		}
 
-			ar := &iim42652.AngularRate{}
-			for _, handler := range s.imuRawFeedHandlers {
-				x := axisMap.X(acceleration)
-				y := axisMap.Y(acceleration)
-				z := axisMap.Z(acceleration)
-				m := math.Sqrt(x*x + y*y + z*z)
-				a := imu.NewAcceleration(x, y, z, m, t)
-				err := handler(a, ar, temperature)
+		if r.gnssData.SystemTime != lastGnssSystemTime {
+			lastGnssSystemTime = r.gnssData.SystemTime
+			for _, handler := range s.gssDataFeedHandlers {
+				err := handler(r.gnssData)
 				if err != nil {
-					return fmt.Errorf("failed to handle imu raw feed: %w", err)
+					return fmt.Errorf("failed to handle gnss data feed: %w", err)
 				}
 			}
+		}
+	}
+
+	fmt.Printf("Finished sql feed, %d rows in %s\n", count, time.Since(start))
+	return nil
+}
+
+// read streams the rows following from, up to the to imu_time, in a
+// goroutine. Pages are fetched with keyset pagination on (imu_time, id) so
+// each page costs the same whatever its position in the table. The channel is
+// closed once all the rows are read, on error (sent as the last row) or when
+// the returned stop function is called.
+func (s *SqlImporterFeed) read(parent context.Context, db *sql.DB, from *cursor, to string) (<-chan *row, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	out := make(chan *row, 2*LIMIT)
+
+	go func() {
+		defer close(out)
 
-			if gnssData.SystemTime != lastGnssSystemTime {
-				lastGnssSystemTime = gnssData.SystemTime
-				for _, handler := range s.gssDataFeedHandlers {
-					err := handler(gnssData)
-					if err != nil {
-						return fmt.Errorf("failed to handle gnss data feed: %w", err)
-					}
+		send := func(r *row) bool {
+			select {
+			case out <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		last := from
+		for {
+			var page []*row
+			var err error
+			page, last, err = readPage(ctx, db, s.query(), last, to, s.satellites)
+			if err != nil {
+				if ctx.Err() == nil {
+					send(&row{err: err})
+				}
+				return
+			}
+
+			for _, r := range page {
+				if !send(r) {
+					return
 				}
 			}
-			return nil
-		}, nil)
 
+			if len(page) < LIMIT {
+				return
+			}
+		}
+	}()
+
+	return out, cancel
+}
+
+func (s *SqlImporterFeed) query() string {
+	if s.rawGnss {
+		return fmt.Sprintf(importQuery, "gnss_raw_latitude", "gnss_raw_longitude")
+	}
+	return fmt.Sprintf(importQuery, "gnss_latitude", "gnss_longitude")
+}
+
+func readPage(ctx context.Context, db *sql.DB, query string, from *cursor, to string, satellites bool) ([]*row, *cursor, error) {
+	rows, err := db.QueryContext(ctx, query, from.imuTime, from.id, to, LIMIT)
+	if err != nil {
+		return nil, nil, fmt.Errorf("querying page after %s/%d: %w", from.imuTime, from.id, err)
+	}
+	defer rows.Close()
+
+	last := from
+	var page []*row
+	for rows.Next() {
+		r, c, err := scanRow(rows)
 		if err != nil {
-			return fmt.Errorf("failed to query database: %w", err)
+			return nil, nil, err
 		}
+		page = append(page, r)
+		last = c
 	}
 
-	fmt.Println("Finished sql feed")
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterating page after %s/%d: %w", from.imuTime, from.id, err)
+	}
+	rows.Close()
+
+	if satellites && len(page) > 0 {
+		err := joinSatellites(ctx, db, page)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return page, last, nil
+}
+
+// joinSatellites sets the RXM-MEASX measurements of the gnss data of the page
+// rows, read in one query for the range of gnss system times of the page.
+func joinSatellites(ctx context.Context, db *sql.DB, page []*row) error {
+	from, to := page[0].gnssSystemTime, page[0].gnssSystemTime
+	for _, r := range page {
+		if r.gnssSystemTime < from {
+			from = r.gnssSystemTime
+		}
+		if r.gnssSystemTime > to {
+			to = r.gnssSystemTime
+		}
+	}
+
+	epochs, err := gnss.ReadSatellites(ctx, db, from, to)
+	if err != nil {
+		return fmt.Errorf("joining satellites: %w", err)
+	}
+	for _, r := range page {
+		r.gnssData.RxmMeasx = epochs[r.gnssSystemTime]
+	}
 	return nil
 }
 
-func query(offset int) string {
-	return fmt.Sprintf(`
-		select 
+func scanRow(rows *sql.Rows) (*row, *cursor, error) {
+	c := &cursor{}
+	r := &row{
+		temperature:  iim42652.NewTemperature(0.0),
+		acceleration: &iim42652.Acceleration{},
+		gnssData: &neom9n.Data{
+			SystemTime: time.Time{},
+			Timestamp:  time.Time{},
+			Dop:        &neom9n.Dop{},
+			Satellites: &neom9n.Satellites{},
+			RF:         &neom9n.RF{},
+		},
+	}
+	gnssData := r.gnssData
+
+	err := rows.Scan(
+		&c.id,
+		&c.imuTime,
+		&r.time,
+		&r.acceleration.X,
+		&r.acceleration.Y,
+		&r.acceleration.Z,
+		&r.temperature,
+		&gnssData.SystemTime,
+		&r.gnssSystemTime,
+		&gnssData.Timestamp,
+		&gnssData.Fix,
+		&gnssData.Ttff,
+		&gnssData.Latitude,
+		&gnssData.Longitude,
+		&gnssData.Altitude,
+		&gnssData.Speed,
+		&gnssData.Heading,
+		&gnssData.Satellites.Seen,
+		&gnssData.Satellites.Used,
+		&gnssData.Eph,
+		&gnssData.HorizontalAccuracy,
+		&gnssData.VerticalAccuracy,
+		&gnssData.HeadingAccuracy,
+		&gnssData.SpeedAccuracy,
+		&gnssData.Dop.HDop,
+		&gnssData.Dop.VDop,
+		&gnssData.Dop.XDop,
+		&gnssData.Dop.YDop,
+		&gnssData.Dop.TDop,
+		&gnssData.Dop.PDop,
+		&gnssData.Dop.GDop,
+		&gnssData.RF.JammingState,
+		&gnssData.RF.AntStatus,
+		&gnssData.RF.AntPower,
+		&gnssData.RF.PostStatus,
+		&gnssData.RF.NoisePerMS,
+		&gnssData.RF.AgcCnt,
+		&gnssData.RF.JamInd,
+		&gnssData.RF.OfsI,
+		&gnssData.RF.MagI,
+		&gnssData.RF.OfsQ,
+		&gnssData.GGA,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("scanning imu_raw row: %w", err)
+	}
+
+	return r, c, nil
+}
+
+const importQuery = `
+		select
 			   id,
+			   cast(imu_time as text),
                imu_time,
 			   imu_acc_x,
 			   imu_acc_y,
 			   imu_acc_z,
 			   imu_temperature,
 			   gnss_system_time,
+			   cast(gnss_system_time as text),
 			   gnss_time,
 			   gnss_fix,
 			   gnss_ttff,
-			   gnss_latitude,
-			   gnss_longitude,
+			   %s,
+			   %s,
 			   gnss_altitude,
 			   gnss_speed,
 			   gnss_heading,
@@ -193,9 +388,8 @@ func query(offset int) string {
 			   gnss_rf_ofs_i,
 			   gnss_rf_mag_i,
 			   gnss_rf_ofs_q,
-			   gnss_gga,
-			   gnss_rxm_measx
-		from imu_raw order by imu_time asc limit %d offset %d;
-		`, LIMIT, offset,
-	)
-}
+			   gnss_gga
+		from imu_raw
+		where (imu_time, id) > (?, ?) and imu_time <= ?
+		order by imu_time asc, id asc limit ?;
+`
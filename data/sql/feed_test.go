@@ -0,0 +1,190 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daedaleanai/ublox/ubx"
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/deadreckoning"
+	"github.com/streamingfast/hivemapper-data-logger/data/gnss"
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/streamingfast/hivemapper-data-logger/data/merged"
+	"github.com/streamingfast/imu-controller/device/iim42652"
+	"github.com/stretchr/testify/require"
+)
+
+var fixtureStart = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+// writeFixture creates a database with rows imu_raw rows at 40Hz, 2 rows
+// sharing each imu_time so pages get cut in the middle of a timestamp, and a
+// gnss fix every second. The raw gnss latitude is 45.5, the filtered one 45.4.
+// Each gnss epoch has 2 satellites in gnss_satellites.
+func writeFixture(tb testing.TB, rows int) string {
+	tb.Helper()
+
+	dbPath := filepath.Join(tb.TempDir(), "fixture.db")
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(tb, err)
+	defer db.Close()
+
+	_, err = db.Exec(gnss.CreateTableQuery())
+	require.NoError(tb, err)
+	_, err = db.Exec(merged.ImuRawCreateTableQuery())
+	require.NoError(tb, err)
+	_, err = db.Exec(gnss.SatellitesCreateTableQuery())
+	require.NoError(tb, err)
+
+	tx, err := db.Begin()
+	require.NoError(tb, err)
+
+	var stmt *sql.Stmt
+	var gnssID int64
+	gnssData := &neom9n.Data{
+		Dop:        &neom9n.Dop{},
+		Satellites: &neom9n.Satellites{},
+		RF:         &neom9n.RF{},
+		Latitude:   45.4,
+		RxmMeasx:   fixtureMeasx(),
+	}
+	rawGnssData := *gnssData
+	rawGnssData.Latitude = 45.5
+	for i := 0; i < rows; i++ {
+		t := fixtureStart.Add(time.Duration(i/2) * 25 * time.Millisecond)
+		systemTime := fixtureStart.Add(time.Duration(i/80) * time.Second)
+		if i == 0 || !systemTime.Equal(gnssData.SystemTime) {
+			gnssData.SystemTime = systemTime
+			gnssID++
+			query, fields, params := gnss.NewSqlWrapper(gnssID, gnssData, &rawGnssData).InsertQuery()
+			_, err := tx.Exec(query+strings.TrimSuffix(fields, ","), params...)
+			require.NoError(tb, err)
+			for _, satellite := range gnss.NewSatelliteSqlWrappers(gnssData) {
+				query, fields, params := satellite.InsertQuery()
+				_, err := tx.Exec(query+strings.TrimSuffix(fields, ","), params...)
+				require.NoError(tb, err)
+			}
+		}
+		acceleration := imu.NewAcceleration(float64(i), float64(i), float64(i), 1, t)
+		query, fields, params := merged.NewImuRawSqlWrapper(iim42652.NewTemperature(20), acceleration, acceleration.Time, gnssID, gnssData, deadreckoning.NewGnssPosition(gnssData)).InsertQuery()
+		if stmt == nil {
+			stmt, err = tx.Prepare(query + strings.TrimSuffix(fields, ","))
+			require.NoError(tb, err)
+		}
+		_, err := stmt.Exec(params...)
+		require.NoError(tb, err)
+	}
+
+	require.NoError(tb, stmt.Close())
+	require.NoError(tb, tx.Commit())
+
+	return dbPath
+}
+
+func fixtureMeasx() *ubx.RxmMeasx {
+	return &ubx.RxmMeasx{
+		NumSV: 2,
+		SV: []*ubx.RxmMeasxSVType{
+			{GnssId: 0, SvId: 12, CNo: 41, DopplerMS_m_s: -250},
+			{GnssId: 6, SvId: 3, CNo: 28, MpathIndic: 2},
+		},
+	}
+}
+
+func TestSqlImporterFeed_Run(t *testing.T) {
+	defer func(limit int) { LIMIT = limit }(LIMIT)
+	LIMIT = 7
+
+	dbPath := writeFixture(t, 100)
+
+	tests := []struct {
+		name             string
+		start            time.Time
+		end              time.Time
+		rawGnss          bool
+		expectedFirst    float64
+		expectedCount    int
+		expectedLatitude float64
+	}{
+		{name: "all rows", expectedFirst: 0, expectedCount: 100, expectedLatitude: 45.4},
+		{name: "time range", start: fixtureStart.Add(100 * time.Millisecond), end: fixtureStart.Add(200 * time.Millisecond), expectedFirst: 8, expectedCount: 10, expectedLatitude: 45.4},
+		{name: "raw gnss", rawGnss: true, expectedFirst: 0, expectedCount: 100, expectedLatitude: 45.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := []Option{WithTimeRange(test.start, test.end)}
+			if test.rawGnss {
+				options = append(options, WithRawGnss())
+			}
+
+			var xs []float64
+			gnssCount := 0
+			feed := NewSqlImporterFeed(
+				dbPath,
+				[]imu.RawFeedHandler{func(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, temperature iim42652.Temperature) error {
+					xs = append(xs, acceleration.X)
+					return nil
+				}},
+				[]gnss.GnssDataHandler{func(data *neom9n.Data) error {
+					gnssCount++
+					require.Equal(t, test.expectedLatitude, data.Latitude)
+					require.NotNil(t, data.RxmMeasx)
+					require.Len(t, data.RxmMeasx.SV, 2)
+					require.Equal(t, byte(12), data.RxmMeasx.SV[0].SvId)
+					require.Equal(t, int32(-250), data.RxmMeasx.SV[0].DopplerMS_m_s)
+					require.Equal(t, byte(6), data.RxmMeasx.SV[1].GnssId)
+					require.Equal(t, byte(2), data.RxmMeasx.SV[1].MpathIndic)
+					return nil
+				}},
+				options...,
+			)
+
+			require.NoError(t, feed.Run(iim42652.NewAxisMap("X", "Y", "Z")))
+			require.Len(t, xs, test.expectedCount)
+			for i, x := range xs {
+				require.Equal(t, test.expectedFirst+float64(i), x)
+			}
+			require.Greater(t, gnssCount, 0)
+		})
+	}
+}
+
+// BenchmarkSqlImporterFeed_Run reports the rows/s replayed for growing files,
+// which stays flat with keyset pagination. Set SQL_FEED_BENCH_ROWS (ex:
+// 2000000) to run it on a multi-million-row file.
+func BenchmarkSqlImporterFeed_Run(b *testing.B) {
+	sizes := []int{10_000, 100_000}
+	if env := os.Getenv("SQL_FEED_BENCH_ROWS"); env != "" {
+		rows, err := strconv.Atoi(env)
+		require.NoError(b, err)
+		sizes = append(sizes, rows)
+	}
+
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			dbPath := writeFixture(b, size)
+			count := 0
+			feed := NewSqlImporterFeed(
+				dbPath,
+				[]imu.RawFeedHandler{func(acceleration *imu.Acceleration, angularRate *iim42652.AngularRate, temperature iim42652.Temperature) error {
+					count++
+					return nil
+				}},
+				nil,
+			)
+			axisMap := iim42652.NewAxisMap("X", "Y", "Z")
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, feed.Run(axisMap))
+			}
+			b.ReportMetric(float64(count)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package trip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	gmux "github.com/gorilla/mux"
+)
+
+type HttpApi struct {
+	store   *SqlStore
+	tracker *Tracker
+	correct func(systemTime time.Time) time.Time
+}
+
+// NewHttpApi serves the trips of store and tracker. The trips being timed with
+// the system time of the fixes, correct converts their times to the gnss
+// corrected one of the imu rows, like clock.Sync.Correct. Nil when the imu
+// rows are stamped with the system time.
+func NewHttpApi(store *SqlStore, tracker *Tracker, correct func(systemTime time.Time) time.Time) *HttpApi {
+	return &HttpApi{store: store, tracker: tracker, correct: correct}
+}
+
+// Register adds the trip routes to router: /trips, /trips/current,
+// /trips/{id} and /trips/{id}/rawData.
+func (a *HttpApi) Register(router *gmux.Router) {
+	router.HandleFunc("/trips", a.GetTrips).Methods("GET")
+	router.HandleFunc("/trips/current", a.GetCurrentTrip).Methods("GET")
+	router.HandleFunc("/trips/{id:[0-9]+}", a.GetTrip).Methods("GET")
+	router.HandleFunc("/trips/{id:[0-9]+}/rawData", a.GetTripData).Methods("GET")
+}
+
+func (a *HttpApi) GetTrips(w http.ResponseWriter, _ *http.Request) {
+	trips, err := a.store.List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("listing trips: %s", err), http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, trips)
+}
+
+func (a *HttpApi) GetCurrentTrip(w http.ResponseWriter, _ *http.Request) {
+	trip := a.tracker.Current()
+	if trip == nil {
+		http.Error(w, "no trip in progress", http.StatusNotFound)
+		return
+	}
+	writeJson(w, trip)
+}
+
+func (a *HttpApi) GetTrip(w http.ResponseWriter, r *http.Request) {
+	trip, ok := a.trip(w, r)
+	if !ok {
+		return
+	}
+	writeJson(w, trip)
+}
+
+// GetTripData redirects to the raw data of the trip time range, on the clock
+// of the imu rows, accepting the same includeImu and includeGnss parameters.
+func (a *HttpApi) GetTripData(w http.ResponseWriter, r *http.Request) {
+	trip, ok := a.trip(w, r)
+	if !ok {
+		return
+	}
+
+	from, to := trip.StartTime, trip.EndTime
+	if a.correct != nil {
+		from, to = a.correct(from), a.correct(to)
+	}
+	query := r.URL.Query()
+	query.Set("from", from.Add(-time.Millisecond).Format("2006-01-02 15:04:05.99999"))
+	query.Set("to", to.Add(time.Millisecond).Format("2006-01-02 15:04:05.99999"))
+	http.Redirect(w, r, (&url.URL{Path: "/rawData", RawQuery: query.Encode()}).String(), http.StatusFound)
+}
+
+func (a *HttpApi) trip(w http.ResponseWriter, r *http.Request) (*Trip, bool) {
+	id, err := strconv.ParseInt(gmux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid trip id: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	trip, err := a.store.Get(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("getting trip: %s", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if trip == nil {
+		http.Error(w, fmt.Sprintf("trip %d not found", id), http.StatusNotFound)
+		return nil, false
+	}
+	return trip, true
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Fprintf(w, "error: %s", err)
+	}
+}
@@ -0,0 +1,57 @@
+package trip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"testing"
+	"time"
+
+	gmux "github.com/gorilla/mux"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpApi_GetTripData(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "trips.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	store := NewSqlStore(sqlite)
+
+	// the system clock booted a day late, the imu rows being stamped with the
+	// gnss time
+	departure := time.Date(2023, 9, 2, 8, 0, 0, 0, time.UTC)
+	arrival := departure.Add(20 * time.Minute)
+	require.NoError(t, store.Save(&Trip{StartTime: departure, EndTime: arrival, EventCounts: map[string]int{}, Ended: true}))
+
+	tests := []struct {
+		name     string
+		correct  func(systemTime time.Time) time.Time
+		expected url.Values
+	}{
+		{
+			name:     "system time",
+			expected: url.Values{"from": {"2023-09-02 07:59:59.999"}, "to": {"2023-09-02 08:20:00.001"}, "includeImu": {"true"}},
+		},
+		{
+			name:     "gnss corrected time",
+			correct:  func(systemTime time.Time) time.Time { return systemTime.Add(-24 * time.Hour) },
+			expected: url.Values{"from": {"2023-09-01 07:59:59.999"}, "to": {"2023-09-01 08:20:00.001"}, "includeImu": {"true"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gmux.NewRouter()
+			NewHttpApi(store, nil, test.correct).Register(router)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/trips/1/rawData?includeImu=true", nil))
+
+			require.Equal(t, http.StatusFound, w.Code)
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Equal(t, "/rawData", location.Path)
+			require.Equal(t, test.expected, location.Query())
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package trip
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+)
+
+const CreateTable string = `
+	CREATE TABLE IF NOT EXISTS trips (
+		id INTEGER NOT NULL PRIMARY KEY,
+		start_time TIMESTAMP NOT NULL UNIQUE,
+		end_time TIMESTAMP NOT NULL,
+		start_latitude REAL NOT NULL,
+		start_longitude REAL NOT NULL,
+		end_latitude REAL NOT NULL,
+		end_longitude REAL NOT NULL,
+		distance REAL NOT NULL,
+		duration REAL NOT NULL,
+		max_speed REAL NOT NULL,
+		event_counts TEXT NOT NULL,
+		ended INTEGER NOT NULL
+	);
+	create index if not exists trips_end_time_idx on trips(end_time);
+`
+
+const upsertQuery string = `
+	INSERT INTO trips VALUES(NULL,?,?,?,?,?,?,?,?,?,?,?)
+	ON CONFLICT(start_time) DO UPDATE SET
+		end_time = excluded.end_time,
+		end_latitude = excluded.end_latitude,
+		end_longitude = excluded.end_longitude,
+		distance = excluded.distance,
+		duration = excluded.duration,
+		max_speed = excluded.max_speed,
+		event_counts = excluded.event_counts,
+		ended = excluded.ended;
+`
+
+const endOpenTripsQuery string = `
+	UPDATE trips SET ended = 1 WHERE ended = 0;
+`
+
+const selectQuery string = `
+	SELECT id, start_time, end_time, start_latitude, start_longitude, end_latitude, end_longitude, distance, duration, max_speed, event_counts, ended
+	FROM trips
+`
+
+const purgeQuery string = `
+	DELETE FROM trips WHERE end_time < ?;
+`
+
+func CreateTableQuery() string {
+	return CreateTable
+}
+
+func PurgeQuery() string {
+	return purgeQuery
+}
+
+type SqlStore struct {
+	sqlite *logger.Sqlite
+}
+
+func NewSqlStore(sqlite *logger.Sqlite) *SqlStore {
+	return &SqlStore{sqlite: sqlite}
+}
+
+func (s *SqlStore) Save(trip *Trip) error {
+	eventCounts, err := json.Marshal(trip.EventCounts)
+	if err != nil {
+		return fmt.Errorf("marshalling event counts: %w", err)
+	}
+
+	err = s.sqlite.Exec(upsertQuery,
+		trip.StartTime.Format("2006-01-02 15:04:05.99999"),
+		trip.EndTime.Format("2006-01-02 15:04:05.99999"),
+		trip.StartLatitude,
+		trip.StartLongitude,
+		trip.EndLatitude,
+		trip.EndLongitude,
+		trip.Distance,
+		trip.Duration,
+		trip.MaxSpeed,
+		string(eventCounts),
+		trip.Ended,
+	)
+	if err != nil {
+		return fmt.Errorf("upserting trip: %w", err)
+	}
+	return nil
+}
+
+func (s *SqlStore) EndOpenTrips() error {
+	return s.sqlite.Exec(endOpenTripsQuery)
+}
+
+// List returns the trips, most recent first.
+func (s *SqlStore) List() ([]*Trip, error) {
+	trips := []*Trip{}
+	err := s.sqlite.Query(false, selectQuery+"ORDER BY start_time DESC", func(rows *sql.Rows) error {
+		trip, err := scanTrip(rows)
+		if err != nil {
+			return err
+		}
+		trips = append(trips, trip)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("querying trips: %w", err)
+	}
+	return trips, nil
+}
+
+// Get returns the trip with id, nil when not found.
+func (s *SqlStore) Get(id int64) (*Trip, error) {
+	var trip *Trip
+	err := s.sqlite.SingleRowQuery(selectQuery+"WHERE id = ?", func(rows *sql.Rows) error {
+		var err error
+		trip, err = scanTrip(rows)
+		return err
+	}, id)
+	if err != nil {
+		return nil, fmt.Errorf("querying trip %d: %w", id, err)
+	}
+	return trip, nil
+}
+
+func scanTrip(rows *sql.Rows) (*Trip, error) {
+	trip := &Trip{}
+	var eventCounts string
+	err := rows.Scan(
+		&trip.ID,
+		&trip.StartTime,
+		&trip.EndTime,
+		&trip.StartLatitude,
+		&trip.StartLongitude,
+		&trip.EndLatitude,
+		&trip.EndLongitude,
+		&trip.Distance,
+		&trip.Duration,
+		&trip.MaxSpeed,
+		&eventCounts,
+		&trip.Ended,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scanning trip: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(eventCounts), &trip.EventCounts)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling event counts: %w", err)
+	}
+	return trip, nil
+}
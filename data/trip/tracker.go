@@ -0,0 +1,321 @@
+package trip
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/odometer"
+)
+
+type EventHandler func(event data.Event) error
+
+// Store persists the trips, a trip being identified by its start time.
+type Store interface {
+	Save(trip *Trip) error
+	// EndOpenTrips ends the trips left in progress by the previous run, at
+	// their last saved end time.
+	EndOpenTrips() error
+}
+
+type Trip struct {
+	ID             int64          `json:"id"`
+	StartTime      time.Time      `json:"start_time"`
+	EndTime        time.Time      `json:"end_time"`
+	StartLatitude  float64        `json:"start_latitude"`
+	StartLongitude float64        `json:"start_longitude"`
+	EndLatitude    float64        `json:"end_latitude"`
+	EndLongitude   float64        `json:"end_longitude"`
+	Distance       float64        `json:"distance"` // meters
+	Duration       float64        `json:"duration"` // seconds
+	MaxSpeed       float64        `json:"max_speed"`
+	EventCounts    map[string]int `json:"event_counts"`
+	Ended          bool           `json:"ended"`
+}
+
+type Option func(*Tracker)
+
+// WithStartSpeed sets the speed, in m/s, to keep for count consecutive
+// gnss epochs to start a trip.
+func WithStartSpeed(speed float64, count int) Option {
+	return func(t *Tracker) {
+		t.startSpeed = speed
+		t.startCount = count
+	}
+}
+
+// WithStop sets the speed, in m/s, under which the vehicle is stopped, and
+// how long it has to stay stopped to end the trip.
+func WithStop(speed float64, duration time.Duration) Option {
+	return func(t *Tracker) {
+		t.stopSpeed = speed
+		t.stopDuration = duration
+	}
+}
+
+func WithStore(store Store, saveInterval time.Duration) Option {
+	return func(t *Tracker) {
+		t.store = store
+		t.saveInterval = saveInterval
+	}
+}
+
+// WithRedaction redacts the start and end coordinates of the trips inside the
+// privacy zones, privacy.Redactor.RedactFix being the redact func.
+func WithRedaction(redact func(d *neom9n.Data) *neom9n.Data) Option {
+	return func(t *Tracker) {
+		t.redact = redact
+	}
+}
+
+// position is the state of the vehicle at a gnss epoch.
+type position struct {
+	time      time.Time
+	latitude  float64
+	longitude float64
+	lifetime  float64 // odometer lifetime distance
+}
+
+// Tracker splits the drive in trips from the odometer events: a trip starts
+// once moving for a few epochs, and ends after being stopped for a while, or
+// when the logger stops (ignition off). The other events received during a
+// trip are counted by name.
+type Tracker struct {
+	lock sync.Mutex
+
+	startSpeed   float64
+	startCount   int
+	stopSpeed    float64
+	stopDuration time.Duration
+	store        Store
+	saveInterval time.Duration
+	redact       func(d *neom9n.Data) *neom9n.Data
+	handlers     []EventHandler
+
+	current       *Trip
+	startLifetime float64
+	lastSaved     time.Time
+
+	movingCount int
+	movingSince *position
+	stoppedAt   *position
+}
+
+func NewTracker(handlers []EventHandler, opts ...Option) (*Tracker, error) {
+	t := &Tracker{
+		startSpeed:   10 / 3.6,
+		startCount:   3,
+		stopSpeed:    4 / 3.6,
+		stopDuration: 5 * time.Minute,
+		handlers:     handlers,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if t.store != nil {
+		err := t.store.EndOpenTrips()
+		if err != nil {
+			return nil, fmt.Errorf("ending open trips: %w", err)
+		}
+	}
+
+	return t, nil
+}
+
+// Current returns a copy of the trip in progress, nil when stopped.
+func (t *Tracker) Current() *Trip {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.current == nil {
+		return nil
+	}
+	return t.current.clone()
+}
+
+func (t *Trip) clone() *Trip {
+	trip := *t
+	trip.EventCounts = make(map[string]int, len(t.EventCounts))
+	for name, count := range t.EventCounts {
+		trip.EventCounts[name] = count
+	}
+	return &trip
+}
+
+func (t *Tracker) HandleEvent(event data.Event) error {
+	t.lock.Lock()
+	var emitted []data.Event
+	var err error
+	switch e := event.(type) {
+	case *odometer.Event:
+		emitted, err = t.handleOdometerEvent(e)
+	case *StartEvent, *EndEvent:
+	default:
+		if t.current != nil {
+			t.current.EventCounts[event.GetName()]++
+		}
+	}
+	t.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range emitted {
+		for _, handler := range t.handlers {
+			err := handler(e)
+			if err != nil {
+				return fmt.Errorf("handling trip event: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) handleOdometerEvent(e *odometer.Event) ([]data.Event, error) {
+	d := e.GetGnssData()
+	if d == nil {
+		return nil, nil
+	}
+	hasFix := d.Fix != "none" && d.Fix != ""
+	latitude, longitude := d.Latitude, d.Longitude
+	if t.redact != nil {
+		redacted := t.redact(d)
+		latitude, longitude = redacted.Latitude, redacted.Longitude
+	}
+	p := &position{time: e.GetTime(), latitude: latitude, longitude: longitude, lifetime: e.LifetimeDistance}
+
+	if t.current == nil {
+		if !hasFix || d.Speed < t.startSpeed {
+			t.movingCount = 0
+			return nil, nil
+		}
+		t.movingCount++
+		if t.movingCount == 1 {
+			t.movingSince = p
+		}
+		if t.movingCount < t.startCount {
+			return nil, nil
+		}
+
+		t.start(t.movingSince)
+		t.update(p, d)
+		err := t.save(p.time)
+		if err != nil {
+			return nil, err
+		}
+		return []data.Event{NewStartEvent(t.current.clone(), d)}, nil
+	}
+
+	// without fix the speed is unknown: a stop keeps going, but none starts
+	switch {
+	case hasFix && d.Speed < t.stopSpeed:
+		if t.stoppedAt == nil {
+			t.stoppedAt = p
+		}
+	case hasFix:
+		t.stoppedAt = nil
+	}
+
+	if t.stoppedAt != nil && p.time.Sub(t.stoppedAt.time) >= t.stopDuration {
+		trip := t.current
+		t.end(t.stoppedAt)
+		err := t.save(p.time)
+		t.current = nil
+		t.stoppedAt = nil
+		if err != nil {
+			return nil, err
+		}
+		return []data.Event{NewEndEvent(trip, d)}, nil
+	}
+
+	if hasFix {
+		t.update(p, d)
+	}
+	if p.time.Sub(t.lastSaved) >= t.saveInterval {
+		return nil, t.save(p.time)
+	}
+	return nil, nil
+}
+
+func (t *Tracker) start(p *position) {
+	t.current = &Trip{
+		StartTime:      p.time,
+		EndTime:        p.time,
+		StartLatitude:  p.latitude,
+		StartLongitude: p.longitude,
+		EndLatitude:    p.latitude,
+		EndLongitude:   p.longitude,
+		EventCounts:    map[string]int{},
+	}
+	t.startLifetime = p.lifetime
+	t.movingCount = 0
+	t.movingSince = nil
+	t.stoppedAt = nil
+}
+
+func (t *Tracker) update(p *position, d *neom9n.Data) {
+	t.current.EndTime = p.time
+	t.current.EndLatitude = p.latitude
+	t.current.EndLongitude = p.longitude
+	t.current.Distance = p.lifetime - t.startLifetime
+	t.current.Duration = p.time.Sub(t.current.StartTime).Seconds()
+	t.current.MaxSpeed = math.Max(t.current.MaxSpeed, d.Speed)
+}
+
+// end closes the trip where the vehicle stopped.
+func (t *Tracker) end(p *position) {
+	t.current.EndTime = p.time
+	t.current.EndLatitude = p.latitude
+	t.current.EndLongitude = p.longitude
+	t.current.Distance = p.lifetime - t.startLifetime
+	t.current.Duration = p.time.Sub(t.current.StartTime).Seconds()
+	t.current.Ended = true
+}
+
+func (t *Tracker) save(now time.Time) error {
+	if t.store == nil {
+		return nil
+	}
+	t.lastSaved = now
+	err := t.store.Save(t.current)
+	if err != nil {
+		return fmt.Errorf("saving trip: %w", err)
+	}
+	return nil
+}
+
+type StartEvent struct {
+	*data.BaseEvent
+	Trip *Trip `json:"trip"`
+}
+
+func NewStartEvent(trip *Trip, gnssData *neom9n.Data) *StartEvent {
+	return &StartEvent{
+		BaseEvent: data.NewBaseEvent("TRIP_START_EVENT", "TRIP", trip.StartTime, gnssData),
+		Trip:      trip,
+	}
+}
+
+func (e *StartEvent) String() string {
+	return fmt.Sprintf("Trip Start Event at %s", e.Trip.StartTime)
+}
+
+type EndEvent struct {
+	*data.BaseEvent
+	Trip *Trip `json:"trip"`
+}
+
+func NewEndEvent(trip *Trip, gnssData *neom9n.Data) *EndEvent {
+	return &EndEvent{
+		BaseEvent: data.NewBaseEvent("TRIP_END_EVENT", "TRIP", trip.EndTime, gnssData),
+		Trip:      trip,
+	}
+}
+
+func (e *EndEvent) String() string {
+	return fmt.Sprintf("Trip End Event after %.0fm in %.0fs", e.Trip.Distance, e.Trip.Duration)
+}
@@ -0,0 +1,234 @@
+package trip
+
+import (
+	"math"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/geo"
+	"github.com/streamingfast/hivemapper-data-logger/data/odometer"
+	"github.com/streamingfast/hivemapper-data-logger/data/privacy"
+	"github.com/streamingfast/hivemapper-data-logger/logger"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+// epoch is the odometer event at `seconds`, moving north at speed since
+// `distance` meters.
+func epoch(seconds int, speed float64, distance float64, fix string) *odometer.Event {
+	d := &neom9n.Data{
+		Fix:       fix,
+		Latitude:  45.5 + distance/111000,
+		Longitude: -73.4,
+		Speed:     speed,
+	}
+	return odometer.NewEvent(0, 1000+distance, odometer.SourceGnss, start.Add(time.Duration(seconds)*time.Second), d)
+}
+
+// drive returns the epochs of a drive, one per second, at the speeds of
+// the segments.
+func drive(segments ...[2]float64) []*odometer.Event {
+	var epochs []*odometer.Event
+	distance := 0.0
+	seconds := 0
+	for _, s := range segments {
+		for i := 0; i < int(s[0]); i++ {
+			epochs = append(epochs, epoch(seconds, s[1], distance, "3D"))
+			distance += s[1]
+			seconds++
+		}
+	}
+	return epochs
+}
+
+type memoryStore struct {
+	trips map[time.Time]*Trip
+	ended int
+}
+
+func (s *memoryStore) Save(trip *Trip) error {
+	s.trips[trip.StartTime] = trip.clone()
+	return nil
+}
+
+func (s *memoryStore) EndOpenTrips() error {
+	s.ended++
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	tests := []struct {
+		name          string
+		epochs        []*odometer.Event
+		expectedTrips []*Trip
+		expectCurrent bool
+	}{
+		{
+			name:   "parked",
+			epochs: drive([2]float64{600, 0}),
+		},
+		{
+			name:   "moving too shortly",
+			epochs: drive([2]float64{10, 0}, [2]float64{2, 5}, [2]float64{400, 0}),
+		},
+		{
+			name:   "trip ended by a stop",
+			epochs: drive([2]float64{10, 0}, [2]float64{60, 10}, [2]float64{30, 20}, [2]float64{301, 0}),
+			expectedTrips: []*Trip{{
+				StartTime:      start.Add(10 * time.Second),
+				EndTime:        start.Add(100 * time.Second),
+				StartLatitude:  45.5,
+				StartLongitude: -73.4,
+				EndLatitude:    45.5 + 1200/111000.0,
+				EndLongitude:   -73.4,
+				Distance:       1200,
+				Duration:       90,
+				MaxSpeed:       20,
+				EventCounts:    map[string]int{"LEFT_TURN_EVENT": 1},
+				Ended:          true,
+			}},
+		},
+		{
+			name:   "short stop does not end the trip",
+			epochs: drive([2]float64{60, 10}, [2]float64{120, 0}, [2]float64{60, 10}),
+			expectedTrips: []*Trip{{
+				StartTime:      start,
+				EndTime:        start.Add(239 * time.Second),
+				StartLatitude:  45.5,
+				StartLongitude: -73.4,
+				EndLatitude:    45.5 + 1190/111000.0,
+				EndLongitude:   -73.4,
+				Distance:       1190,
+				Duration:       239,
+				MaxSpeed:       10,
+				EventCounts:    map[string]int{"LEFT_TURN_EVENT": 1},
+			}},
+			expectCurrent: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &memoryStore{trips: map[time.Time]*Trip{}}
+			var events []string
+			tracker, err := NewTracker([]EventHandler{func(event data.Event) error {
+				events = append(events, event.GetName())
+				return nil
+			}}, WithStore(store, 30*time.Second))
+			require.NoError(t, err)
+			require.Equal(t, 1, store.ended)
+
+			for i, e := range test.epochs {
+				require.NoError(t, tracker.HandleEvent(e))
+				if i == 30 {
+					turn := data.NewBaseEvent("LEFT_TURN_EVENT", "DIRECTION_CHANGE", e.GetTime(), nil)
+					require.NoError(t, tracker.HandleEvent(turn))
+				}
+			}
+
+			// the trip in progress is only saved periodically
+			var trips []*Trip
+			if current := tracker.Current(); current != nil {
+				require.True(t, test.expectCurrent)
+				require.Contains(t, store.trips, current.StartTime)
+				trips = append(trips, current)
+				require.Equal(t, []string{"TRIP_START_EVENT"}, events)
+			} else {
+				for _, trip := range store.trips {
+					trips = append(trips, trip)
+				}
+				if len(trips) > 0 {
+					require.Equal(t, []string{"TRIP_START_EVENT", "TRIP_END_EVENT"}, events)
+				}
+			}
+
+			for _, trip := range append(trips, test.expectedTrips...) {
+				trip.EndLatitude = math.Round(trip.EndLatitude*1e9) / 1e9
+			}
+			require.Equal(t, test.expectedTrips, trips)
+		})
+	}
+}
+
+func TestTracker_NoFixKeepsStopping(t *testing.T) {
+	tracker, err := NewTracker(nil, WithStop(1, time.Minute))
+	require.NoError(t, err)
+
+	epochs := drive([2]float64{30, 10}, [2]float64{10, 0})
+	for i := 0; i < 60; i++ {
+		epochs = append(epochs, epoch(40+i, 0, 300, "none"))
+	}
+	for _, e := range epochs {
+		require.NoError(t, tracker.HandleEvent(e))
+	}
+	require.Nil(t, tracker.Current(), "the stop started before losing the fix ends the trip")
+}
+
+func TestSqlStore(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "trips.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	store := NewSqlStore(sqlite)
+
+	first := &Trip{StartTime: start, EndTime: start.Add(time.Minute), Distance: 500, EventCounts: map[string]int{}, Ended: true}
+	second := &Trip{StartTime: start.Add(time.Hour), EndTime: start.Add(time.Hour), EventCounts: map[string]int{}}
+	require.NoError(t, store.Save(first))
+	require.NoError(t, store.Save(second))
+
+	second.EndTime = start.Add(time.Hour + 10*time.Minute)
+	second.Distance = 4000
+	second.MaxSpeed = 22.5
+	second.EventCounts["STOP_END_EVENT"] = 2
+	require.NoError(t, store.Save(second))
+	require.NoError(t, store.EndOpenTrips())
+
+	trips, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, trips, 2)
+
+	second.ID = 2
+	second.Ended = true
+	first.ID = 1
+	for _, trip := range trips {
+		trip.StartTime = trip.StartTime.UTC()
+		trip.EndTime = trip.EndTime.UTC()
+	}
+	require.Equal(t, []*Trip{second, first}, trips)
+
+	trip, err := store.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, first.Distance, trip.Distance)
+
+	trip, err = store.Get(3)
+	require.NoError(t, err)
+	require.Nil(t, trip)
+}
+
+func TestTracker_Redaction(t *testing.T) {
+	sqlite := logger.NewSqlite(path.Join(t.TempDir(), "trips.db"), []logger.CreateTableQueryFunc{CreateTableQuery}, nil)
+	require.NoError(t, sqlite.Init(0))
+	store := NewSqlStore(sqlite)
+
+	// the trip starts at home, leaving it northward
+	redactor, err := privacy.NewRedactor([]*privacy.Zone{{ID: "home", Center: geo.NewCoordinate(-73.4, 45.5), Radius: 300}})
+	require.NoError(t, err)
+	tracker, err := NewTracker(nil, WithStartSpeed(5, 1), WithStop(1, 10*time.Second), WithStore(store, time.Minute), WithRedaction(redactor.RedactFix))
+	require.NoError(t, err)
+
+	for _, e := range drive([2]float64{60, 10}, [2]float64{20, 0}) {
+		require.NoError(t, redactor.HandleGnssData(e.GetGnssData()))
+		require.NoError(t, tracker.HandleEvent(e))
+	}
+
+	trips, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, trips, 1)
+	require.True(t, trips[0].Ended)
+	require.Equal(t, 0.0, trips[0].StartLatitude)
+	require.Equal(t, 0.0, trips[0].StartLongitude)
+	require.InDelta(t, 45.5+600.0/111000, trips[0].EndLatitude, 1e-6)
+	require.Equal(t, -73.4, trips[0].EndLongitude)
+}
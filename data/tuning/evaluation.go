@@ -0,0 +1,141 @@
+package tuning
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/streamingfast/hivemapper-data-logger/data/direction"
+)
+
+type DetectedEvent struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// EventCollector keeps the completed events emitted by the direction feed.
+// The *_DETECTED_EVENT are ignored since they are always followed by their
+// completed counterpart.
+type EventCollector struct {
+	Events []*DetectedEvent
+}
+
+func NewEventCollector() *EventCollector {
+	return &EventCollector{}
+}
+
+func (c *EventCollector) HandleDirectionEvent(event data.Event) error {
+	if strings.Contains(event.GetName(), "DETECTED") {
+		return nil
+	}
+
+	end := event.GetTime()
+	start := end.Add(-direction.Duration(event))
+	c.Events = append(c.Events, &DetectedEvent{
+		Name:  event.GetName(),
+		Start: start,
+		End:   end,
+	})
+	return nil
+}
+
+type Score struct {
+	Name           string  `json:"name"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+func (s *Score) String() string {
+	return fmt.Sprintf("%-22s tp=%-4d fp=%-4d fn=%-4d precision=%.3f recall=%.3f f1=%.3f", s.Name, s.TruePositives, s.FalsePositives, s.FalseNegatives, s.Precision, s.Recall, s.F1)
+}
+
+func (s *Score) compute() {
+	if s.TruePositives+s.FalsePositives > 0 {
+		s.Precision = float64(s.TruePositives) / float64(s.TruePositives+s.FalsePositives)
+	}
+	if s.TruePositives+s.FalseNegatives > 0 {
+		s.Recall = float64(s.TruePositives) / float64(s.TruePositives+s.FalseNegatives)
+	}
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+}
+
+// Evaluate matches the detected events against the labels. A detected event
+// matches a label of the same name when their time ranges overlap, the label
+// range being widened by tolerance on both ends. Each label matches at most
+// one event. Only the event names present in the labels are scored.
+func Evaluate(labels []*Label, events []*DetectedEvent, tolerance time.Duration) []*Score {
+	scores := map[string]*Score{}
+	for _, label := range labels {
+		if _, found := scores[label.Name]; !found {
+			scores[label.Name] = &Score{Name: label.Name}
+		}
+	}
+
+	matched := make([]bool, len(events))
+	for _, label := range labels {
+		score := scores[label.Name]
+		start := label.Start.Add(-tolerance)
+		end := label.End.Add(tolerance)
+
+		found := false
+		for i, event := range events {
+			if matched[i] || event.Name != label.Name {
+				continue
+			}
+			if event.End.Before(start) || event.Start.After(end) {
+				continue
+			}
+			matched[i] = true
+			found = true
+			break
+		}
+
+		if found {
+			score.TruePositives++
+		} else {
+			score.FalseNegatives++
+		}
+	}
+
+	for i, event := range events {
+		if matched[i] {
+			continue
+		}
+		if score, found := scores[event.Name]; found {
+			score.FalsePositives++
+		}
+	}
+
+	var out []*Score
+	for _, score := range scores {
+		score.compute()
+		out = append(out, score)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// MeanF1 is the macro average of the F1 score of every event name.
+func MeanF1(scores []*Score) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, score := range scores {
+		sum += score.F1
+	}
+	return sum / float64(len(scores))
+}
@@ -0,0 +1,98 @@
+package tuning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Evaluate(t *testing.T) {
+	t0 := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time {
+		return t0.Add(time.Duration(s) * time.Second)
+	}
+
+	labels := []*Label{
+		{Name: "LEFT_TURN_EVENT", Start: at(10), End: at(15)},
+		{Name: "LEFT_TURN_EVENT", Start: at(100), End: at(105)},
+		{Name: "STOP_END_EVENT", Start: at(200), End: at(230)},
+	}
+
+	tests := []struct {
+		name           string
+		events         []*DetectedEvent
+		expectedScores map[string][3]int // tp, fp, fn
+	}{
+		{
+			name: "all labels detected",
+			events: []*DetectedEvent{
+				{Name: "LEFT_TURN_EVENT", Start: at(11), End: at(14)},
+				{Name: "LEFT_TURN_EVENT", Start: at(101), End: at(106)},
+				{Name: "STOP_END_EVENT", Start: at(199), End: at(231)},
+			},
+			expectedScores: map[string][3]int{
+				"LEFT_TURN_EVENT": {2, 0, 0},
+				"STOP_END_EVENT":  {1, 0, 0},
+			},
+		},
+		{
+			name: "within tolerance",
+			events: []*DetectedEvent{
+				{Name: "LEFT_TURN_EVENT", Start: at(16), End: at(17)},
+			},
+			expectedScores: map[string][3]int{
+				"LEFT_TURN_EVENT": {1, 0, 1},
+				"STOP_END_EVENT":  {0, 0, 1},
+			},
+		},
+		{
+			name: "wrong name, out of range and duplicate",
+			events: []*DetectedEvent{
+				{Name: "RIGHT_TURN_EVENT", Start: at(10), End: at(15)},
+				{Name: "LEFT_TURN_EVENT", Start: at(50), End: at(55)},
+				{Name: "LEFT_TURN_EVENT", Start: at(100), End: at(102)},
+				{Name: "LEFT_TURN_EVENT", Start: at(103), End: at(105)},
+			},
+			expectedScores: map[string][3]int{
+				"LEFT_TURN_EVENT": {1, 2, 1},
+				"STOP_END_EVENT":  {0, 0, 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scores := Evaluate(labels, test.events, 2*time.Second)
+			require.Len(t, scores, len(test.expectedScores))
+			for _, score := range scores {
+				expected := test.expectedScores[score.Name]
+				require.Equal(t, expected, [3]int{score.TruePositives, score.FalsePositives, score.FalseNegatives}, score.Name)
+			}
+		})
+	}
+}
+
+func Test_GridConfigs(t *testing.T) {
+	base := imu.DefaultConfig()
+	grid := Grid{
+		"left_turn_threshold":     {0.1, 0.2, 0.3},
+		"continuous_count_window": {40, 60},
+	}
+
+	configs, err := grid.Configs(base)
+	require.NoError(t, err)
+	require.Len(t, configs, 6)
+	require.Equal(t, 40, configs[0].TurnContinuousCountWindow)
+	require.Equal(t, 0.1, configs[0].LeftTurnThreshold)
+	require.Equal(t, 60, configs[5].TurnContinuousCountWindow)
+	require.Equal(t, 0.3, configs[5].LeftTurnThreshold)
+	require.Equal(t, base.RightTurnThreshold, configs[5].RightTurnThreshold)
+
+	_, err = Grid{"unknown_field": {1}}.Configs(base)
+	require.Error(t, err)
+
+	_, err = Grid{"continuous_count_window": {1.5}}.Configs(base)
+	require.Error(t, err)
+}
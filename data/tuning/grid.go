@@ -0,0 +1,110 @@
+package tuning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/streamingfast/hivemapper-data-logger/data/imu"
+)
+
+// Grid maps an imu.Config json field name (ex: left_turn_threshold) to the
+// values to try for that field. Fields not present in the grid keep the value
+// of the base config.
+type Grid map[string][]float64
+
+func LoadGrid(filename string) (Grid, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading grid file %q: %w", filename, err)
+	}
+
+	grid := Grid{}
+	err = json.Unmarshal(content, &grid)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling grid file %q: %w", filename, err)
+	}
+
+	return grid, nil
+}
+
+// DefaultGrid varies the g-force thresholds of the base config by +/- 25%.
+func DefaultGrid(base *imu.Config) Grid {
+	spread := func(v float64) []float64 {
+		return []float64{v * 0.75, v, v * 1.25}
+	}
+
+	return Grid{
+		"left_turn_threshold":           spread(base.LeftTurnThreshold),
+		"right_turn_threshold":          spread(base.RightTurnThreshold),
+		"g_force_accelerator_threshold": spread(base.GForceAcceleratorThreshold),
+		"g_force_decelerator_threshold": spread(base.GForceDeceleratorThreshold),
+	}
+}
+
+// Configs returns one config for each combination of the grid values applied
+// on top of the base config.
+func (g Grid) Configs(base *imu.Config) ([]*imu.Config, error) {
+	baseJson, err := json.Marshal(base)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling base config: %w", err)
+	}
+
+	baseFields := map[string]any{}
+	err = json.Unmarshal(baseJson, &baseFields)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling base config: %w", err)
+	}
+
+	var fieldNames []string
+	for name, values := range g {
+		if _, found := baseFields[name]; !found {
+			return nil, fmt.Errorf("unknown config field %q", name)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no values for config field %q", name)
+		}
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+
+	var configs []*imu.Config
+	indexes := make([]int, len(fieldNames))
+	for {
+		fields := map[string]any{}
+		for k, v := range baseFields {
+			fields[k] = v
+		}
+		for i, name := range fieldNames {
+			fields[name] = g[name][indexes[i]]
+		}
+
+		fieldsJson, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling config fields: %w", err)
+		}
+
+		conf := &imu.Config{}
+		err = json.Unmarshal(fieldsJson, conf)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling config fields %s: %w", string(fieldsJson), err)
+		}
+		configs = append(configs, conf)
+
+		// increment the indexes like an odometer, the last field turning the fastest
+		i := len(indexes) - 1
+		for ; i >= 0; i-- {
+			indexes[i]++
+			if indexes[i] < len(g[fieldNames[i]]) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+
+	return configs, nil
+}
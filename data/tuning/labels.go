@@ -0,0 +1,45 @@
+package tuning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Label is a ground-truth event observed during a recorded drive. Name must
+// match the name of the event emitted by the direction feed (ex: LEFT_TURN_EVENT).
+type Label struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func LoadLabels(filename string) ([]*Label, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading labels file %q: %w", filename, err)
+	}
+
+	var labels []*Label
+	err = json.Unmarshal(content, &labels)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling labels file %q: %w", filename, err)
+	}
+
+	for i, label := range labels {
+		if label.Name == "" {
+			return nil, fmt.Errorf("label %d: missing name", i)
+		}
+		if label.End.Before(label.Start) {
+			return nil, fmt.Errorf("label %d (%s): end %s is before start %s", i, label.Name, label.End, label.Start)
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Start.Before(labels[j].Start)
+	})
+
+	return labels, nil
+}
@@ -0,0 +1,194 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: proto/sf/replay/v1/replay.proto
+
+package replayv1connect
+
+import (
+	context "context"
+	errors "errors"
+	connect_go "github.com/bufbuild/connect-go"
+	v1 "github.com/streamingfast/hivemapper-data-logger/gen/proto/sf/replay/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect_go.IsAtLeastVersion0_1_0
+
+const (
+	// ReplayServiceName is the fully-qualified name of the ReplayService service.
+	ReplayServiceName = "sf.replay.v1.ReplayService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// ReplayServicePauseProcedure is the fully-qualified name of the ReplayService's Pause RPC.
+	ReplayServicePauseProcedure = "/sf.replay.v1.ReplayService/Pause"
+	// ReplayServiceResumeProcedure is the fully-qualified name of the ReplayService's Resume RPC.
+	ReplayServiceResumeProcedure = "/sf.replay.v1.ReplayService/Resume"
+	// ReplayServiceSeekProcedure is the fully-qualified name of the ReplayService's Seek RPC.
+	ReplayServiceSeekProcedure = "/sf.replay.v1.ReplayService/Seek"
+	// ReplayServiceSetSpeedProcedure is the fully-qualified name of the ReplayService's SetSpeed RPC.
+	ReplayServiceSetSpeedProcedure = "/sf.replay.v1.ReplayService/SetSpeed"
+	// ReplayServiceStatusProcedure is the fully-qualified name of the ReplayService's Status RPC.
+	ReplayServiceStatusProcedure = "/sf.replay.v1.ReplayService/Status"
+)
+
+// ReplayServiceClient is a client for the sf.replay.v1.ReplayService service.
+type ReplayServiceClient interface {
+	Pause(context.Context, *connect_go.Request[v1.PauseRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	Resume(context.Context, *connect_go.Request[v1.ResumeRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	Seek(context.Context, *connect_go.Request[v1.SeekRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	SetSpeed(context.Context, *connect_go.Request[v1.SetSpeedRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	Status(context.Context, *connect_go.Request[v1.StatusRequest]) (*connect_go.Response[v1.StatusResponse], error)
+}
+
+// NewReplayServiceClient constructs a client for the sf.replay.v1.ReplayService service. By
+// default, it uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses,
+// and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the
+// connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewReplayServiceClient(httpClient connect_go.HTTPClient, baseURL string, opts ...connect_go.ClientOption) ReplayServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &replayServiceClient{
+		pause: connect_go.NewClient[v1.PauseRequest, v1.StatusResponse](
+			httpClient,
+			baseURL+ReplayServicePauseProcedure,
+			opts...,
+		),
+		resume: connect_go.NewClient[v1.ResumeRequest, v1.StatusResponse](
+			httpClient,
+			baseURL+ReplayServiceResumeProcedure,
+			opts...,
+		),
+		seek: connect_go.NewClient[v1.SeekRequest, v1.StatusResponse](
+			httpClient,
+			baseURL+ReplayServiceSeekProcedure,
+			opts...,
+		),
+		setSpeed: connect_go.NewClient[v1.SetSpeedRequest, v1.StatusResponse](
+			httpClient,
+			baseURL+ReplayServiceSetSpeedProcedure,
+			opts...,
+		),
+		status: connect_go.NewClient[v1.StatusRequest, v1.StatusResponse](
+			httpClient,
+			baseURL+ReplayServiceStatusProcedure,
+			opts...,
+		),
+	}
+}
+
+// replayServiceClient implements ReplayServiceClient.
+type replayServiceClient struct {
+	pause    *connect_go.Client[v1.PauseRequest, v1.StatusResponse]
+	resume   *connect_go.Client[v1.ResumeRequest, v1.StatusResponse]
+	seek     *connect_go.Client[v1.SeekRequest, v1.StatusResponse]
+	setSpeed *connect_go.Client[v1.SetSpeedRequest, v1.StatusResponse]
+	status   *connect_go.Client[v1.StatusRequest, v1.StatusResponse]
+}
+
+// Pause calls sf.replay.v1.ReplayService.Pause.
+func (c *replayServiceClient) Pause(ctx context.Context, req *connect_go.Request[v1.PauseRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return c.pause.CallUnary(ctx, req)
+}
+
+// Resume calls sf.replay.v1.ReplayService.Resume.
+func (c *replayServiceClient) Resume(ctx context.Context, req *connect_go.Request[v1.ResumeRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return c.resume.CallUnary(ctx, req)
+}
+
+// Seek calls sf.replay.v1.ReplayService.Seek.
+func (c *replayServiceClient) Seek(ctx context.Context, req *connect_go.Request[v1.SeekRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return c.seek.CallUnary(ctx, req)
+}
+
+// SetSpeed calls sf.replay.v1.ReplayService.SetSpeed.
+func (c *replayServiceClient) SetSpeed(ctx context.Context, req *connect_go.Request[v1.SetSpeedRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return c.setSpeed.CallUnary(ctx, req)
+}
+
+// Status calls sf.replay.v1.ReplayService.Status.
+func (c *replayServiceClient) Status(ctx context.Context, req *connect_go.Request[v1.StatusRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return c.status.CallUnary(ctx, req)
+}
+
+// ReplayServiceHandler is an implementation of the sf.replay.v1.ReplayService service.
+type ReplayServiceHandler interface {
+	Pause(context.Context, *connect_go.Request[v1.PauseRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	Resume(context.Context, *connect_go.Request[v1.ResumeRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	Seek(context.Context, *connect_go.Request[v1.SeekRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	SetSpeed(context.Context, *connect_go.Request[v1.SetSpeedRequest]) (*connect_go.Response[v1.StatusResponse], error)
+	Status(context.Context, *connect_go.Request[v1.StatusRequest]) (*connect_go.Response[v1.StatusResponse], error)
+}
+
+// NewReplayServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewReplayServiceHandler(svc ReplayServiceHandler, opts ...connect_go.HandlerOption) (string, http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle(ReplayServicePauseProcedure, connect_go.NewUnaryHandler(
+		ReplayServicePauseProcedure,
+		svc.Pause,
+		opts...,
+	))
+	mux.Handle(ReplayServiceResumeProcedure, connect_go.NewUnaryHandler(
+		ReplayServiceResumeProcedure,
+		svc.Resume,
+		opts...,
+	))
+	mux.Handle(ReplayServiceSeekProcedure, connect_go.NewUnaryHandler(
+		ReplayServiceSeekProcedure,
+		svc.Seek,
+		opts...,
+	))
+	mux.Handle(ReplayServiceSetSpeedProcedure, connect_go.NewUnaryHandler(
+		ReplayServiceSetSpeedProcedure,
+		svc.SetSpeed,
+		opts...,
+	))
+	mux.Handle(ReplayServiceStatusProcedure, connect_go.NewUnaryHandler(
+		ReplayServiceStatusProcedure,
+		svc.Status,
+		opts...,
+	))
+	return "/sf.replay.v1.ReplayService/", mux
+}
+
+// UnimplementedReplayServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedReplayServiceHandler struct{}
+
+func (UnimplementedReplayServiceHandler) Pause(context.Context, *connect_go.Request[v1.PauseRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.replay.v1.ReplayService.Pause is not implemented"))
+}
+
+func (UnimplementedReplayServiceHandler) Resume(context.Context, *connect_go.Request[v1.ResumeRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.replay.v1.ReplayService.Resume is not implemented"))
+}
+
+func (UnimplementedReplayServiceHandler) Seek(context.Context, *connect_go.Request[v1.SeekRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.replay.v1.ReplayService.Seek is not implemented"))
+}
+
+func (UnimplementedReplayServiceHandler) SetSpeed(context.Context, *connect_go.Request[v1.SetSpeedRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.replay.v1.ReplayService.SetSpeed is not implemented"))
+}
+
+func (UnimplementedReplayServiceHandler) Status(context.Context, *connect_go.Request[v1.StatusRequest]) (*connect_go.Response[v1.StatusResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("sf.replay.v1.ReplayService.Status is not implemented"))
+}
@@ -11,6 +11,7 @@ replace github.com/daedaleanai/ublox => github.com/streamingfast/ublox v0.0.0-20
 
 require (
 	github.com/bufbuild/connect-go v1.8.0
+	github.com/daedaleanai/ublox v0.0.0-00010101000000-000000000000
 	github.com/fsnotify/fsnotify v1.6.0
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/handlers v1.5.1
@@ -29,7 +30,6 @@ require (
 )
 
 require (
-	github.com/daedaleanai/ublox v0.0.0-00010101000000-000000000000 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/felixge/httpsnoop v1.0.1 // indirect
@@ -24,7 +24,8 @@ type Sqlite struct {
 	purgeQueryFuncList       []PurgeQueryFunc
 	createTableQueryFuncList []CreateTableQueryFunc
 
-	logs chan Sqlable
+	logs    chan Sqlable
+	flushes chan chan struct{}
 }
 
 func NewSqlite(file string, createTableQueryFuncList []CreateTableQueryFunc, purgeQueryFuncList []PurgeQueryFunc) *Sqlite {
@@ -33,6 +34,7 @@ func NewSqlite(file string, createTableQueryFuncList []CreateTableQueryFunc, pur
 		createTableQueryFuncList: createTableQueryFuncList,
 		purgeQueryFuncList:       purgeQueryFuncList,
 		logs:                     make(chan Sqlable, 1000),
+		flushes:                  make(chan chan struct{}),
 	}
 }
 
@@ -44,6 +46,10 @@ func (s *Sqlite) Init(logTTL time.Duration) error {
 		return fmt.Errorf("opening database: %s", err.Error())
 	}
 
+	if err := renameLegacyTables(db); err != nil {
+		return fmt.Errorf("renaming legacy tables: %w", err)
+	}
+
 	for _, createQuery := range s.createTableQueryFuncList {
 		if _, err := db.Exec(createQuery()); err != nil {
 			return fmt.Errorf("creating table: %s", err.Error())
@@ -66,47 +72,76 @@ func (s *Sqlite) Init(logTTL time.Duration) error {
 
 	go func() {
 		type Accumulator struct {
+			query           string
 			count           int
 			cumulatedParams []any
 			cumulatedFields string
 		}
+		// the accumulated logs are all inserted together, in the order their
+		// queries were first logged, so the rows referencing others, like the
+		// imu rows their gnss fix, are not inserted before them
 		queries := map[string]*Accumulator{}
-		for {
-			log := <-s.logs
+		var accumulators []*Accumulator
+		insert := func() {
+			for _, accumulator := range accumulators {
+				accumulator.cumulatedFields = accumulator.cumulatedFields[0 : len(accumulator.cumulatedFields)-1] //remove last comma
+				stmt, err := db.Prepare(accumulator.query + accumulator.cumulatedFields)
+				if err != nil {
+					panic(fmt.Errorf("preparing statement for inserting Data: %w", err))
+				}
+				s.lock.Lock()
+				start := time.Now()
+				fmt.Println("inserting accumulated data")
+				_, err = stmt.Exec(accumulator.cumulatedParams...)
+				fmt.Println("insertion done in:", time.Since(start).String())
+				s.lock.Unlock()
+				stmt.Close()
+				if err != nil {
+					panic(fmt.Errorf("inserting Data: %s", err.Error()))
+				}
+			}
+			queries = map[string]*Accumulator{}
+			accumulators = nil
+		}
+		accumulate := func(log Sqlable) {
 			query, fields, params := log.InsertQuery()
 
 			if query == "" {
-				continue
+				return
 			}
 
 			accumulator, found := queries[query]
 			if !found {
-				accumulator = &Accumulator{}
+				accumulator = &Accumulator{query: query}
 				queries[query] = accumulator
+				accumulators = append(accumulators, accumulator)
 			}
 			accumulator.count++
 			accumulator.cumulatedFields += fields
 			accumulator.cumulatedParams = append(accumulator.cumulatedParams, params...)
 
-			if accumulator.count < 100 {
-				continue
+			if accumulator.count >= 100 {
+				insert()
 			}
+		}
 
-			accumulator.cumulatedFields = accumulator.cumulatedFields[0 : len(accumulator.cumulatedFields)-1] //remove last comma
-			stmt, err := db.Prepare(query + accumulator.cumulatedFields)
-			if err != nil {
-				panic(fmt.Errorf("preparing statement for inserting Data: %w", err))
-			}
-			s.lock.Lock()
-			start := time.Now()
-			fmt.Println("inserting accumulated data")
-			_, err = stmt.Exec(accumulator.cumulatedParams...)
-			fmt.Println("insertion done in:", time.Since(start).String())
-			s.lock.Unlock()
-			if err != nil {
-				panic(fmt.Errorf("inserting Data: %s", err.Error()))
+		for {
+			select {
+			case log := <-s.logs:
+				accumulate(log)
+			case done := <-s.flushes:
+				// the logs sent before the flush are inserted too
+				for drained := false; !drained; {
+					select {
+					case log := <-s.logs:
+						accumulate(log)
+					default:
+						drained = true
+					}
+				}
+				insert()
+				close(done)
 			}
-			delete(queries, query)
 		}
 	}()
 
@@ -115,6 +150,72 @@ func (s *Sqlite) Init(logTTL time.Duration) error {
 	return nil
 }
 
+// legacyTables are the wide imu tables of the databases logged before the gnss
+// table, replaced by views of the same name. They are renamed for the views to
+// be created, their rows being purged with the ttl until they are dropped.
+var legacyTables = map[string]string{
+	"merged":  "merged_v1",
+	"imu_raw": "imu_raw_v1",
+}
+
+func renameLegacyTables(db *sql.DB) error {
+	for name, legacyName := range legacyTables {
+		found, err := tableExists(db, name)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		fmt.Printf("renaming legacy table %s to %s\n", name, legacyName)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", name, legacyName)); err != nil {
+			return fmt.Errorf("renaming table %s to %s: %w", name, legacyName, err)
+		}
+	}
+	return nil
+}
+
+// purgeLegacyTables purges the renamed legacy tables older than t, dropping
+// them once empty.
+func purgeLegacyTables(db *sql.DB, t time.Time) error {
+	for _, legacyName := range legacyTables {
+		found, err := tableExists(db, legacyName)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE imu_time < ?", legacyName), t); err != nil {
+			return fmt.Errorf("purging table %s: %w", legacyName, err)
+		}
+		var empty bool
+		if err := db.QueryRow(fmt.Sprintf("select count(*) = 0 from %s", legacyName)).Scan(&empty); err != nil {
+			return fmt.Errorf("counting rows of table %s: %w", legacyName, err)
+		}
+		if !empty {
+			continue
+		}
+
+		fmt.Println("dropping purged legacy table:", legacyName)
+		if _, err := db.Exec(fmt.Sprintf("DROP TABLE %s", legacyName)); err != nil {
+			return fmt.Errorf("dropping table %s: %w", legacyName, err)
+		}
+	}
+	return nil
+}
+
+func tableExists(db *sql.DB, name string) (bool, error) {
+	var found bool
+	err := db.QueryRow("select count(*) > 0 from sqlite_master where type = 'table' and name = ?", name).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("looking up table %s: %w", name, err)
+	}
+	return found, nil
+}
+
 func (s *Sqlite) Clone() (string, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -158,24 +259,70 @@ func (s *Sqlite) Clone() (string, error) {
 	return cloneFilename, nil
 }
 
+const rawMergedDataQuery = `
+	SELECT
+		m.imu_time,
+		m.imu_magnitude,
+		m.imu_acc_x,
+		m.imu_tilt_angle_x,
+		m.imu_acc_y,
+		m.imu_tilt_angle_y,
+		m.imu_acc_z,
+		m.imu_tilt_angle_z,
+		m.imu_temperature,
+		g.system_time,
+		g.time,
+		g.fix,
+		g.ttff,
+		g.latitude,
+		g.longitude,
+		g.altitude,
+		g.speed,
+		g.heading,
+		g.satellites_seen,
+		g.satellites_used,
+		g.eph,
+		g.horizontal_accuracy,
+		g.vertical_accuracy,
+		g.heading_accuracy,
+		g.speed_accuracy,
+		g.dop_h,
+		g.dop_v,
+		g.dop_x,
+		g.dop_y,
+		g.dop_t,
+		g.dop_p,
+		g.dop_g,
+		g.rf_jamming_state,
+		g.rf_ant_status,
+		g.rf_ant_power,
+		g.rf_post_status,
+		g.rf_noise_per_ms,
+		g.rf_agc_cnt,
+		g.rf_jam_ind,
+		g.rf_ofs_i,
+		g.rf_mag_i,
+		g.rf_ofs_q
+	FROM merged_samples m
+	JOIN gnss g ON g.id = m.gnss_id
+	WHERE m.imu_time > ? AND m.imu_time < ?
+	ORDER BY m.imu_time ASC, m.id ASC
+`
+
+// FetchRawMergedData reads the merged rows between from and to, joined with
+// their gnss fix.
 func (s *Sqlite) FetchRawMergedData(from string, to string, includeImu bool, includeGnss bool) ([]*JsonDataWrapper, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	rows, err := s.DB.Query("SELECT * FROM merged WHERE imu_time > ? AND imu_time < ?", from, to)
-	if err != nil {
-		return nil, fmt.Errorf("querying last position: %s", err.Error())
-	}
-
+	rows, err := s.DB.Query(rawMergedDataQuery, from, to)
 	if err != nil {
-		return nil, fmt.Errorf("querying last position: %s", err.Error())
+		return nil, fmt.Errorf("querying raw merged data: %w", err)
 	}
 	defer rows.Close()
 
 	var jsonData []*JsonDataWrapper
-
 	for rows.Next() {
-		id := 0
 		imuTime := time.Time{}
 		temperature := iim42652.NewTemperature(0.0)
 		acceleration := &iim42652.Acceleration{}
@@ -191,9 +338,7 @@ func (s *Sqlite) FetchRawMergedData(from string, to string, includeImu bool, inc
 			Y: 0,
 			Z: 0,
 		}
-		var _camOrientation *imu.Orientation // read the data, but do not use it in the json writer, not useful as of now
 		err := rows.Scan(
-			&id,
 			&imuTime,
 			&acceleration.TotalMagnitude,
 			&acceleration.X,
@@ -203,7 +348,6 @@ func (s *Sqlite) FetchRawMergedData(from string, to string, includeImu bool, inc
 			&acceleration.Z,
 			&gyro.Z,
 			&temperature,
-			&_camOrientation,
 			&gnssData.SystemTime,
 			&gnssData.Timestamp,
 			&gnssData.Fix,
@@ -238,6 +382,9 @@ func (s *Sqlite) FetchRawMergedData(from string, to string, includeImu bool, inc
 			&gnssData.RF.MagI,
 			&gnssData.RF.OfsQ,
 		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning raw merged data: %w", err)
+		}
 
 		jsonDataWrapper := NewJsonDataWrapper(nil, nil, nil, gyro)
 
@@ -251,10 +398,10 @@ func (s *Sqlite) FetchRawMergedData(from string, to string, includeImu bool, inc
 		}
 
 		jsonData = append(jsonData, jsonDataWrapper)
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("scanning last position: %s", err.Error())
-		}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating raw merged data: %w", err)
 	}
 
 	return jsonData, nil
@@ -279,7 +426,7 @@ func (s *Sqlite) Purge(ttl time.Duration) error {
 		}
 	}
 
-	return nil
+	return purgeLegacyTables(s.DB, t)
 }
 
 func (s *Sqlite) Log(data Sqlable) error {
@@ -287,6 +434,14 @@ func (s *Sqlite) Log(data Sqlable) error {
 	return nil
 }
 
+// Flush inserts the logs not accumulated enough to be inserted yet, like on
+// shutdown.
+func (s *Sqlite) Flush() {
+	done := make(chan struct{})
+	s.flushes <- done
+	<-done
+}
+
 func (s *Sqlite) SingleRowQuery(sql string, handleRow func(row *sql.Rows) error, params ...any) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -330,3 +485,45 @@ func (s *Sqlite) Query(debugLogQuery bool, sql string, handleRow func(row *sql.R
 
 	return nil
 }
+
+func (s *Sqlite) Exec(query string, params ...any) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.DB.Exec(query, params...)
+	if err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
+	return nil
+}
+
+// ExecBatch executes query once per params, in a single transaction.
+func (s *Sqlite) ExecBatch(query string, params [][]any) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing query: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range params {
+		_, err := stmt.Exec(p...)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("executing query: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package webconnect
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/streamingfast/hivemapper-data-logger/data/replay"
+	replayv1 "github.com/streamingfast/hivemapper-data-logger/gen/proto/sf/replay/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type ReplayServer struct {
+	controller *replay.Controller
+}
+
+func NewReplayServer(controller *replay.Controller) *ReplayServer {
+	return &ReplayServer{
+		controller: controller,
+	}
+}
+
+func (s *ReplayServer) Pause(_ context.Context, _ *connect.Request[replayv1.PauseRequest]) (*connect.Response[replayv1.StatusResponse], error) {
+	fmt.Println("replay paused")
+	s.controller.Pause()
+	return s.status(), nil
+}
+
+func (s *ReplayServer) Resume(_ context.Context, _ *connect.Request[replayv1.ResumeRequest]) (*connect.Response[replayv1.StatusResponse], error) {
+	fmt.Println("replay resumed")
+	s.controller.Resume()
+	return s.status(), nil
+}
+
+func (s *ReplayServer) Seek(_ context.Context, req *connect.Request[replayv1.SeekRequest]) (*connect.Response[replayv1.StatusResponse], error) {
+	if req.Msg.Time == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing seek time"))
+	}
+
+	t := req.Msg.Time.AsTime()
+	fmt.Println("replay seeking to", t)
+	err := s.controller.Seek(t)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeOutOfRange, err)
+	}
+	return s.status(), nil
+}
+
+func (s *ReplayServer) SetSpeed(_ context.Context, req *connect.Request[replayv1.SetSpeedRequest]) (*connect.Response[replayv1.StatusResponse], error) {
+	fmt.Println("replay speed set to", req.Msg.Speed)
+	err := s.controller.SetSpeed(req.Msg.Speed)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return s.status(), nil
+}
+
+func (s *ReplayServer) Status(_ context.Context, _ *connect.Request[replayv1.StatusRequest]) (*connect.Response[replayv1.StatusResponse], error) {
+	return s.status(), nil
+}
+
+func (s *ReplayServer) status() *connect.Response[replayv1.StatusResponse] {
+	status := s.controller.Status()
+	return connect.NewResponse(&replayv1.StatusResponse{
+		Paused:      status.Paused,
+		Speed:       status.Speed,
+		CurrentTime: toTimestamp(status.CurrentTime),
+		StartTime:   toTimestamp(status.StartTime),
+		EndTime:     toTimestamp(status.EndTime),
+	})
+}
+
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
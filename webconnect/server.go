@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/streamingfast/gnss-controller/device/neom9n"
+	"github.com/streamingfast/hivemapper-data-logger/data/bus"
 	"github.com/streamingfast/hivemapper-data-logger/data/imu"
 	"github.com/streamingfast/imu-controller/device/iim42652"
 
@@ -19,12 +20,20 @@ import (
 
 type subscriptions map[string]*Subscription
 
+// Subscription queues the events of a subscriber, dropping the oldest ones
+// when the subscriber can't keep up, so that sending an event never blocks.
 type Subscription struct {
-	IncomingEvents chan data.Event
+	IncomingEvents <-chan data.Event
+	events         *bus.Queue[data.Event]
 	includes       []string
 	excludes       []string
 }
 
+// Dropped is the number of events the subscriber was too slow to receive.
+func (s *Subscription) Dropped() uint64 {
+	return s.events.Dropped()
+}
+
 type GRPCEvent struct {
 	*data.BaseEvent
 	Response *eventsv1.EventsResponse
@@ -43,12 +52,27 @@ func (g *GRPCEvent) String() string {
 
 type EventsServer struct {
 	subscriptions subscriptions
+	queueSize     int
 	sync.Mutex
 }
 
-func NewEventServer() *EventsServer {
+type Option func(*EventsServer)
+
+// WithQueueSize sets the number of events queued for each subscriber.
+func WithQueueSize(size int) Option {
+	return func(s *EventsServer) {
+		s.queueSize = size
+	}
+}
+
+func NewEventServer(opts ...Option) *EventsServer {
 	es := &EventsServer{
 		subscriptions: make(subscriptions),
+		queueSize:     100,
+	}
+
+	for _, opt := range opts {
+		opt(es)
 	}
 
 	return es
@@ -80,8 +104,6 @@ func (s *EventsServer) HandleDirectionEvent(event data.Event) error {
 }
 
 func (s *EventsServer) SendEvent(event data.Event) error {
-	s.Lock()
-	defer s.Unlock()
 	bytes, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("marshalling %s %w", event.GetName(), err)
@@ -91,6 +113,9 @@ func (s *EventsServer) SendEvent(event data.Event) error {
 		Payload: bytes,
 	})
 
+	s.Lock()
+	defer s.Unlock()
+
 	for _, sub := range s.subscriptions {
 		send := true
 		if len(sub.includes) > 0 {
@@ -110,7 +135,7 @@ func (s *EventsServer) SendEvent(event data.Event) error {
 			}
 		}
 		if send {
-			sub.IncomingEvents <- grpcEvent
+			sub.events.Push(grpcEvent)
 		}
 	}
 
@@ -121,8 +146,10 @@ func (s *EventsServer) Subscribe(name string, includes []string, excludes []stri
 	s.Lock()
 	defer s.Unlock()
 
+	events := bus.NewQueue[data.Event](s.queueSize, bus.PolicyDropOldest)
 	sub := &Subscription{
-		IncomingEvents: make(chan data.Event),
+		IncomingEvents: events.C(),
+		events:         events,
 		includes:       includes,
 		excludes:       excludes,
 	}
@@ -135,6 +162,9 @@ func (s *EventsServer) Unsubscribe(name string) {
 	s.Lock()
 	defer s.Unlock()
 
+	if sub, found := s.subscriptions[name]; found {
+		fmt.Printf("unsubscribed %s, %d events dropped\n", name, sub.Dropped())
+	}
 	delete(s.subscriptions, name)
 }
 
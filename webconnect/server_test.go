@@ -0,0 +1,32 @@
+package webconnect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/hivemapper-data-logger/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendEventSlowSubscriber(t *testing.T) {
+	s := NewEventServer(WithQueueSize(2))
+	sub := s.Subscribe("slow", nil, nil)
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, s.SendEvent(data.NewBaseEvent("TEST_EVENT", "TEST", time.Now(), nil)))
+		}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("sending events blocked on the slow subscriber")
+	}
+
+	require.Len(t, sub.IncomingEvents, 2)
+	require.Equal(t, uint64(3), sub.Dropped())
+	s.Unsubscribe("slow")
+}